@@ -0,0 +1,161 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/kdbx"
+	"github.com/fire833/keepassxcync/pkg/merge"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+	"github.com/fire833/keepassxcync/pkg/syncer"
+	"github.com/fire833/keepassxcync/pkg/utils"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Environment variable that the password of databases is read from when they are merged or
+// validated. Without it the password is asked for on the terminal when merging.
+const passwordEnv = "KEEPASSXCYNC_PASSWORD"
+
+// Returns the database named in the arguments of a command, or an empty
+// string to select the active database.
+func databaseArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	return args[0]
+}
+
+// Opens a Syncer for the database named in the arguments of a command, which
+// asks the user before taking over a stale lease of another device, and merges
+// diverged edits if the database is set up for it.
+func openSyncer(cmd *cobra.Command, args []string) (*syncer.Syncer, error) {
+	return openSyncerWith(cmd, args, true)
+}
+
+// Like openSyncer, but unless interactive it never asks the user anything. Stale leases
+// are then left alone, and merges without a password in the environment fail, which
+// keeps both sides of the databases.
+func openSyncerWith(cmd *cobra.Command, args []string, interactive bool) (*syncer.Syncer, error) {
+	conf := config.FromContext(cmd.Context())
+	s, e := syncer.Open(cmd.Context(), conf, databaseArg(args))
+	if e != nil {
+		return nil, e
+	}
+
+	db, _ := conf.ResolveDatabase(databaseArg(args))
+	if db != nil && os.Getenv(passwordEnv) != "" {
+		// Check the key too when the password is at hand without asking for it.
+		if creds, e := readCredentials(cmd, db, false); e == nil {
+			s.ValidateWith(func(data []byte) error {
+				return kdbx.Validate(bytes.NewReader(data), creds)
+			})
+		}
+	}
+
+	if db != nil && db.Merge {
+		s.MergeWith(func(local, remote []byte) ([]byte, error) {
+			creds, e := readCredentials(cmd, db, interactive)
+			if e != nil {
+				return nil, e
+			}
+
+			merged, stats, e := merge.Files(local, remote, creds)
+			if e == nil {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: merged diverged edits, %s\n", db.Name, stats)
+			}
+			return merged, e
+		})
+	}
+
+	if !interactive {
+		s.OnStaleLease(func(remote string, lease remotes.Lease) bool {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s is locked by %s, whose lease expired at %s, run a sync to take it over\n",
+				remote, lease.Owner, lease.Expires.Local().Format(time.RFC3339))
+			return false
+		})
+		return s, nil
+	}
+
+	in := bufio.NewScanner(cmd.InOrStdin())
+	s.OnStaleLease(func(remote string, lease remotes.Lease) bool {
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s is locked by %s, whose lease expired at %s. Take it over? [y/N]: ",
+			remote, lease.Owner, lease.Expires.Local().Format(time.RFC3339))
+		return utils.YesOrNoBufIODefault(in, false)
+	})
+
+	return s, nil
+}
+
+// Prints what an operation did to the database and to each of its remotes.
+func printResult(w io.Writer, name string, res *syncer.Result) {
+	if res == nil {
+		return
+	}
+
+	fmt.Fprintf(w, "%s: %s\n", name, res.Action)
+
+	for _, r := range res.Replicas {
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(w, "  %s: %v\n", r.Remote, r.Err)
+		case r.Repaired:
+			fmt.Fprintf(w, "  %s: repaired, now at version %d\n", r.Remote, r.Version.ID)
+		default:
+			fmt.Fprintf(w, "  %s: version %d\n", r.Remote, r.Version.ID)
+		}
+	}
+}
+
+// Reads the credentials of a database, with the password taken from the environment or,
+// if interactive, the terminal and the keyfile from the config.
+func readCredentials(cmd *cobra.Command, db *config.KeepassxCyncDatabase, interactive bool) (*kdbx.Credentials, error) {
+	var keyFile []byte
+	if db.KeyFile != "" {
+		data, e := os.ReadFile(config.ExpandPath(db.KeyFile))
+		if e != nil {
+			return nil, fmt.Errorf("unable to read the keyfile of %s: %w", db.Name, e)
+		}
+		keyFile = data
+	}
+
+	password, ok := os.LookupEnv(passwordEnv)
+	if !ok && interactive && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(cmd.ErrOrStderr(), "Password of %s: ", db.Name)
+		secret, e := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(cmd.ErrOrStderr())
+		if e != nil {
+			return nil, e
+		}
+		password = string(secret)
+	} else if !ok && keyFile == nil {
+		return nil, errors.New("no password to open the database with, set " + passwordEnv)
+	}
+
+	return kdbx.NewCredentials(password, keyFile)
+}
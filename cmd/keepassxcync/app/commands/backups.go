@@ -0,0 +1,49 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package commands
+
+import (
+	"github.com/fire833/keepassxcync/cmd/keepassxcync/app/commands/backups"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewBACKUPSCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "backups",
+		Aliases: []string{"backup"},
+		Short:   "List and restore the local copies taken before a database is replaced",
+		Long:    "",
+		Version: "0.0.1",
+		Example: "",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+	}
+
+	set := pflag.NewFlagSet("backups", pflag.ExitOnError)
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand(
+		backups.NewLISTCommand(openSyncer),
+		backups.NewRESTORECommand(openSyncer),
+	)
+
+	return cmd
+}
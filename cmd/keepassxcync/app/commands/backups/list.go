@@ -0,0 +1,70 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package backups
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Opens the Syncer for the database named in the arguments of a command.
+type Opener func(cmd *cobra.Command, args []string) (*syncer.Syncer, error)
+
+func NewLISTCommand(open Opener) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list [db]",
+		Aliases: []string{"ls"},
+		Example: "",
+		Short:   "List the local copies of a database, newest first",
+		Long:    ``,
+		Version: "0.0.1",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, e := open(cmd, args)
+			if e != nil {
+				return e
+			}
+
+			backups, e := s.Backups()
+			if e != nil {
+				return e
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "N\tTIME\tSIZE\tPATH")
+			for i, b := range backups {
+				fmt.Fprintf(w, "%d\t%s\t%d\t%s\n", i+1, b.Time.Local().Format(time.RFC3339), b.Size, b.Path)
+			}
+
+			return w.Flush()
+		},
+	}
+
+	set := pflag.NewFlagSet("list", pflag.ExitOnError)
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand()
+
+	return cmd
+}
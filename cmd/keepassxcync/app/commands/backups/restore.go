@@ -0,0 +1,70 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package backups
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewRESTORECommand(open Opener) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "restore <n> [db]",
+		Aliases: []string{},
+		Example: "keepassxcync backups restore 1 personal",
+		Short:   "Replace a database with one of its local copies",
+		Long: `Replaces a database with its nth most recent local copy, as numbered by backups list. The database is
+backed up itself before it is replaced, and the next sync publishes the restored contents.`,
+		Version: "0.0.1",
+		Args:    cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, e := strconv.Atoi(args[0])
+			if e != nil {
+				return fmt.Errorf("invalid backup %q, must be a number as listed by backups list", args[0])
+			}
+
+			s, e := open(cmd, args[1:])
+			if e != nil {
+				return e
+			}
+
+			res, e := s.RestoreBackup(n)
+			if res != nil && res.Backup != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "backed up %s to %s\n", s.Name(), res.Backup)
+			}
+
+			if e != nil {
+				return e
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "restored backup %d of %s, the next sync publishes it\n", n, s.Name())
+			return nil
+		},
+	}
+
+	set := pflag.NewFlagSet("restore", pflag.ExitOnError)
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand()
+
+	return cmd
+}
@@ -0,0 +1,67 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package conflicts
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewLISTCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Example: "",
+		Short:   "List the databases with an unresolved conflict",
+		Long:    ``,
+		Version: "0.0.1",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf := config.FromContext(cmd.Context())
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "DATABASE\tDEVICE\tVERSION\tDETECTED\tREMOTE COPY")
+			for _, db := range conf.Databases {
+				st, e := syncer.LoadState(syncer.StatePath(db.Name))
+				if e != nil {
+					return e
+				}
+
+				if c := st.Conflict; c != nil {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", db.Name, c.Version.Host, c.Version.ID, c.Detected.Local().Format(time.RFC3339), c.Path)
+				}
+			}
+
+			return w.Flush()
+		},
+	}
+
+	set := pflag.NewFlagSet("list", pflag.ExitOnError)
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand()
+
+	return cmd
+}
@@ -0,0 +1,76 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package conflicts
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fire833/keepassxcync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Opens the Syncer for the database named in the arguments of a command.
+type Opener func(cmd *cobra.Command, args []string) (*syncer.Syncer, error)
+
+func NewRESOLVECommand(open Opener) *cobra.Command {
+	var keep string
+
+	cmd := &cobra.Command{
+		Use:     "resolve [db]",
+		Aliases: []string{},
+		Example: "keepassxcync conflicts resolve personal --keep local\nkeepassxcync conflicts resolve personal --keep ~/merged.kdbx",
+		Short:   "Finish a conflict by choosing the contents to keep, and sync them",
+		Long: `Resolves the conflict of a database by keeping the local database, the remote copy that was saved next to it,
+or any other file such as a merge of both made in KeePassXC. The local database is backed up before it is replaced.`,
+		Version: "0.0.1",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if keep == "" {
+				return errors.New("--keep is required, use local, remote or the path of a file")
+			}
+
+			s, e := open(cmd, args)
+			if e != nil {
+				return e
+			}
+
+			res, e := s.Resolve(cmd.Context(), keep)
+			if res != nil {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", s.Name(), res.Action)
+			}
+
+			if e != nil {
+				return e
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "conflict of %s resolved\n", s.Name())
+			return nil
+		},
+	}
+
+	set := pflag.NewFlagSet("resolve", pflag.ExitOnError)
+	set.StringVarP(&keep, "keep", "k", "", "Contents to keep, one of local, remote or the path of a file")
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand()
+
+	return cmd
+}
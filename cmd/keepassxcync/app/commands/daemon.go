@@ -0,0 +1,121 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/daemon"
+	"github.com/fire833/keepassxcync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewDAEMONCommand() *cobra.Command {
+	var debounce, interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:     "daemon [db...]",
+		Aliases: []string{},
+		Example: "keepassxcync daemon\nkeepassxcync daemon personal --interval 1m",
+		Short:   "Sync databases whenever they are saved, and pull versions written on other devices",
+		Long: `Watches every database in the config, or the ones given, and syncs a database once it was saved and left
+alone for the debounce time, which lets the temporary file and rename of a KeePassXC save finish first.
+The remotes are polled at the interval to pull versions written on other devices. Stale leases of other
+devices are never taken over and the password is never asked for, as there is no one to ask, so diverged
+databases are only merged when KEEPASSXCYNC_PASSWORD is set. Runs until interrupted.`,
+		Version: "0.0.1",
+		Args:    cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf := config.FromContext(cmd.Context())
+
+			names := args
+			if len(names) == 0 {
+				for _, db := range conf.Databases {
+					names = append(names, db.Name)
+				}
+			}
+
+			if len(names) == 0 {
+				return errors.New("there are no databases to watch, add one with db add")
+			}
+
+			var syncers []*syncer.Syncer
+			defer func() {
+				for _, s := range syncers {
+					s.Close()
+				}
+			}()
+
+			for _, name := range names {
+				// Nobody is around to answer prompts, which would stall every database.
+				s, e := openSyncerWith(cmd, []string{name}, false)
+				if e != nil {
+					return e
+				}
+
+				syncers = append(syncers, s)
+			}
+
+			d, e := daemon.New(daemon.Options{
+				Debounce: debounce,
+				Interval: interval,
+				Report: func(s *syncer.Syncer, res *syncer.Result, e error) {
+					if e == nil && res.Action == syncer.ActionNone {
+						return
+					}
+
+					now := time.Now().Format(time.RFC3339)
+					if res != nil {
+						fmt.Fprintf(cmd.OutOrStdout(), "%s ", now)
+						printResult(cmd.OutOrStdout(), s.Name(), res)
+					}
+
+					if e != nil {
+						fmt.Fprintf(cmd.ErrOrStderr(), "%s %s: %v\n", now, s.Name(), e)
+					}
+				},
+			}, syncers...)
+			if e != nil {
+				return e
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			fmt.Fprintf(cmd.OutOrStdout(), "watching %d databases\n", len(syncers))
+			return d.Run(ctx)
+		},
+	}
+
+	set := pflag.NewFlagSet("daemon", pflag.ExitOnError)
+	set.DurationVar(&debounce, "debounce", daemon.DefaultDebounce, "Time a database must be left alone after it was saved before it is synced")
+	set.DurationVar(&interval, "interval", daemon.DefaultInterval, "Interval at which the remotes are polled for new versions")
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand()
+
+	return cmd
+}
@@ -19,24 +19,60 @@
 package db
 
 import (
+	"fmt"
+
+	"github.com/fire833/keepassxcync/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
 func NewADDCommand() *cobra.Command {
+	var remotes []string
+	var quorum int
+	var active bool
+	var merge bool
+	var keyFile string
+
 	cmd := &cobra.Command{
-		Use:     "add",
+		Use:     "add <name> <path>",
 		Aliases: []string{},
-		Example: "",
-		Short:   "",
+		Example: "keepassxcync db add personal ~/Passwords.kdbx --remote aws --remote nas --remote gdrive --quorum 2",
+		Short:   "Add a local database to the config",
 		Long:    ``,
 		Version: "0.0.1",
+		Args:    cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			conf := config.FromContext(cmd.Context())
+			if conf.GetDatabase(args[0]) != nil {
+				return fmt.Errorf("database %s already exists", args[0])
+			}
+
+			conf.Databases = append(conf.Databases, &config.KeepassxCyncDatabase{
+				Name:    args[0],
+				Path:    args[1],
+				Remotes: remotes,
+				Quorum:  quorum,
+				Merge:   merge,
+				KeyFile: keyFile,
+			})
+			if active || conf.ActiveDatabase == "" {
+				conf.ActiveDatabase = args[0]
+			}
+
+			if e := conf.Validate(); e != nil {
+				return e
+			}
+
+			return conf.Flush()
 		},
 	}
 
 	set := pflag.NewFlagSet("add", pflag.ExitOnError)
+	set.StringArrayVarP(&remotes, "remote", "r", nil, "Remote to replicate the database to, can be given multiple times, defaults to the active remote")
+	set.IntVarP(&quorum, "quorum", "q", 0, "Number of remotes that must accept a push, defaults to a majority")
+	set.BoolVar(&active, "active", false, "Make this the active database")
+	set.BoolVar(&merge, "merge", false, "Merge edits that diverged entry by entry, asking for the password or reading it from $KEEPASSXCYNC_PASSWORD")
+	set.StringVar(&keyFile, "key-file", "", "Keyfile the database is protected with, used when merging")
 
 	cmd.Flags().AddFlagSet(set)
 	cmd.AddCommand()
@@ -19,6 +19,11 @@
 package db
 
 import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fire833/keepassxcync/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -26,13 +31,32 @@ import (
 func NewLISTCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "list",
-		Aliases: []string{},
+		Aliases: []string{"ls"},
 		Example: "",
-		Short:   "",
+		Short:   "List the local databases in the config",
 		Long:    ``,
 		Version: "0.0.1",
+		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			conf := config.FromContext(cmd.Context())
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tPATH\tREMOTES\tQUORUM\tACTIVE")
+			for _, db := range conf.Databases {
+				remotes := strings.Join(db.Remotes, ",")
+				if remotes == "" {
+					remotes = "<active>"
+				}
+
+				n := len(db.Remotes)
+				if n == 0 {
+					n = 1
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%t\n", db.Name, db.Path, remotes, db.WriteQuorum(n), n, db.Name == conf.ActiveDatabase)
+			}
+
+			return w.Flush()
 		},
 	}
 
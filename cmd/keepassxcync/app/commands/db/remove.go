@@ -19,20 +19,39 @@
 package db
 
 import (
+	"fmt"
+
+	"github.com/fire833/keepassxcync/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
 func NewREMOVECommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "remove",
-		Aliases: []string{},
+		Use:     "remove <name>",
+		Aliases: []string{"rm"},
 		Example: "",
-		Short:   "",
+		Short:   "Remove a local database from the config, the file itself is left in place",
 		Long:    ``,
 		Version: "0.0.1",
+		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			conf := config.FromContext(cmd.Context())
+
+			for i, db := range conf.Databases {
+				if db.Name != args[0] {
+					continue
+				}
+
+				conf.Databases = append(conf.Databases[:i], conf.Databases[i+1:]...)
+				if conf.ActiveDatabase == db.Name {
+					conf.ActiveDatabase = ""
+				}
+
+				return conf.Flush()
+			}
+
+			return fmt.Errorf("database %s does not exist", args[0])
 		},
 	}
 
@@ -19,27 +19,111 @@
 package db
 
 import (
+	"fmt"
+
+	"github.com/fire833/keepassxcync/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
 func NewSETCommand() *cobra.Command {
+	var path string
+	var remotes []string
+	var quorum int
+	var active bool
+	var merge bool
+	var keyFile string
+	var backups config.BackupPolicy
+
 	cmd := &cobra.Command{
-		Use:     "set",
+		Use:     "set <name>",
 		Aliases: []string{},
-		Example: "",
-		Short:   "",
+		Example: "keepassxcync db set personal --path ~/Sync/Passwords.kdbx --active\nkeepassxcync db set personal --backup-dir ~/Backups --backup-keep 30 --backup-keep-days 90",
+		Short:   "Change the settings of a local database",
 		Long:    ``,
 		Version: "0.0.1",
+		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			conf := config.FromContext(cmd.Context())
+			db := conf.GetDatabase(args[0])
+			if db == nil {
+				return fmt.Errorf("database %s does not exist", args[0])
+			}
+
+			if path != "" {
+				db.Path = path
+			}
+
+			if cmd.Flags().Changed("remote") {
+				db.Remotes = remotes
+			}
+
+			if cmd.Flags().Changed("quorum") {
+				db.Quorum = quorum
+			}
+
+			if cmd.Flags().Changed("merge") {
+				db.Merge = merge
+			}
+
+			if cmd.Flags().Changed("key-file") {
+				db.KeyFile = keyFile
+			}
+
+			applyBackups(cmd, db, backups)
+
+			if active {
+				conf.ActiveDatabase = db.Name
+			}
+
+			if e := conf.Validate(); e != nil {
+				return e
+			}
+
+			return conf.Flush()
 		},
 	}
 
 	set := pflag.NewFlagSet("set", pflag.ExitOnError)
+	set.StringVar(&path, "path", "", "Path of the database file")
+	set.StringArrayVarP(&remotes, "remote", "r", nil, "Remote to replicate the database to, replaces the current remotes, can be given multiple times")
+	set.IntVarP(&quorum, "quorum", "q", 0, "Number of remotes that must accept a push, 0 for a majority")
+	set.BoolVar(&active, "active", false, "Make this the active database")
+	set.BoolVar(&merge, "merge", false, "Merge edits that diverged entry by entry, asking for the password or reading it from $KEEPASSXCYNC_PASSWORD")
+	set.StringVar(&keyFile, "key-file", "", "Keyfile the database is protected with, used when merging")
+	set.StringVar(&backups.Dir, "backup-dir", "", "Directory local copies are kept in, empty for the state directory")
+	set.StringVar(&backups.Pattern, "backup-pattern", "", "Name of local copies with {name}, {ext} and {time} replaced, empty for "+config.DefaultBackupPattern)
+	set.IntVar(&backups.Keep, "backup-keep", 0, "Number of most recent local copies to keep, 0 for the default")
+	set.IntVar(&backups.KeepDays, "backup-keep-days", 0, "Number of days after which local copies are removed, 0 to keep them regardless of age")
 
 	cmd.Flags().AddFlagSet(set)
 	cmd.AddCommand()
 
 	return cmd
 }
+
+func applyBackups(cmd *cobra.Command, db *config.KeepassxCyncDatabase, backups config.BackupPolicy) {
+	if db.Backups == nil {
+		db.Backups = &config.BackupPolicy{}
+	}
+
+	if cmd.Flags().Changed("backup-dir") {
+		db.Backups.Dir = backups.Dir
+	}
+
+	if cmd.Flags().Changed("backup-pattern") {
+		db.Backups.Pattern = backups.Pattern
+	}
+
+	if cmd.Flags().Changed("backup-keep") {
+		db.Backups.Keep = backups.Keep
+	}
+
+	if cmd.Flags().Changed("backup-keep-days") {
+		db.Backups.KeepDays = backups.KeepDays
+	}
+
+	if db.Backups.Empty() {
+		db.Backups = nil
+	}
+}
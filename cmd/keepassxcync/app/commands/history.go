@@ -0,0 +1,122 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewHISTORYCommand() *cobra.Command {
+	var remote, since, device, output string
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:     "history [db]",
+		Aliases: []string{"log"},
+		Example: "keepassxcync history personal --since 30d --device laptop -o json",
+		Short:   "List the versions of a database that are stored on a remote",
+		Long: `Lists every version of a database stored on a remote, newest first. The active remote is used if it holds
+a replica of the database, and otherwise the first remote of the database. --since accepts a timestamp,
+a date, or an age such as 36h, 30d or 4w.`,
+		Version: "0.0.1",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf := config.FromContext(cmd.Context())
+			db, e := conf.ResolveDatabase(databaseArg(args))
+			if e != nil {
+				return e
+			}
+
+			rc, e := conf.ResolveReplica(db, remote)
+			if e != nil {
+				return e
+			}
+
+			var after time.Time
+			if since != "" {
+				if after, e = parseSince(since, time.Now()); e != nil {
+					return e
+				}
+			}
+
+			r, e := remotes.New(cmd.Context(), rc, db.Name)
+			if e != nil {
+				return e
+			}
+
+			all, e := remotes.ListAllVersions(cmd.Context(), r)
+			if e != nil {
+				return e
+			}
+
+			versions := []remotes.VersionInfo{}
+			for i := len(all) - 1; i >= 0 && (limit <= 0 || len(versions) < limit); i-- {
+				v := all[i]
+				if v.Timestamp.Before(after) || (device != "" && v.Host != device) {
+					continue
+				}
+
+				versions = append(versions, v)
+			}
+
+			return writeOutput(cmd.OutOrStdout(), output, versions, func(w io.Writer) {
+				fmt.Fprintln(w, "ID\tTIMESTAMP\tSIZE\tSHA256\tDEVICE")
+				for _, v := range versions {
+					fmt.Fprintf(w, "%d\t%s\t%d\t%.12s\t%s\n", v.ID, v.Timestamp.Local().Format(time.RFC3339), v.Size, v.SHA256, v.Host)
+				}
+			})
+		},
+	}
+
+	set := pflag.NewFlagSet("history", pflag.ExitOnError)
+	set.StringVarP(&remote, "remote", "r", "", "Remote to list the versions of")
+	set.StringVar(&since, "since", "", "Only list versions written after this time")
+	set.StringVar(&device, "device", "", "Only list versions written by this device")
+	set.IntVarP(&limit, "limit", "n", 0, "Only list this many of the newest versions, 0 for all")
+	set.StringVarP(&output, "output", "o", outputTable, "Output format, one of table, json or yaml")
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand()
+
+	return cmd
+}
+
+// Parses the argument of a --since flag, which is either a point in
+// time or an age that is subtracted from now.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, e := time.ParseInLocation(layout, s, time.Local); e == nil {
+			return t, nil
+		}
+	}
+
+	age, e := config.ParseAge(s)
+	if e != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, must be a timestamp, a date, or an age such as 30d", s)
+	}
+
+	return now.Add(-age), nil
+}
@@ -0,0 +1,222 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/kdbx"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Header and security parameters of a database file, as printed by inspect.
+type inspection struct {
+	Source      string `json:"source" yaml:"source"`
+	Size        int64  `json:"size" yaml:"size"`
+	SHA256      string `json:"sha256" yaml:"sha256"`
+	Format      string `json:"format" yaml:"format"`
+	Cipher      string `json:"cipher" yaml:"cipher"`
+	Compression string `json:"compression,omitempty" yaml:"compression,omitempty"`
+	KDF         struct {
+		Name        string `json:"name" yaml:"name"`
+		Rounds      uint64 `json:"rounds,omitempty" yaml:"rounds,omitempty"`
+		Memory      uint64 `json:"memory,omitempty" yaml:"memory,omitempty"`
+		Iterations  uint64 `json:"iterations,omitempty" yaml:"iterations,omitempty"`
+		Parallelism uint32 `json:"parallelism,omitempty" yaml:"parallelism,omitempty"`
+	} `json:"kdf" yaml:"kdf"`
+	// Whether the header matches its SHA-256, only known for KDBX 4.
+	HeaderIntact *bool `json:"headerIntact,omitempty" yaml:"headerIntact,omitempty"`
+	// Counts stored in the header of KDB 1.x files.
+	Groups  *uint32 `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Entries *uint32 `json:"entries,omitempty" yaml:"entries,omitempty"`
+}
+
+func NewINSPECTCommand() *cobra.Command {
+	var remote, output string
+	var version uint
+
+	cmd := &cobra.Command{
+		Use:     "inspect [db|file]",
+		Aliases: []string{},
+		Example: "keepassxcync inspect personal --remote-version 12 -o json",
+		Short:   "Print the format and security parameters of a database",
+		Long: `Prints the format version, cipher, compression and key derivation parameters of a database, along with the size
+and hash of its file. Only the unencrypted header is read, so no credentials are needed. The argument is the name of
+a database in the config or the path of a file, and defaults to the active database. With --remote-version the given
+version of the database is inspected on a remote instead of the local file.`,
+		Version: "0.0.1",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf := config.FromContext(cmd.Context())
+
+			var source string
+			var data []byte
+			if cmd.Flags().Changed("remote-version") {
+				db, e := conf.ResolveDatabase(databaseArg(args))
+				if e != nil {
+					return e
+				}
+
+				rc, e := conf.ResolveReplica(db, remote)
+				if e != nil {
+					return e
+				}
+
+				r, e := remotes.New(cmd.Context(), rc, db.Name)
+				if e != nil {
+					return e
+				}
+
+				body, _, e := r.GetVersion(cmd.Context(), version)
+				if e != nil {
+					return e
+				}
+				defer body.Close()
+
+				if data, e = io.ReadAll(body); e != nil {
+					return e
+				}
+				source = fmt.Sprintf("%s version %d on %s", db.Name, version, rc.Name)
+			} else {
+				source = inspectPath(conf, databaseArg(args))
+				if source == "" {
+					return errors.New("no database or file specified and no active database is set")
+				}
+
+				var e error
+				if data, e = os.ReadFile(source); e != nil {
+					return e
+				}
+			}
+
+			info, e := inspect(source, data)
+			if e != nil {
+				return fmt.Errorf("unable to inspect %s: %w", source, e)
+			}
+
+			return writeOutput(cmd.OutOrStdout(), output, info, func(w io.Writer) {
+				fmt.Fprintf(w, "Source:\t%s\n", info.Source)
+				fmt.Fprintf(w, "Size:\t%d bytes\n", info.Size)
+				fmt.Fprintf(w, "SHA-256:\t%s\n", info.SHA256)
+				fmt.Fprintf(w, "Format:\t%s\n", info.Format)
+				fmt.Fprintf(w, "Cipher:\t%s\n", info.Cipher)
+				if info.Compression != "" {
+					fmt.Fprintf(w, "Compression:\t%s\n", info.Compression)
+				}
+				fmt.Fprintf(w, "KDF:\t%s\n", info.KDF.Name)
+				if info.KDF.Rounds > 0 {
+					fmt.Fprintf(w, "  Rounds:\t%d\n", info.KDF.Rounds)
+				}
+				if info.KDF.Memory > 0 {
+					fmt.Fprintf(w, "  Memory:\t%s\n", formatMemory(info.KDF.Memory))
+					fmt.Fprintf(w, "  Iterations:\t%d\n", info.KDF.Iterations)
+					fmt.Fprintf(w, "  Parallelism:\t%d\n", info.KDF.Parallelism)
+				}
+				if info.HeaderIntact != nil {
+					fmt.Fprintf(w, "Header intact:\t%t\n", *info.HeaderIntact)
+				}
+				if info.Groups != nil {
+					fmt.Fprintf(w, "Groups:\t%d\n", *info.Groups)
+					fmt.Fprintf(w, "Entries:\t%d\n", *info.Entries)
+				}
+			})
+		},
+	}
+
+	set := pflag.NewFlagSet("inspect", pflag.ExitOnError)
+	set.StringVarP(&remote, "remote", "r", "", "Remote to read the version from, defaults to the active remote")
+	set.UintVar(&version, "remote-version", 0, "Version of the database on the remote to inspect instead of the local file")
+	set.StringVarP(&output, "output", "o", outputTable, "Output format, one of table, json or yaml")
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand()
+
+	return cmd
+}
+
+// Returns the path of the database with the given name, or arg itself if no database has that name.
+func inspectPath(conf *config.KeepassxCyncConfig, arg string) string {
+	if arg == "" {
+		arg = conf.ActiveDatabase
+		if arg == "" {
+			return ""
+		}
+	}
+
+	if db := conf.GetDatabase(arg); db != nil {
+		return config.ExpandPath(db.Path)
+	}
+
+	return config.ExpandPath(arg)
+}
+
+// Describes the database file in data.
+func inspect(source string, data []byte) (*inspection, error) {
+	h, e := kdbx.ParseHeader(bytes.NewReader(data))
+	if e != nil {
+		return nil, e
+	}
+
+	info := &inspection{
+		Source: source,
+		Size:   int64(len(data)),
+		SHA256: remotes.HashBytes(data),
+		Format: h.Format(),
+		Cipher: kdbx.CipherName(h.CipherID),
+	}
+
+	if h.Legacy != nil {
+		info.Groups, info.Entries = &h.Legacy.Groups, &h.Legacy.Entries
+	} else if h.Compression == kdbx.CompressionGzip {
+		info.Compression = "gzip"
+	} else {
+		info.Compression = "none"
+	}
+
+	if h.MajorVersion >= 4 {
+		intact := h.VerifyHash() == nil
+		info.HeaderIntact = &intact
+	}
+
+	k, e := h.KDF()
+	if e != nil {
+		return nil, e
+	}
+
+	info.KDF.Name = k.Name()
+	info.KDF.Rounds = k.Rounds
+	info.KDF.Memory, info.KDF.Iterations, info.KDF.Parallelism = k.Memory, k.Iterations, k.Parallelism
+	return info, nil
+}
+
+// Formats a KDF memory size in bytes, in KiB unless it is a whole number of MiB.
+func formatMemory(size uint64) string {
+	if size >= 1024*1024 && size%(1024*1024) == 0 {
+		return fmt.Sprintf("%d MiB", size/1024/1024)
+	}
+
+	return fmt.Sprintf("%d KiB", size/1024)
+}
@@ -0,0 +1,139 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewPRUNECommand() *cobra.Command {
+	var dryRun bool
+	var only string
+
+	cmd := &cobra.Command{
+		Use:     "prune [db]",
+		Aliases: []string{},
+		Example: "keepassxcync prune personal --dry-run",
+		Short:   "Delete old versions of a database according to the retention policy of each remote",
+		Long: `Applies the retention policy of every remote of a database, and deletes the versions that it does not keep.
+Remotes without a retention policy are left alone, and the latest version of a remote is never deleted.`,
+		Version: "0.0.1",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf := config.FromContext(cmd.Context())
+			db, e := conf.ResolveDatabase(databaseArg(args))
+			if e != nil {
+				return e
+			}
+
+			rcs, e := conf.ResolveRemotes(db)
+			if e != nil {
+				return e
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s:\n", db.Name)
+
+			var errs []error
+			for _, rc := range rcs {
+				if only != "" && rc.Name != only {
+					continue
+				}
+
+				if e := prune(cmd.Context(), cmd.OutOrStdout(), rc, db.Name, dryRun); e != nil {
+					fmt.Fprintf(cmd.OutOrStdout(), "  %s: %v\n", rc.Name, e)
+					errs = append(errs, fmt.Errorf("%s: %w", rc.Name, e))
+				}
+			}
+
+			return errors.Join(errs...)
+		},
+	}
+
+	set := pflag.NewFlagSet("prune", pflag.ExitOnError)
+	set.BoolVarP(&dryRun, "dry-run", "n", false, "Only list the versions that would be deleted")
+	set.StringVarP(&only, "remote", "r", "", "Only prune this remote of the database")
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand()
+
+	return cmd
+}
+
+// Deletes the versions of database on a remote that its retention policy does not keep.
+func prune(ctx context.Context, w io.Writer, rc *config.KeepassxCyncRemote, database string, dryRun bool) error {
+	if rc.Retention.Empty() {
+		fmt.Fprintf(w, "  %s: no retention policy\n", rc.Name)
+		return nil
+	}
+
+	r, e := remotes.New(ctx, rc, database)
+	if e != nil {
+		return e
+	}
+
+	versions, e := remotes.ListAllVersions(ctx, r)
+	if e != nil {
+		return e
+	}
+
+	prunable, e := remotes.Prunable(rc.Retention, versions, time.Now())
+	if e != nil {
+		return e
+	}
+
+	if len(prunable) == 0 {
+		fmt.Fprintf(w, "  %s: nothing to prune\n", rc.Name)
+		return nil
+	}
+
+	d, ok := r.(remotes.Deleter)
+	if !ok && !dryRun {
+		return errors.New("remote does not support deleting versions")
+	}
+
+	for _, v := range prunable {
+		if dryRun {
+			fmt.Fprintf(w, "  %s: would delete version %d from %s\n", rc.Name, v.ID, v.Timestamp.Local().Format(time.RFC3339))
+			continue
+		}
+
+		if e := d.DeleteVersion(ctx, v.ID); e != nil {
+			return fmt.Errorf("unable to delete version %d: %w", v.ID, e)
+		}
+
+		fmt.Fprintf(w, "  %s: deleted version %d from %s\n", rc.Name, v.ID, v.Timestamp.Local().Format(time.RFC3339))
+	}
+
+	verb := "kept"
+	if dryRun {
+		verb = "would keep"
+	}
+
+	fmt.Fprintf(w, "  %s: %s %d of %d versions\n", rc.Name, verb, len(versions)-len(prunable), len(versions))
+	return nil
+}
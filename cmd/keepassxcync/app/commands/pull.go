@@ -25,14 +25,22 @@ import (
 
 func NewPULLCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "pull",
+		Use:     "pull [db]",
 		Aliases: []string{},
 		Example: "",
-		Short:   "",
+		Short:   "Replace a database with the newest version on its remotes",
 		Long:    ``,
 		Version: "0.0.1",
+		Args:    cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			s, e := openSyncer(cmd, args)
+			if e != nil {
+				return e
+			}
+
+			res, e := s.Pull(cmd.Context())
+			printResult(cmd.OutOrStdout(), s.Name(), res)
+			return e
 		},
 	}
 
@@ -25,14 +25,22 @@ import (
 
 func NewPUSHCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "push",
+		Use:     "push [db]",
 		Aliases: []string{},
 		Example: "",
-		Short:   "",
+		Short:   "Upload a database as a new version to each of its remotes",
 		Long:    ``,
 		Version: "0.0.1",
+		Args:    cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			s, e := openSyncer(cmd, args)
+			if e != nil {
+				return e
+			}
+
+			res, e := s.Push(cmd.Context())
+			printResult(cmd.OutOrStdout(), s.Name(), res)
+			return e
 		},
 	}
 
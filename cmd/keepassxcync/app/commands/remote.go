@@ -45,6 +45,7 @@ func NewREMOTECommand() *cobra.Command {
 		remote.NewREMOVECommand(),
 		remote.NewLISTCommand(),
 		remote.NewSETCommand(),
+		remote.NewUNLOCKCommand(),
 	)
 
 	return cmd
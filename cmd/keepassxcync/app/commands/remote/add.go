@@ -19,26 +19,58 @@
 package remote
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/fire833/keepassxcync/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
 func NewADDCommand() *cobra.Command {
+	var remoteType string
+	var opts []string
+	var active bool
+
 	cmd := &cobra.Command{
-		Use:     "add",
+		Use:     "add <name>",
 		Aliases: []string{},
-		Short:   "",
+		Short:   "Add a remote to the config",
 		Long:    "",
 		Version: "0.0.1",
-		Example: "",
+		Example: "keepassxcync remote add nas --type sftp --opt host=nas.local --opt user=me --opt keyFile=~/.ssh/id_ed25519 --opt dir=/srv/keepass",
+		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			conf := config.FromContext(cmd.Context())
+			if conf.GetRemote(args[0]) != nil {
+				return fmt.Errorf("remote %s already exists", args[0])
+			}
+
+			r := &config.KeepassxCyncRemote{Name: args[0], Type: remoteType}
+			if e := applyOptions(r, opts); e != nil {
+				return e
+			}
+
+			if e := r.Validate(); e != nil {
+				return e
+			}
+
+			conf.Remotes = append(conf.Remotes, r)
+			if active || conf.ActiveRemote == "" {
+				conf.ActiveRemote = r.Name
+			}
+
+			return conf.Flush()
 		},
 	}
 
 	set := pflag.NewFlagSet("add", pflag.ExitOnError)
+	set.StringVarP(&remoteType, "type", "t", "", "Type of the remote, one of: "+strings.Join(config.RemoteTypes(), ", "))
+	set.StringArrayVarP(&opts, "opt", "o", nil, "Setting of the remote as key=value, use key=- to be prompted for the value")
+	set.BoolVar(&active, "active", false, "Make this the active remote")
 
 	cmd.Flags().AddFlagSet(set)
+	cmd.MarkFlagRequired("type")
 	cmd.AddCommand()
 
 	return cmd
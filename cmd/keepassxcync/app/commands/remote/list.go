@@ -19,6 +19,10 @@
 package remote
 
 import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/fire833/keepassxcync/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -26,13 +30,22 @@ import (
 func NewLISTCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "list",
-		Aliases: []string{},
-		Short:   "",
+		Aliases: []string{"ls"},
+		Short:   "List the remotes in the config",
 		Long:    "",
 		Version: "0.0.1",
 		Example: "",
+		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			conf := config.FromContext(cmd.Context())
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tTYPE\tACTIVE")
+			for _, r := range conf.Remotes {
+				fmt.Fprintf(w, "%s\t%s\t%t\n", r.Name, r.Type, r.Name == conf.ActiveRemote)
+			}
+
+			return w.Flush()
 		},
 	}
 
@@ -0,0 +1,55 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package remote
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"golang.org/x/term"
+)
+
+// Applies options given as key=value to a remote. A value of "-" is read from the
+// terminal without echoing it, so that secrets do not end up in the shell history.
+func applyOptions(r *config.KeepassxCyncRemote, opts []string) error {
+	for _, opt := range opts {
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok {
+			return fmt.Errorf("option %q must be given as key=value", opt)
+		}
+
+		if value == "-" {
+			fmt.Fprintf(os.Stderr, "%s: ", key)
+			secret, e := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+			if e != nil {
+				return e
+			}
+			value = string(secret)
+		}
+
+		if e := r.SetOption(key, value); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
@@ -19,20 +19,52 @@
 package remote
 
 import (
+	"fmt"
+
+	"github.com/fire833/keepassxcync/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
 func NewREMOVECommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "remove",
-		Aliases: []string{},
-		Short:   "",
+		Use:     "remove <name>",
+		Aliases: []string{"rm"},
+		Short:   "Remove a remote from the config",
 		Long:    "",
 		Version: "0.0.1",
 		Example: "",
+		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			conf := config.FromContext(cmd.Context())
+
+			for i, r := range conf.Remotes {
+				if r.Name != args[0] {
+					continue
+				}
+
+				conf.Remotes = append(conf.Remotes[:i], conf.Remotes[i+1:]...)
+				if conf.ActiveRemote == r.Name {
+					conf.ActiveRemote = ""
+				}
+
+				for _, db := range conf.Databases {
+					for j, name := range db.Remotes {
+						if name == r.Name {
+							db.Remotes = append(db.Remotes[:j], db.Remotes[j+1:]...)
+							break
+						}
+					}
+				}
+
+				if e := conf.Validate(); e != nil {
+					return e
+				}
+
+				return conf.Flush()
+			}
+
+			return fmt.Errorf("remote %s does not exist", args[0])
 		},
 	}
 
@@ -19,27 +19,89 @@
 package remote
 
 import (
+	"fmt"
+
+	"github.com/fire833/keepassxcync/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
 func NewSETCommand() *cobra.Command {
+	var opts []string
+	var active bool
+	var retention config.RetentionPolicy
+
 	cmd := &cobra.Command{
-		Use:     "set",
+		Use:     "set <name>",
 		Aliases: []string{},
-		Short:   "",
+		Short:   "Change the settings of a remote",
 		Long:    "",
 		Version: "0.0.1",
-		Example: "",
+		Example: "keepassxcync remote set nas --opt dir=/srv/keepass --active\nkeepassxcync remote set nas --keep-last 10 --keep-daily 14 --keep-weekly 8 --max-age 52w",
+		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			conf := config.FromContext(cmd.Context())
+			r := conf.GetRemote(args[0])
+			if r == nil {
+				return fmt.Errorf("remote %s does not exist", args[0])
+			}
+
+			if e := applyOptions(r, opts); e != nil {
+				return e
+			}
+
+			applyRetention(cmd, r, retention)
+
+			if e := r.Validate(); e != nil {
+				return e
+			}
+
+			if active {
+				conf.ActiveRemote = r.Name
+			}
+
+			return conf.Flush()
 		},
 	}
 
 	set := pflag.NewFlagSet("set", pflag.ExitOnError)
+	set.StringArrayVarP(&opts, "opt", "o", nil, "Setting of the remote as key=value, use key=- to be prompted for the value")
+	set.BoolVar(&active, "active", false, "Make this the active remote")
+	set.IntVar(&retention.KeepLast, "keep-last", 0, "Number of most recent versions prune keeps, 0 to unset")
+	set.IntVar(&retention.KeepDaily, "keep-daily", 0, "Number of days for which prune keeps the last version of each day, 0 to unset")
+	set.IntVar(&retention.KeepWeekly, "keep-weekly", 0, "Number of weeks for which prune keeps the last version of each week, 0 to unset")
+	set.StringVar(&retention.MaxAge, "max-age", "", "Age after which prune deletes versions, such as 90d or 12w, empty to unset")
 
 	cmd.Flags().AddFlagSet(set)
 	cmd.AddCommand()
 
 	return cmd
 }
+
+// Copies the retention rules whose flags were given onto the remote, and drops
+// the retention policy of the remote once none of its rules are left.
+func applyRetention(cmd *cobra.Command, r *config.KeepassxCyncRemote, retention config.RetentionPolicy) {
+	if r.Retention == nil {
+		r.Retention = &config.RetentionPolicy{}
+	}
+
+	if cmd.Flags().Changed("keep-last") {
+		r.Retention.KeepLast = retention.KeepLast
+	}
+
+	if cmd.Flags().Changed("keep-daily") {
+		r.Retention.KeepDaily = retention.KeepDaily
+	}
+
+	if cmd.Flags().Changed("keep-weekly") {
+		r.Retention.KeepWeekly = retention.KeepWeekly
+	}
+
+	if cmd.Flags().Changed("max-age") {
+		r.Retention.MaxAge = retention.MaxAge
+	}
+
+	if r.Retention.Empty() {
+		r.Retention = nil
+	}
+}
@@ -0,0 +1,111 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package remote
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewUNLOCKCommand() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:     "unlock <name> [db]",
+		Aliases: []string{},
+		Short:   "Break a lease that another device left behind on a remote",
+		Long: `Shows the lease held on the copy of a database on a remote, and removes it when --force is given.
+Only break a lease when the device holding it is known to be gone, as its writes are no longer
+kept apart from the writes of other devices. The active database is used if none is given.`,
+		Version: "0.0.1",
+		Example: "keepassxcync remote unlock nas personal --force",
+		Args:    cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf := config.FromContext(cmd.Context())
+			rc := conf.GetRemote(args[0])
+			if rc == nil {
+				return fmt.Errorf("remote %s does not exist", args[0])
+			}
+
+			var database string
+			if len(args) == 2 {
+				database = args[1]
+			}
+
+			db, e := conf.ResolveDatabase(database)
+			if e != nil {
+				return e
+			}
+
+			r, e := remotes.New(cmd.Context(), rc, db.Name)
+			if e != nil {
+				return e
+			}
+
+			l, ok := r.(remotes.Locker)
+			if !ok {
+				return fmt.Errorf("remote %s does not support locking", rc.Name)
+			}
+
+			// A lease that cannot be read is still broken when --force is given.
+			lease, e := l.CurrentLease(cmd.Context())
+			if e != nil && !force {
+				return e
+			} else if e != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "unable to read the lease of %s on %s: %v\n", db.Name, rc.Name, e)
+			} else if lease == nil {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s is not locked on %s\n", db.Name, rc.Name)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s is locked on %s by %s since %s, expires %s\n", db.Name, rc.Name,
+					lease.Owner, lease.Acquired.Local().Format(time.RFC3339), lease.Expires.Local().Format(time.RFC3339))
+			}
+
+			if !force && lease == nil {
+				return nil
+			} else if !force {
+				return fmt.Errorf("refusing to break the lease of %s without --force", lease.Owner)
+			}
+
+			if e := l.BreakLock(cmd.Context()); e != nil {
+				return e
+			}
+
+			if lease == nil {
+				fmt.Fprintf(cmd.OutOrStdout(), "lock of %s on %s removed\n", db.Name, rc.Name)
+				return nil
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "lease of %s broken\n", lease.Owner)
+			return nil
+		},
+	}
+
+	set := pflag.NewFlagSet("unlock", pflag.ExitOnError)
+	set.BoolVarP(&force, "force", "f", false, "Break the lease even though another device holds it")
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand()
+
+	return cmd
+}
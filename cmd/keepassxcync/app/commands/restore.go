@@ -0,0 +1,103 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/syncer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func NewRESTORECommand() *cobra.Command {
+	var remote, before string
+	var version uint
+	var publish bool
+
+	cmd := &cobra.Command{
+		Use:     "restore <db>",
+		Aliases: []string{},
+		Example: "keepassxcync restore personal --version 42\nkeepassxcync restore personal --before 2023-08-20T09:00:00 --publish",
+		Short:   "Roll the local copy of a database back to a version stored on a remote",
+		Long: `Downloads a version of a database from a remote, checks it against the checksum recorded by the remote,
+backs up the local database and replaces it. The version is either chosen by ID, or as the last
+version written before a point in time. With --publish the restored contents are pushed as a new version right
+away, otherwise the next sync publishes them so that other devices follow.`,
+		// No Version is set, as cobra would claim the --version flag for it.
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			point := syncer.RestorePoint{ID: version}
+			switch {
+			case version != 0 && before != "":
+				return errors.New("only one of --version and --before may be given")
+			case version == 0 && before == "":
+				return errors.New("one of --version and --before is required")
+			case before != "":
+				t, e := parseSince(before, time.Now())
+				if e != nil {
+					return e
+				}
+				point.Before = t
+			}
+
+			conf := config.FromContext(cmd.Context())
+			db, e := conf.ResolveDatabase(args[0])
+			if e != nil {
+				return e
+			}
+
+			rc, e := conf.ResolveReplica(db, remote)
+			if e != nil {
+				return e
+			}
+
+			s, e := openSyncer(cmd, args)
+			if e != nil {
+				return e
+			}
+
+			res, e := s.Restore(cmd.Context(), rc.Name, point, publish)
+			if res != nil && res.Backup != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "backed up %s to %s\n", db.Path, res.Backup)
+			}
+
+			printResult(cmd.OutOrStdout(), s.Name(), res)
+			if e == nil && !publish {
+				fmt.Fprintf(cmd.OutOrStdout(), "restored version %d of %s, the next sync publishes it\n", res.Version.ID, rc.Name)
+			}
+
+			return e
+		},
+	}
+
+	set := pflag.NewFlagSet("restore", pflag.ExitOnError)
+	set.UintVar(&version, "version", 0, "ID of the version to restore")
+	set.StringVar(&before, "before", "", "Restore the last version written before this timestamp, date or age such as 2d")
+	set.StringVarP(&remote, "remote", "r", "", "Remote to restore from, defaults to the active remote")
+	set.BoolVar(&publish, "publish", false, "Push the restored contents as the new latest version")
+
+	cmd.Flags().AddFlagSet(set)
+	cmd.AddCommand()
+
+	return cmd
+}
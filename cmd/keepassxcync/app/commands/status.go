@@ -19,24 +19,66 @@
 package commands
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
 func NewSTATUSCommand() *cobra.Command {
+	var offline bool
+
 	cmd := &cobra.Command{
-		Use:     "status",
+		Use:     "status [db]",
 		Aliases: []string{},
-		Example: "",
-		Short:   "",
-		Long:    ``,
+		Example: "keepassxcync status personal --offline",
+		Short:   "Show whether a database changed locally or on its remotes since the last sync",
+		Long: `Compares the local database with the journal of the last sync on this device, and with the newest version
+on its remotes. With --offline the remotes are not contacted, so only local changes are detected.`,
 		Version: "0.0.1",
+		Args:    cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			s, e := openSyncer(cmd, args)
+			if e != nil {
+				return e
+			}
+
+			rep, e := s.Status(cmd.Context(), offline)
+			if rep == nil {
+				return e
+			}
+
+			w := cmd.OutOrStdout()
+			fmt.Fprintf(w, "%s: %s\n", rep.Database, rep.Status)
+
+			if rep.SHA256 != "" {
+				fmt.Fprintf(w, "  local: %s, sha256 %.12s\n", rep.Path, rep.SHA256)
+			} else {
+				fmt.Fprintf(w, "  local: %s does not exist\n", rep.Path)
+			}
+
+			if rep.State.SHA256 != "" {
+				fmt.Fprintf(w, "  last sync: %s, sha256 %.12s\n", rep.State.Synced.Local().Format(time.RFC3339), rep.State.SHA256)
+			}
+
+			for _, r := range rep.Replicas {
+				switch synced, ok := rep.State.Versions[r.Remote]; {
+				case r.Err != nil:
+					fmt.Fprintf(w, "  %s: %v\n", r.Remote, r.Err)
+				case ok && synced != r.Version.ID:
+					fmt.Fprintf(w, "  %s: version %d, last synced version %d\n", r.Remote, r.Version.ID, synced)
+				default:
+					fmt.Fprintf(w, "  %s: version %d\n", r.Remote, r.Version.ID)
+				}
+			}
+
+			return e
 		},
 	}
 
 	set := pflag.NewFlagSet("status", pflag.ExitOnError)
+	set.BoolVar(&offline, "offline", false, "Only compare the local database with the last sync")
 
 	cmd.Flags().AddFlagSet(set)
 	cmd.AddCommand()
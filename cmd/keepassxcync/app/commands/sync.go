@@ -25,14 +25,22 @@ import (
 
 func NewSYNCCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     "sync",
+		Use:     "sync [db]",
 		Aliases: []string{},
 		Example: "",
-		Short:   "",
+		Short:   "Push or pull a database depending on which side changed last",
 		Long:    ``,
 		Version: "0.0.1",
+		Args:    cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return nil
+			s, e := openSyncer(cmd, args)
+			if e != nil {
+				return e
+			}
+
+			res, e := s.Sync(cmd.Context())
+			printResult(cmd.OutOrStdout(), s.Name(), res)
+			return e
 		},
 	}
 
@@ -20,8 +20,12 @@ package app
 
 import (
 	"github.com/fire833/keepassxcync/cmd/keepassxcync/app/commands"
+	"github.com/fire833/keepassxcync/pkg/config"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+
+	// Register every remote backend.
+	_ "github.com/fire833/keepassxcync/pkg/remotes/all"
 )
 
 func NewKPXCCommand() *cobra.Command {
@@ -34,7 +38,15 @@ func NewKPXCCommand() *cobra.Command {
 		Short:   "",
 		Long:    ``,
 		Version: "0.0.1",
+		// Errors are about the operation, not about how the command was invoked.
+		SilenceUsage: true,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			conf, e := config.LoadOrInit(configFile)
+			if e != nil {
+				return e
+			}
+
+			cmd.SetContext(config.NewContext(cmd.Context(), conf))
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -45,8 +57,8 @@ func NewKPXCCommand() *cobra.Command {
 	set := pflag.NewFlagSet("kpxc", pflag.ExitOnError)
 
 	persistentSet := pflag.NewFlagSet("kpxcp", pflag.ExitOnError)
-	set.StringVarP(&configFile, "config", "c", "~/.config/keepassxcync/config.yaml", "Specify configuration file location for keepassxcync")
-	set.StringVarP(&secretsFile, "secrets", "s", "~/.config/keepassxcync/secrets.yaml", "Specify secrets file location for keepassxcync")
+	persistentSet.StringVarP(&configFile, "config", "c", "~/.config/keepassxcync/config.yaml", "Specify configuration file location for keepassxcync")
+	persistentSet.StringVarP(&secretsFile, "secrets", "s", "~/.config/keepassxcync/secrets.yaml", "Specify secrets file location for keepassxcync")
 
 	cmd.Flags().AddFlagSet(set)
 	cmd.PersistentFlags().AddFlagSet(persistentSet)
@@ -58,6 +70,13 @@ func NewKPXCCommand() *cobra.Command {
 		commands.NewSYNCCommand(),
 		commands.NewPULLCommand(),
 		commands.NewPUSHCommand(),
+		commands.NewHISTORYCommand(),
+		commands.NewRESTORECommand(),
+		commands.NewCONFLICTSCommand(),
+		commands.NewBACKUPSCommand(),
+		commands.NewPRUNECommand(),
+		commands.NewINSPECTCommand(),
+		commands.NewDAEMONCommand(),
 	)
 
 	return cmd
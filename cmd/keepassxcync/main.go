@@ -19,11 +19,18 @@
 package main
 
 import (
+	"errors"
+	"os"
 	"runtime"
 
 	"github.com/fire833/keepassxcync/cmd/keepassxcync/app"
+	"github.com/fire833/keepassxcync/pkg/syncer"
 )
 
+// Exit code of runs that kept a download in quarantine instead of replacing the local database,
+// so that scripts can tell them apart from other failures.
+const exitQuarantined = 3
+
 var (
 	Version string = "unknown"         // String to pass in the version to the binary at compiletime.
 	Commit  string = "unknown"         // Git commit version of this binary.
@@ -34,5 +41,9 @@ var (
 
 func main() {
 	cmd := app.NewKPXCCommand()
-	cmd.Execute()
+	if e := cmd.Execute(); errors.Is(e, syncer.ErrQuarantined) {
+		os.Exit(exitQuarantined)
+	} else if e != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,85 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+// Defaults of a BackupPolicy.
+const (
+	DefaultBackupPattern string = "{name}-{time}{ext}"
+	DefaultBackupKeep    int    = 10
+)
+
+// Where and for how long local copies of a database are kept. A copy is taken before every pull,
+// restore or conflict resolution replaces the database, so that it can be rolled back without
+// reaching any remote. Copies beyond the most recent Keep, or older than KeepDays, are removed.
+type BackupPolicy struct {
+	// Directory the copies are kept in, defaults to backups/<database> under StateDir.
+	Dir string `json:"dir,omitempty" yaml:"dir,omitempty"`
+	// Name of the copies, in which {name} is replaced with the file name of the database without its
+	// extension, {ext} with its extension and {time} with the time of the copy. Defaults to DefaultBackupPattern.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// Number of most recent copies to keep, defaults to DefaultBackupKeep.
+	Keep int `json:"keep,omitempty" yaml:"keep,omitempty"`
+	// Number of days after which copies are removed, copies are kept regardless of age if unset.
+	KeepDays int `json:"keepDays,omitempty" yaml:"keepDays,omitempty"`
+}
+
+// Reports whether the policy sets nothing, in which case the defaults apply.
+func (p *BackupPolicy) Empty() bool {
+	return p == nil || *p == BackupPolicy{}
+}
+
+// Returns a copy of the policy with the defaults filled in, where dir is the default directory.
+func (p *BackupPolicy) WithDefaults(dir string) BackupPolicy {
+	res := BackupPolicy{}
+	if p != nil {
+		res = *p
+	}
+
+	if res.Dir == "" {
+		res.Dir = dir
+	}
+	res.Dir = ExpandPath(res.Dir)
+
+	if res.Pattern == "" {
+		res.Pattern = DefaultBackupPattern
+	}
+
+	if res.Keep == 0 {
+		res.Keep = DefaultBackupKeep
+	}
+
+	return res
+}
+
+func (p *BackupPolicy) Validate() error {
+	if p.Keep < 0 || p.KeepDays < 0 {
+		return errors.New("backup counts must not be negative")
+	}
+
+	if p.Pattern != "" && (strings.Count(p.Pattern, "{time}") != 1 || strings.ContainsAny(p.Pattern, `/\`)) {
+		return errors.New("backup pattern must contain {time} once and no path separators")
+	}
+
+	return nil
+}
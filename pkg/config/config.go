@@ -19,15 +19,23 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Permissions given to newly created config files, as they may hold credentials.
+const defaultPerms fs.FileMode = 0o600
+
+type contextKey struct{}
+
 type KeepassxCyncConfig struct {
 	filePath string      `json:"-" yaml:"-"`
 	perms    fs.FileMode `json:"-" yaml:"-"`
@@ -38,22 +46,35 @@ type KeepassxCyncConfig struct {
 	ActiveDatabase string                  `json:"activeDb" yaml:"activeDb"`
 }
 
-type KeepassxCyncRemote struct {
-	Name string `json:"name" yaml:"name"`
-}
-
 type KeepassxCyncDatabase struct {
 	Name string `json:"name" yaml:"name"`
 	Path string `json:"path" yaml:"path"`
+	// Names of the remotes that hold a replica of this database, the active remote is used if there are none.
+	Remotes []string `json:"remotes,omitempty" yaml:"remotes,omitempty"`
+	// Number of remotes that must accept a new version for a push to succeed, defaults to a majority.
+	Quorum int `json:"quorum,omitempty" yaml:"quorum,omitempty"`
+	// Whether edits that diverged are merged entry by entry, which requires the credentials of the database.
+	Merge bool `json:"merge,omitempty" yaml:"merge,omitempty"`
+	// Keyfile that the database is protected with, if any.
+	KeyFile string `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	// Local copies taken before the database is replaced, the defaults of BackupPolicy apply if unset.
+	Backups *BackupPolicy `json:"backups,omitempty" yaml:"backups,omitempty"`
 }
 
 func Load(path string) (*KeepassxCyncConfig, error) {
+	path = ExpandPath(path)
+
+	info, e := os.Stat(path)
+	if e != nil {
+		return nil, e
+	}
+
 	data, e := os.ReadFile(path)
 	if e != nil {
 		return nil, e
 	}
 
-	conf := &KeepassxCyncConfig{}
+	conf := &KeepassxCyncConfig{perms: info.Mode().Perm()}
 
 	switch filepath.Ext(path) {
 	case ".json":
@@ -69,10 +90,30 @@ func Load(path string) (*KeepassxCyncConfig, error) {
 	}
 
 	conf.filePath = path
-	return conf, nil
+	return conf, conf.Validate()
+}
+
+// Wrapper around Load, but returns an empty config that will be written to path
+// when flushed if there is no config file at path yet.
+func LoadOrInit(path string) (*KeepassxCyncConfig, error) {
+	conf, e := Load(path)
+	if errors.Is(e, fs.ErrNotExist) {
+		switch filepath.Ext(path) {
+		case ".json", ".yaml", ".yml":
+			return &KeepassxCyncConfig{filePath: ExpandPath(path), perms: defaultPerms}, nil
+		default:
+			return nil, errors.New("extension must be .json or .yaml")
+		}
+	}
+
+	return conf, e
 }
 
 func (c *KeepassxCyncConfig) Flush() error {
+	if e := os.MkdirAll(filepath.Dir(c.filePath), 0o700); e != nil {
+		return e
+	}
+
 	switch filepath.Ext(c.filePath) {
 	case ".json":
 		if bytes, e := json.MarshalIndent(c, "", "	"); e != nil {
@@ -90,3 +131,214 @@ func (c *KeepassxCyncConfig) Flush() error {
 		return errors.New("extension must be .json or .yaml")
 	}
 }
+
+// Checks the whole config for invalid remotes and databases, and for references to ones that do not exist.
+func (c *KeepassxCyncConfig) Validate() error {
+	remotes := map[string]bool{}
+	for _, r := range c.Remotes {
+		if e := r.Validate(); e != nil {
+			return e
+		}
+
+		if remotes[r.Name] {
+			return fmt.Errorf("remote %s is defined more than once", r.Name)
+		}
+		remotes[r.Name] = true
+	}
+
+	if c.ActiveRemote != "" && !remotes[c.ActiveRemote] {
+		return fmt.Errorf("active remote %s is not defined", c.ActiveRemote)
+	}
+
+	dbs := map[string]bool{}
+	for _, db := range c.Databases {
+		if db.Name == "" || db.Path == "" {
+			return errors.New("databases must have a name and a path")
+		}
+
+		if dbs[db.Name] {
+			return fmt.Errorf("database %s is defined more than once", db.Name)
+		}
+		dbs[db.Name] = true
+
+		for _, r := range db.Remotes {
+			if !remotes[r] {
+				return fmt.Errorf("database %s is replicated to remote %s, which is not defined", db.Name, r)
+			}
+		}
+
+		// Databases without remotes of their own live on the active remote alone.
+		n := len(db.Remotes)
+		if n == 0 {
+			n = 1
+		}
+
+		if db.Quorum < 0 || db.Quorum > n {
+			return fmt.Errorf("quorum of database %s must be between 1 and the number of its remotes", db.Name)
+		}
+
+		if db.Backups != nil {
+			if e := db.Backups.Validate(); e != nil {
+				return fmt.Errorf("database %s: %w", db.Name, e)
+			}
+		}
+	}
+
+	if c.ActiveDatabase != "" && !dbs[c.ActiveDatabase] {
+		return fmt.Errorf("active database %s is not defined", c.ActiveDatabase)
+	}
+
+	return nil
+}
+
+// Returns the remote with the given name, or nil if there is none.
+func (c *KeepassxCyncConfig) GetRemote(name string) *KeepassxCyncRemote {
+	for _, r := range c.Remotes {
+		if r.Name == name {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// Returns the database with the given name, or nil if there is none.
+func (c *KeepassxCyncConfig) GetDatabase(name string) *KeepassxCyncDatabase {
+	for _, db := range c.Databases {
+		if db.Name == name {
+			return db
+		}
+	}
+
+	return nil
+}
+
+// Returns the database with the given name, or the active database if name is empty.
+func (c *KeepassxCyncConfig) ResolveDatabase(name string) (*KeepassxCyncDatabase, error) {
+	if name == "" {
+		name = c.ActiveDatabase
+	}
+
+	if name == "" {
+		return nil, errors.New("no database specified and no active database is set")
+	}
+
+	if db := c.GetDatabase(name); db != nil {
+		return db, nil
+	}
+
+	return nil, fmt.Errorf("database %s is not defined", name)
+}
+
+// Returns the active remote.
+func (c *KeepassxCyncConfig) ResolveRemote() (*KeepassxCyncRemote, error) {
+	if c.ActiveRemote == "" {
+		return nil, errors.New("no active remote is set")
+	}
+
+	if r := c.GetRemote(c.ActiveRemote); r != nil {
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("remote %s is not defined", c.ActiveRemote)
+}
+
+// Returns the remotes that hold a replica of db, which is the active remote
+// if db does not name any remotes itself.
+func (c *KeepassxCyncConfig) ResolveRemotes(db *KeepassxCyncDatabase) ([]*KeepassxCyncRemote, error) {
+	if len(db.Remotes) == 0 {
+		r, e := c.ResolveRemote()
+		if e != nil {
+			return nil, e
+		}
+
+		return []*KeepassxCyncRemote{r}, nil
+	}
+
+	var remotes []*KeepassxCyncRemote
+	for _, name := range db.Remotes {
+		r := c.GetRemote(name)
+		if r == nil {
+			return nil, fmt.Errorf("remote %s is not defined", name)
+		}
+
+		remotes = append(remotes, r)
+	}
+
+	return remotes, nil
+}
+
+// Returns the remote of db with the given name. An empty name selects the active remote
+// if it holds a replica of db, and otherwise the first remote of db.
+func (c *KeepassxCyncConfig) ResolveReplica(db *KeepassxCyncDatabase, name string) (*KeepassxCyncRemote, error) {
+	remotes, e := c.ResolveRemotes(db)
+	if e != nil {
+		return nil, e
+	}
+
+	if name == "" {
+		name = c.ActiveRemote
+		if c.GetRemote(name) == nil || !contains(remotes, name) {
+			return remotes[0], nil
+		}
+	}
+
+	for _, r := range remotes {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+
+	return nil, fmt.Errorf("remote %s does not hold a replica of %s", name, db.Name)
+}
+
+func contains(remotes []*KeepassxCyncRemote, name string) bool {
+	for _, r := range remotes {
+		if r.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the number of remotes out of n that must accept a new version of the database.
+func (db *KeepassxCyncDatabase) WriteQuorum(n int) int {
+	if db.Quorum > 0 && db.Quorum <= n {
+		return db.Quorum
+	}
+
+	return n/2 + 1
+}
+
+// Returns a copy of ctx that carries the config.
+func NewContext(ctx context.Context, c *KeepassxCyncConfig) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// Returns the config carried by ctx, or nil if there is none.
+func FromContext(ctx context.Context) *KeepassxCyncConfig {
+	c, _ := ctx.Value(contextKey{}).(*KeepassxCyncConfig)
+	return c
+}
+
+// Returns the directory that local state is kept in, which is $XDG_STATE_HOME/keepassxcync,
+// or ~/.local/state/keepassxcync if that is not set.
+func StateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "keepassxcync")
+	}
+
+	return ExpandPath("~/.local/state/keepassxcync")
+}
+
+// Expands a leading ~ in path to the home directory of the user.
+func ExpandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, e := os.UserHomeDir(); e == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+
+	return path
+}
@@ -0,0 +1,150 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package config
+
+import (
+	"testing"
+)
+
+func TestKeepassxCyncConfigValidate(t *testing.T) {
+	remotes := []*KeepassxCyncRemote{
+		{Name: "aws", Type: RemoteTypeS3, S3: &S3RemoteConfig{Bucket: "vault"}},
+		{Name: "nas", Type: RemoteTypeFS, FS: &FSRemoteConfig{Dir: "/mnt/nas"}},
+		{Name: "gdrive", Type: RemoteTypeFS, FS: &FSRemoteConfig{Dir: "/mnt/gdrive"}},
+	}
+
+	tests := []struct {
+		name    string
+		db      *KeepassxCyncDatabase
+		wantErr bool
+	}{
+		{
+			name:    "1",
+			db:      &KeepassxCyncDatabase{Name: "personal", Path: "~/personal.kdbx"},
+			wantErr: false,
+		},
+		{
+			name:    "2",
+			db:      &KeepassxCyncDatabase{Name: "personal", Path: "~/personal.kdbx", Remotes: []string{"aws", "nas", "gdrive"}, Quorum: 2},
+			wantErr: false,
+		},
+		{
+			name:    "3",
+			db:      &KeepassxCyncDatabase{Name: "personal", Path: "~/personal.kdbx", Remotes: []string{"aws", "dropbox"}},
+			wantErr: true,
+		},
+		{
+			name:    "4",
+			db:      &KeepassxCyncDatabase{Name: "personal", Path: "~/personal.kdbx", Remotes: []string{"aws", "nas"}, Quorum: 3},
+			wantErr: true,
+		},
+		{
+			name:    "5",
+			db:      &KeepassxCyncDatabase{Name: "personal", Path: "~/personal.kdbx", Quorum: 2},
+			wantErr: true,
+		},
+		{
+			name:    "6",
+			db:      &KeepassxCyncDatabase{Name: "personal"},
+			wantErr: true,
+		},
+		{
+			name:    "7",
+			db:      &KeepassxCyncDatabase{Name: "personal", Path: "~/personal.kdbx", Backups: &BackupPolicy{Pattern: "{name}.{time}.bak", Keep: 5, KeepDays: 30}},
+			wantErr: false,
+		},
+		{
+			name:    "8",
+			db:      &KeepassxCyncDatabase{Name: "personal", Path: "~/personal.kdbx", Backups: &BackupPolicy{Pattern: "{name}.bak"}},
+			wantErr: true,
+		},
+		{
+			name:    "9",
+			db:      &KeepassxCyncDatabase{Name: "personal", Path: "~/personal.kdbx", Backups: &BackupPolicy{Keep: -1}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &KeepassxCyncConfig{Remotes: remotes, Databases: []*KeepassxCyncDatabase{tt.db}}
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeepassxCyncDatabaseWriteQuorum(t *testing.T) {
+	tests := []struct {
+		name   string
+		quorum int
+		n      int
+		want   int
+	}{
+		{name: "1", quorum: 0, n: 1, want: 1},
+		{name: "2", quorum: 0, n: 3, want: 2},
+		{name: "3", quorum: 0, n: 4, want: 3},
+		{name: "4", quorum: 1, n: 3, want: 1},
+		{name: "5", quorum: 5, n: 3, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &KeepassxCyncDatabase{Quorum: tt.quorum}
+			if got := db.WriteQuorum(tt.n); got != tt.want {
+				t.Errorf("WriteQuorum() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepassxCyncConfigResolveReplica(t *testing.T) {
+	c := &KeepassxCyncConfig{
+		Remotes: []*KeepassxCyncRemote{
+			{Name: "aws", Type: RemoteTypeS3, S3: &S3RemoteConfig{Bucket: "vault"}},
+			{Name: "nas", Type: RemoteTypeFS, FS: &FSRemoteConfig{Dir: "/mnt/nas"}},
+			{Name: "gdrive", Type: RemoteTypeFS, FS: &FSRemoteConfig{Dir: "/mnt/gdrive"}},
+		},
+		ActiveRemote: "nas",
+	}
+
+	tests := []struct {
+		name    string
+		db      *KeepassxCyncDatabase
+		remote  string
+		want    string
+		wantErr bool
+	}{
+		{name: "1", db: &KeepassxCyncDatabase{Name: "personal"}, want: "nas"},
+		{name: "2", db: &KeepassxCyncDatabase{Name: "personal", Remotes: []string{"aws", "nas"}}, want: "nas"},
+		{name: "3", db: &KeepassxCyncDatabase{Name: "personal", Remotes: []string{"aws", "gdrive"}}, want: "aws"},
+		{name: "4", db: &KeepassxCyncDatabase{Name: "personal", Remotes: []string{"aws", "gdrive"}}, remote: "gdrive", want: "gdrive"},
+		{name: "5", db: &KeepassxCyncDatabase{Name: "personal", Remotes: []string{"aws", "gdrive"}}, remote: "nas", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.ResolveReplica(tt.db, tt.remote)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveReplica() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Name != tt.want {
+				t.Errorf("ResolveReplica() = %v, want %v", got.Name, tt.want)
+			}
+		})
+	}
+}
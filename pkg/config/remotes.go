@@ -0,0 +1,267 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of remotes that can be configured.
+const (
+	RemoteTypeS3     string = "s3"
+	RemoteTypeFS     string = "fs"
+	RemoteTypeWebDAV string = "webdav"
+	RemoteTypeSFTP   string = "sftp"
+	RemoteTypeGit    string = "git"
+	RemoteTypeHTTP   string = "http"
+)
+
+type KeepassxCyncRemote struct {
+	Name string `json:"name" yaml:"name"`
+	// Discriminator for which of the settings below configure this remote.
+	Type string `json:"type" yaml:"type"`
+
+	S3     *S3RemoteConfig     `json:"s3,omitempty" yaml:"s3,omitempty"`
+	FS     *FSRemoteConfig     `json:"fs,omitempty" yaml:"fs,omitempty"`
+	WebDAV *WebDAVRemoteConfig `json:"webdav,omitempty" yaml:"webdav,omitempty"`
+	SFTP   *SFTPRemoteConfig   `json:"sftp,omitempty" yaml:"sftp,omitempty"`
+	Git    *GitRemoteConfig    `json:"git,omitempty" yaml:"git,omitempty"`
+	HTTP   *HTTPRemoteConfig   `json:"http,omitempty" yaml:"http,omitempty"`
+
+	// Rules for pruning old versions from this remote, nothing is pruned without them.
+	Retention *RetentionPolicy `json:"retention,omitempty" yaml:"retention,omitempty"`
+}
+
+type S3RemoteConfig struct {
+	Endpoint        string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	Region          string `json:"region,omitempty" yaml:"region,omitempty"`
+	Bucket          string `json:"bucket" yaml:"bucket"`
+	Prefix          string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	AccessKeyID     string `json:"accessKeyId,omitempty" yaml:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty" yaml:"secretAccessKey,omitempty"`
+	UsePathStyle    bool   `json:"usePathStyle,omitempty" yaml:"usePathStyle,omitempty"`
+}
+
+type FSRemoteConfig struct {
+	Dir string `json:"dir" yaml:"dir"`
+}
+
+type WebDAVRemoteConfig struct {
+	URL      string `json:"url" yaml:"url"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	Token    string `json:"token,omitempty" yaml:"token,omitempty"`
+}
+
+type SFTPRemoteConfig struct {
+	Host           string `json:"host" yaml:"host"`
+	User           string `json:"user" yaml:"user"`
+	KeyFile        string `json:"keyFile" yaml:"keyFile"`
+	KeyPassphrase  string `json:"keyPassphrase,omitempty" yaml:"keyPassphrase,omitempty"`
+	KnownHostsFile string `json:"knownHostsFile,omitempty" yaml:"knownHostsFile,omitempty"`
+	Dir            string `json:"dir" yaml:"dir"`
+}
+
+type GitRemoteConfig struct {
+	URL         string `json:"url" yaml:"url"`
+	Branch      string `json:"branch,omitempty" yaml:"branch,omitempty"`
+	CacheDir    string `json:"cacheDir,omitempty" yaml:"cacheDir,omitempty"`
+	AuthorName  string `json:"authorName,omitempty" yaml:"authorName,omitempty"`
+	AuthorEmail string `json:"authorEmail,omitempty" yaml:"authorEmail,omitempty"`
+	Sign        bool   `json:"sign,omitempty" yaml:"sign,omitempty"`
+}
+
+type HTTPRemoteConfig struct {
+	URL   string `json:"url" yaml:"url"`
+	Token string `json:"token,omitempty" yaml:"token,omitempty"`
+}
+
+// Returns every remote type that can be configured.
+func RemoteTypes() []string {
+	return []string{RemoteTypeS3, RemoteTypeFS, RemoteTypeWebDAV, RemoteTypeSFTP, RemoteTypeGit, RemoteTypeHTTP}
+}
+
+// Checks that the remote has a known type, and that only the settings for that type are present and valid.
+func (r *KeepassxCyncRemote) Validate() error {
+	if r.Name == "" {
+		return errors.New("remote must have a name")
+	}
+
+	settings, e := r.settingsField()
+	if e != nil {
+		return e
+	}
+
+	for _, t := range RemoteTypes() {
+		field := reflect.ValueOf(r).Elem().FieldByIndex(settingsIndex(t))
+		if t != r.Type && !field.IsNil() {
+			return fmt.Errorf("remote %s is of type %s, but has %s settings", r.Name, r.Type, t)
+		}
+	}
+
+	if settings.IsNil() {
+		return fmt.Errorf("remote %s is missing %s settings", r.Name, r.Type)
+	}
+
+	var invalid error
+	switch r.Type {
+	case RemoteTypeS3:
+		invalid = required(r.S3.Bucket, "bucket")
+	case RemoteTypeFS:
+		invalid = required(r.FS.Dir, "dir")
+	case RemoteTypeWebDAV:
+		if invalid = validURL(r.WebDAV.URL); invalid == nil && r.WebDAV.Token != "" && r.WebDAV.Username != "" {
+			invalid = errors.New("only one of token and username may be set")
+		}
+	case RemoteTypeSFTP:
+		invalid = errors.Join(
+			required(r.SFTP.Host, "host"),
+			required(r.SFTP.User, "user"),
+			required(r.SFTP.KeyFile, "keyFile"),
+			required(r.SFTP.Dir, "dir"),
+		)
+	case RemoteTypeGit:
+		invalid = required(r.Git.URL, "url")
+	case RemoteTypeHTTP:
+		invalid = validURL(r.HTTP.URL)
+	}
+
+	if invalid == nil && r.Retention != nil {
+		invalid = r.Retention.Validate()
+	}
+
+	if invalid != nil {
+		return fmt.Errorf("invalid %s remote %s: %w", r.Type, r.Name, invalid)
+	}
+
+	return nil
+}
+
+// Returns the names of the settings that can be set on a remote of this type.
+func (r *KeepassxCyncRemote) Options() ([]string, error) {
+	settings, e := r.settingsField()
+	if e != nil {
+		return nil, e
+	}
+
+	t := settings.Type().Elem()
+	var opts []string
+	for i := 0; i < t.NumField(); i++ {
+		opts = append(opts, optionName(t.Field(i)))
+	}
+
+	sort.Strings(opts)
+	return opts, nil
+}
+
+// Sets one of the type specific settings of a remote by the name it has in the config file,
+// creating the settings for the type of the remote if there are none yet.
+func (r *KeepassxCyncRemote) SetOption(key, value string) error {
+	settings, e := r.settingsField()
+	if e != nil {
+		return e
+	}
+
+	if settings.IsNil() {
+		settings.Set(reflect.New(settings.Type().Elem()))
+	}
+
+	s := settings.Elem()
+	for i := 0; i < s.NumField(); i++ {
+		if optionName(s.Type().Field(i)) != key {
+			continue
+		}
+
+		field := s.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Bool:
+			b, e := strconv.ParseBool(value)
+			if e != nil {
+				return fmt.Errorf("option %s must be true or false", key)
+			}
+			field.SetBool(b)
+		}
+
+		return nil
+	}
+
+	opts, _ := r.Options()
+	return fmt.Errorf("unknown option %q for %s remote, valid options are: %s", key, r.Type, strings.Join(opts, ", "))
+}
+
+// Returns the settings field for the type of the remote.
+func (r *KeepassxCyncRemote) settingsField() (reflect.Value, error) {
+	index := settingsIndex(r.Type)
+	if index == nil {
+		return reflect.Value{}, fmt.Errorf("unknown remote type %q, must be one of: %s", r.Type, strings.Join(RemoteTypes(), ", "))
+	}
+
+	return reflect.ValueOf(r).Elem().FieldByIndex(index), nil
+}
+
+// Returns the index of the settings field of KeepassxCyncRemote for a remote type,
+// relying on the settings being tagged with the name of the type.
+func settingsIndex(t string) []int {
+	rt := reflect.TypeOf(KeepassxCyncRemote{})
+	for i := 0; i < rt.NumField(); i++ {
+		if rt.Field(i).Type.Kind() == reflect.Pointer && optionName(rt.Field(i)) == t {
+			return rt.Field(i).Index
+		}
+	}
+
+	return nil
+}
+
+func optionName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+	return name
+}
+
+func required(value, name string) error {
+	if value == "" {
+		return fmt.Errorf("%s is required", name)
+	}
+
+	return nil
+}
+
+func validURL(value string) error {
+	if value == "" {
+		return errors.New("url is required")
+	}
+
+	u, e := url.Parse(value)
+	if e != nil {
+		return e
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url must be http or https, not %q", u.Scheme)
+	}
+
+	return nil
+}
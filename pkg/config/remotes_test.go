@@ -0,0 +1,168 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeepassxCyncRemoteValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		remote  *KeepassxCyncRemote
+		wantErr bool
+	}{
+		{
+			name:    "1",
+			remote:  &KeepassxCyncRemote{Name: "aws", Type: RemoteTypeS3, S3: &S3RemoteConfig{Bucket: "vault"}},
+			wantErr: false,
+		},
+		{
+			name:    "2",
+			remote:  &KeepassxCyncRemote{Name: "aws", Type: RemoteTypeS3, S3: &S3RemoteConfig{}},
+			wantErr: true,
+		},
+		{
+			name:    "3",
+			remote:  &KeepassxCyncRemote{Name: "aws", Type: RemoteTypeS3},
+			wantErr: true,
+		},
+		{
+			name:    "4",
+			remote:  &KeepassxCyncRemote{Name: "aws", Type: "ftp"},
+			wantErr: true,
+		},
+		{
+			name:    "5",
+			remote:  &KeepassxCyncRemote{Name: "nas", Type: RemoteTypeFS, FS: &FSRemoteConfig{Dir: "/mnt"}, S3: &S3RemoteConfig{Bucket: "vault"}},
+			wantErr: true,
+		},
+		{
+			name:    "6",
+			remote:  &KeepassxCyncRemote{Type: RemoteTypeFS, FS: &FSRemoteConfig{Dir: "/mnt"}},
+			wantErr: true,
+		},
+		{
+			name:    "7",
+			remote:  &KeepassxCyncRemote{Name: "cloud", Type: RemoteTypeWebDAV, WebDAV: &WebDAVRemoteConfig{URL: "ftp://cloud.example.com"}},
+			wantErr: true,
+		},
+		{
+			name:    "8",
+			remote:  &KeepassxCyncRemote{Name: "cloud", Type: RemoteTypeWebDAV, WebDAV: &WebDAVRemoteConfig{URL: "https://cloud.example.com", Username: "me", Token: "t"}},
+			wantErr: true,
+		},
+		{
+			name:    "9",
+			remote:  &KeepassxCyncRemote{Name: "ssh", Type: RemoteTypeSFTP, SFTP: &SFTPRemoteConfig{Host: "nas", User: "me", KeyFile: "~/.ssh/id_ed25519"}},
+			wantErr: true,
+		},
+		{
+			name:    "10",
+			remote:  &KeepassxCyncRemote{Name: "repo", Type: RemoteTypeGit, Git: &GitRemoteConfig{URL: "git@example.com:me/vault.git"}},
+			wantErr: false,
+		},
+		{
+			name:    "11",
+			remote:  &KeepassxCyncRemote{Name: "api", Type: RemoteTypeHTTP, HTTP: &HTTPRemoteConfig{URL: "https://vault.example.com/api"}},
+			wantErr: false,
+		},
+		{
+			name:    "12",
+			remote:  &KeepassxCyncRemote{Name: "nas", Type: RemoteTypeFS, FS: &FSRemoteConfig{Dir: "/mnt"}, Retention: &RetentionPolicy{KeepLast: 10, MaxAge: "90d"}},
+			wantErr: false,
+		},
+		{
+			name:    "13",
+			remote:  &KeepassxCyncRemote{Name: "nas", Type: RemoteTypeFS, FS: &FSRemoteConfig{Dir: "/mnt"}, Retention: &RetentionPolicy{MaxAge: "3 months"}},
+			wantErr: true,
+		},
+		{
+			name:    "14",
+			remote:  &KeepassxCyncRemote{Name: "nas", Type: RemoteTypeFS, FS: &FSRemoteConfig{Dir: "/mnt"}, Retention: &RetentionPolicy{KeepDaily: -1}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.remote.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeepassxCyncRemoteSetOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		remote  *KeepassxCyncRemote
+		key     string
+		value   string
+		want    *KeepassxCyncRemote
+		wantErr bool
+	}{
+		{
+			name:   "1",
+			remote: &KeepassxCyncRemote{Name: "aws", Type: RemoteTypeS3},
+			key:    "bucket",
+			value:  "vault",
+			want:   &KeepassxCyncRemote{Name: "aws", Type: RemoteTypeS3, S3: &S3RemoteConfig{Bucket: "vault"}},
+		},
+		{
+			name:   "2",
+			remote: &KeepassxCyncRemote{Name: "aws", Type: RemoteTypeS3, S3: &S3RemoteConfig{Bucket: "vault"}},
+			key:    "usePathStyle",
+			value:  "true",
+			want:   &KeepassxCyncRemote{Name: "aws", Type: RemoteTypeS3, S3: &S3RemoteConfig{Bucket: "vault", UsePathStyle: true}},
+		},
+		{
+			name:    "3",
+			remote:  &KeepassxCyncRemote{Name: "aws", Type: RemoteTypeS3},
+			key:     "usePathStyle",
+			value:   "sometimes",
+			wantErr: true,
+		},
+		{
+			name:    "4",
+			remote:  &KeepassxCyncRemote{Name: "nas", Type: RemoteTypeFS},
+			key:     "bucket",
+			value:   "vault",
+			wantErr: true,
+		},
+		{
+			name:    "5",
+			remote:  &KeepassxCyncRemote{Name: "nas"},
+			key:     "dir",
+			value:   "/mnt",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.remote.SetOption(tt.key, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetOption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.remote, tt.want) {
+				t.Errorf("SetOption() = %+v, want %+v", tt.remote, tt.want)
+			}
+		})
+	}
+}
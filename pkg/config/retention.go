@@ -0,0 +1,96 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rules for which old versions prune removes from a remote. A version is kept if any of the
+// keep rules selects it, and removed once it is older than the max age regardless. Without
+// keep rules every version younger than the max age is kept. The latest version is never removed.
+type RetentionPolicy struct {
+	// Number of most recent versions to keep.
+	KeepLast int `json:"keepLast,omitempty" yaml:"keepLast,omitempty"`
+	// Number of days, including today, for which the last version of each day is kept.
+	KeepDaily int `json:"keepDaily,omitempty" yaml:"keepDaily,omitempty"`
+	// Number of weeks, including this week, for which the last version of each week is kept.
+	KeepWeekly int `json:"keepWeekly,omitempty" yaml:"keepWeekly,omitempty"`
+	// Age after which versions are removed, as a duration such as 720h, 90d or 12w.
+	MaxAge string `json:"maxAge,omitempty" yaml:"maxAge,omitempty"`
+}
+
+// Reports whether the policy has no rules, in which case nothing is pruned.
+func (p *RetentionPolicy) Empty() bool {
+	return p == nil || (p.KeepLast == 0 && p.KeepDaily == 0 && p.KeepWeekly == 0 && p.MaxAge == "")
+}
+
+// Reports whether any of the keep rules is set.
+func (p *RetentionPolicy) HasKeepRules() bool {
+	return p.KeepLast > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0
+}
+
+// Returns the max age as a duration, or 0 if there is none.
+func (p *RetentionPolicy) MaxAgeDuration() (time.Duration, error) {
+	if p.MaxAge == "" {
+		return 0, nil
+	}
+
+	return ParseAge(p.MaxAge)
+}
+
+func (p *RetentionPolicy) Validate() error {
+	if p.KeepLast < 0 || p.KeepDaily < 0 || p.KeepWeekly < 0 {
+		return errors.New("retention counts must not be negative")
+	}
+
+	if age, e := p.MaxAgeDuration(); e != nil {
+		return e
+	} else if age < 0 {
+		return errors.New("retention max age must not be negative")
+	}
+
+	return nil
+}
+
+// Parses a duration as accepted by time.ParseDuration, with the addition
+// of whole days and weeks such as 90d or 12w.
+func ParseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			count, e := strconv.Atoi(n)
+			if e != nil {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+
+			return time.Duration(count) * unit, nil
+		}
+	}
+
+	d, e := time.ParseDuration(s)
+	if e != nil {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+
+	return d, nil
+}
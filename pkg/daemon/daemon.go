@@ -0,0 +1,191 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package daemon keeps databases in sync in the background. Databases are synced shortly after
+// they are saved, and their remotes are polled for versions written by other devices.
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/syncer"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Defaults of Options.
+const (
+	DefaultDebounce time.Duration = 2 * time.Second
+	DefaultInterval time.Duration = 5 * time.Minute
+)
+
+type Options struct {
+	// Time a database must go without changes after it was saved before it is synced.
+	Debounce time.Duration
+	// Interval at which the remotes are polled for new versions.
+	Interval time.Duration
+	// Called with the outcome of every sync.
+	Report func(s *syncer.Syncer, res *syncer.Result, e error)
+}
+
+// Daemon watches the local databases of a set of syncers.
+type Daemon struct {
+	opts    Options
+	syncers map[string]*syncer.Syncer
+}
+
+// Size and modification time of a file, which tell whether a save is still in progress.
+type fileState struct {
+	exists bool
+	size   int64
+	mod    int64
+}
+
+// Database that was changed and is waiting to become stable before it is synced.
+type change struct {
+	due   time.Time
+	state fileState
+}
+
+// Builds a Daemon for the databases of syncers. Unset options are replaced with their defaults.
+func New(opts Options, syncers ...*syncer.Syncer) (*Daemon, error) {
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultDebounce
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+
+	if opts.Report == nil {
+		opts.Report = func(s *syncer.Syncer, res *syncer.Result, e error) {}
+	}
+
+	d := &Daemon{opts: opts, syncers: map[string]*syncer.Syncer{}}
+	for _, s := range syncers {
+		path, e := filepath.Abs(s.Path())
+		if e != nil {
+			return nil, e
+		}
+
+		if other, ok := d.syncers[path]; ok {
+			return nil, fmt.Errorf("databases %s and %s share the file %s", other.Name(), s.Name(), path)
+		}
+		d.syncers[path] = s
+	}
+
+	return d, nil
+}
+
+// Syncs every database once, and then keeps them in sync until ctx is done.
+//
+// The directories of the databases are watched rather than the files themselves, as KeePassXC saves
+// to a temporary file that it renames over the database, which would end a watch on the file.
+// A database is synced once it went without changes for the debounce time and its size and
+// modification time stayed the same over it.
+func (d *Daemon) Run(ctx context.Context) error {
+	w, e := fsnotify.NewWatcher()
+	if e != nil {
+		return e
+	}
+	defer w.Close()
+
+	for path := range d.syncers {
+		if e := w.Add(filepath.Dir(path)); e != nil {
+			return fmt.Errorf("unable to watch %s: %w", filepath.Dir(path), e)
+		}
+	}
+
+	pending := map[string]*change{}
+	d.syncAll(ctx, pending)
+
+	poll := time.NewTicker(d.opts.Interval)
+	defer poll.Stop()
+
+	check := time.NewTicker(d.opts.Debounce / 4)
+	defer check.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+
+			// Attribute changes include the modification time that syncs set themselves.
+			if _, watched := d.syncers[ev.Name]; watched && ev.Op != fsnotify.Chmod {
+				pending[ev.Name] = &change{due: time.Now().Add(d.opts.Debounce), state: stat(ev.Name)}
+			}
+		case e, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+
+			// Changes may have been dropped, so every database is checked instead.
+			if !errors.Is(e, fsnotify.ErrEventOverflow) {
+				return fmt.Errorf("unable to watch the databases: %w", e)
+			}
+			d.syncAll(ctx, pending)
+		case now := <-check.C:
+			for path, c := range pending {
+				if now.Before(c.due) {
+					continue
+				}
+
+				if st := stat(path); !st.exists || st != c.state {
+					c.due, c.state = now.Add(d.opts.Debounce), st
+					continue
+				}
+
+				delete(pending, path)
+				d.sync(ctx, d.syncers[path])
+			}
+		case <-poll.C:
+			d.syncAll(ctx, pending)
+		}
+	}
+}
+
+// Syncs every database that is not in the middle of being saved.
+func (d *Daemon) syncAll(ctx context.Context, pending map[string]*change) {
+	for path, s := range d.syncers {
+		if _, ok := pending[path]; !ok {
+			d.sync(ctx, s)
+		}
+	}
+}
+
+func (d *Daemon) sync(ctx context.Context, s *syncer.Syncer) {
+	res, e := s.Sync(ctx)
+	d.opts.Report(s, res, e)
+}
+
+func stat(path string) fileState {
+	info, e := os.Stat(path)
+	if e != nil {
+		return fileState{}
+	}
+
+	return fileState{exists: true, size: info.Size(), mod: info.ModTime().UnixNano()}
+}
@@ -0,0 +1,191 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+	"github.com/fire833/keepassxcync/pkg/remotes/fs"
+	"github.com/fire833/keepassxcync/pkg/syncer"
+)
+
+// Builds a syncer for a database at path, replicated to a directory.
+func newTestSyncer(t *testing.T, path, remoteDir string) (*syncer.Syncer, remotes.Remote) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	r, e := fs.New(&fs.Options{Dir: remoteDir, Database: "personal"})
+	if e != nil {
+		t.Fatalf("fs.New() error = %v", e)
+	}
+
+	return syncer.New("personal", path, 0, syncer.Replica{Name: "nas", Remote: r}), r
+}
+
+// Saves path the way KeePassXC does, by writing a temporary file in steps and renaming it over the database.
+func safeSave(t *testing.T, path, data string) {
+	tmp := filepath.Join(filepath.Dir(path), ".personal.kdbx.tmp")
+	f, e := os.Create(tmp)
+	if e != nil {
+		t.Fatalf("Create() error = %v", e)
+	}
+
+	for i := 0; i < len(data); i += 4 {
+		f.WriteString(data[i:min(i+4, len(data))])
+		time.Sleep(5 * time.Millisecond)
+	}
+	f.Close()
+
+	if e := os.Rename(tmp, path); e != nil {
+		t.Fatalf("Rename() error = %v", e)
+	}
+}
+
+// Waits until cond holds, failing the test after a few seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestDaemon(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+	desktop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	os.WriteFile(laptop, []byte("first"), 0o600)
+	a, r := newTestSyncer(t, laptop, remoteDir)
+	b, _ := newTestSyncer(t, desktop, remoteDir)
+
+	var mu sync.Mutex
+	var actions []syncer.Action
+	d, e := New(Options{
+		Debounce: 100 * time.Millisecond,
+		Interval: 500 * time.Millisecond,
+		Report: func(s *syncer.Syncer, res *syncer.Result, e error) {
+			if e != nil {
+				t.Errorf("Sync() error = %v", e)
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			actions = append(actions, res.Action)
+		},
+	}, a)
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	last := func(id uint) func() bool {
+		return func() bool {
+			v, e := r.GetLastVersion(ctx)
+			return e == nil && v.ID == id
+		}
+	}
+
+	// The database is synced right away when the daemon starts.
+	eventually(t, "the first push", last(1))
+
+	// A save in several steps is pushed once, after it finished.
+	safeSave(t, laptop, "second, saved by KeePassXC in a few writes")
+	eventually(t, "the push of the save", last(2))
+
+	time.Sleep(300 * time.Millisecond)
+	if versions, _ := remotes.ListAllVersions(ctx, r); len(versions) != 2 {
+		t.Errorf("remote holds %d versions, want the save pushed once", len(versions))
+	}
+
+	// Versions written by other devices are picked up by polling.
+	if _, e := b.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+	os.WriteFile(desktop, []byte("third, from the desktop"), 0o600)
+	if _, e := b.Push(ctx); e != nil {
+		t.Fatalf("Push() error = %v", e)
+	}
+
+	eventually(t, "the pull of the desktop's version", func() bool {
+		got, _ := os.ReadFile(laptop)
+		return string(got) == "third, from the desktop"
+	})
+
+	cancel()
+	if e := <-done; e != nil {
+		t.Errorf("Run() error = %v", e)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, want := range []syncer.Action{syncer.ActionPushed, syncer.ActionPulled} {
+		found := false
+		for _, a := range actions {
+			found = found || a == want
+		}
+		if !found {
+			t.Errorf("reported actions %v, want %v among them", actions, want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	a, _ := newTestSyncer(t, filepath.Join(dir, "personal.kdbx"), t.TempDir())
+	b, _ := newTestSyncer(t, filepath.Join(dir, "personal.kdbx"), t.TempDir())
+	c, _ := newTestSyncer(t, filepath.Join(dir, "work.kdbx"), t.TempDir())
+
+	tests := []struct {
+		name    string
+		syncers []*syncer.Syncer
+		wantErr bool
+	}{
+		{
+			name:    "1",
+			syncers: []*syncer.Syncer{a, c},
+			wantErr: false,
+		},
+		{
+			name:    "2",
+			syncers: []*syncer.Syncer{a, b},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, e := New(Options{}, tt.syncers...); (e != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", e, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestArgon2Key(t *testing.T) {
+	// Test vectors of RFC 9106, section 5.
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+
+	tests := []struct {
+		name string
+		mode int
+		want string
+	}{
+		{
+			name: "1",
+			mode: argon2d,
+			want: "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb",
+		},
+		{
+			name: "2",
+			mode: argon2i,
+			want: "c814d9d1dc7f37aa13f0d77f2494bda1c8de6b016dd388d29952a4c4672b6ce8",
+		},
+		{
+			name: "3",
+			mode: argon2id,
+			want: "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := argon2Key(tt.mode, password, salt, secret, data, 3, 32, 4, 32)
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("argon2Key() = %x, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Without a secret and associated data the result must match x/crypto.
+	got := argon2Key(argon2id, []byte("password"), []byte("somesalt"), nil, nil, 2, 1024, 2, 64)
+	if want := argon2.IDKey([]byte("password"), []byte("somesalt"), 2, 1024, 2, 64); !bytes.Equal(got, want) {
+		t.Errorf("argon2Key() = %x, want %x", got, want)
+	}
+}
@@ -0,0 +1,168 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Size of the blocks that payloads are split into when written.
+const blockSize = 1024 * 1024
+
+var errCorruptBlock = errors.New("payload is corrupt, a block does not match its hash")
+
+// Reads the hashed block stream of KDBX 3, in which every block carries its SHA-256.
+func readHashedBlocks(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for index := uint32(0); ; index++ {
+		if len(data) < 40 {
+			return nil, errors.New("payload is truncated")
+		}
+
+		if binary.LittleEndian.Uint32(data) != index {
+			return nil, errors.New("payload blocks are out of order")
+		}
+
+		hash := data[4:36]
+		size := binary.LittleEndian.Uint32(data[36:])
+		data = data[40:]
+
+		if size == 0 {
+			if !bytes.Equal(hash, make([]byte, 32)) {
+				return nil, errCorruptBlock
+			}
+			return out.Bytes(), nil
+		}
+
+		if uint64(len(data)) < uint64(size) {
+			return nil, errors.New("payload is truncated")
+		}
+
+		block := data[:size]
+		if sum := sha256.Sum256(block); !bytes.Equal(hash, sum[:]) {
+			return nil, errCorruptBlock
+		}
+
+		out.Write(block)
+		data = data[size:]
+	}
+}
+
+func writeHashedBlocks(data []byte) []byte {
+	var out bytes.Buffer
+	index := uint32(0)
+	for len(data) > 0 {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+
+		sum := sha256.Sum256(data[:n])
+		binary.Write(&out, binary.LittleEndian, index)
+		out.Write(sum[:])
+		binary.Write(&out, binary.LittleEndian, uint32(n))
+		out.Write(data[:n])
+
+		data = data[n:]
+		index++
+	}
+
+	binary.Write(&out, binary.LittleEndian, index)
+	out.Write(make([]byte, 32))
+	binary.Write(&out, binary.LittleEndian, uint32(0))
+	return out.Bytes()
+}
+
+// Returns the HMAC-SHA-256 key of the block with the given index. The header uses
+// the index math.MaxUint64.
+func blockKey(key []byte, index uint64) []byte {
+	h := sha512.New()
+	h.Write(le64(index))
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+func blockMAC(key []byte, index uint64, block []byte) []byte {
+	mac := hmac.New(sha256.New, blockKey(key, index))
+	mac.Write(le64(index))
+	mac.Write(le32(uint32(len(block))))
+	mac.Write(block)
+	return mac.Sum(nil)
+}
+
+func headerMAC(key, header []byte) []byte {
+	mac := hmac.New(sha256.New, blockKey(key, math.MaxUint64))
+	mac.Write(header)
+	return mac.Sum(nil)
+}
+
+// Reads the HMAC block stream of KDBX 4, in which every block is authenticated.
+func readHMACBlocks(data, key []byte) ([]byte, error) {
+	var out bytes.Buffer
+	for index := uint64(0); ; index++ {
+		if len(data) < 36 {
+			return nil, errors.New("payload is truncated")
+		}
+
+		mac := data[:32]
+		size := binary.LittleEndian.Uint32(data[32:])
+		data = data[36:]
+
+		if uint64(len(data)) < uint64(size) {
+			return nil, errors.New("payload is truncated")
+		}
+
+		block := data[:size]
+		if !hmac.Equal(mac, blockMAC(key, index, block)) {
+			return nil, errCorruptBlock
+		}
+
+		if size == 0 {
+			return out.Bytes(), nil
+		}
+
+		out.Write(block)
+		data = data[size:]
+	}
+}
+
+func writeHMACBlocks(data, key []byte) []byte {
+	var out bytes.Buffer
+	for index := uint64(0); ; index++ {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+
+		out.Write(blockMAC(key, index, data[:n]))
+		binary.Write(&out, binary.LittleEndian, uint32(n))
+		out.Write(data[:n])
+
+		if n == 0 {
+			return out.Bytes()
+		}
+		data = data[n:]
+	}
+}
@@ -0,0 +1,164 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+	"golang.org/x/crypto/twofish"
+)
+
+// Inner random streams, which encrypt the protected values of the XML payload.
+const (
+	StreamNone     uint32 = 0
+	StreamSalsa20  uint32 = 2
+	StreamChaCha20 uint32 = 3
+)
+
+// Returns the length of the IV of the payload cipher.
+func ivSize(id UUID) int {
+	if id == CipherChaCha20 {
+		return 12
+	}
+
+	return 16
+}
+
+func newBlockCipher(id UUID, key []byte) (cipher.Block, error) {
+	switch id {
+	case CipherAES256:
+		return aes.NewCipher(key)
+	case CipherTwofish:
+		return twofish.NewCipher(key)
+	default:
+		return nil, fmt.Errorf("unsupported cipher %s", id)
+	}
+}
+
+// Decrypts the payload with the cipher of the header.
+func decryptPayload(id UUID, key, iv, data []byte) ([]byte, error) {
+	if id == CipherChaCha20 {
+		c, e := chacha20.NewUnauthenticatedCipher(key, iv)
+		if e != nil {
+			return nil, e
+		}
+
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+		return out, nil
+	}
+
+	block, e := newBlockCipher(id, key)
+	if e != nil {
+		return nil, e
+	}
+
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, ErrInvalidCredentials
+	}
+
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	// Strip the PKCS#7 padding, which is garbage if the key is wrong.
+	n := int(out[len(out)-1])
+	if n == 0 || n > block.BlockSize() || !bytes.Equal(out[len(out)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return out[:len(out)-n], nil
+}
+
+// Encrypts the payload with the cipher of the header.
+func encryptPayload(id UUID, key, iv, data []byte) ([]byte, error) {
+	if id == CipherChaCha20 {
+		return decryptPayload(id, key, iv, data)
+	}
+
+	block, e := newBlockCipher(id, key)
+	if e != nil {
+		return nil, e
+	}
+
+	n := block.BlockSize() - len(data)%block.BlockSize()
+	out := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(n)}, n)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return out, nil
+}
+
+// Keystream that protected values are XORed with, in the order they appear in the XML payload.
+type innerStream interface {
+	XORKeyStream(dst, src []byte)
+}
+
+func newInnerStream(id uint32, key []byte) (innerStream, error) {
+	switch id {
+	case StreamNone:
+		return nullStream{}, nil
+	case StreamSalsa20:
+		sum := sha256.Sum256(key)
+		return &salsa20Stream{key: sum, nonce: [8]byte{0xE8, 0x30, 0x09, 0x4B, 0x97, 0x20, 0x5D, 0x2A}}, nil
+	case StreamChaCha20:
+		sum := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+	default:
+		return nil, fmt.Errorf("unsupported inner random stream %d", id)
+	}
+}
+
+type nullStream struct{}
+
+func (nullStream) XORKeyStream(dst, src []byte) {
+	copy(dst, src)
+}
+
+// Salsa20 keystream that continues across calls, which x/crypto/salsa20 does not.
+type salsa20Stream struct {
+	key     [32]byte
+	nonce   [8]byte
+	counter uint64
+	block   [64]byte
+	used    int
+}
+
+func (s *salsa20Stream) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if s.used == 0 || s.used == len(s.block) {
+			var in [16]byte
+			copy(in[:8], s.nonce[:])
+			binary.LittleEndian.PutUint64(in[8:], s.counter)
+
+			var zero [64]byte
+			salsa.XORKeyStream(s.block[:], zero[:], &in, &s.key)
+			s.counter++
+			s.used = 0
+		}
+
+		dst[i] = src[i] ^ s.block[s.used]
+		s.used++
+	}
+}
@@ -0,0 +1,123 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"strings"
+)
+
+// Password and keyfile that a database is protected with. A database may use either or both.
+type Credentials struct {
+	password []byte
+	keyFile  []byte
+}
+
+// Builds credentials from a password and the contents of a keyfile. An empty password
+// or a nil keyfile means that the database is not protected by it.
+func NewCredentials(password string, keyFile []byte) (*Credentials, error) {
+	c := &Credentials{}
+	if password != "" {
+		sum := sha256.Sum256([]byte(password))
+		c.password = sum[:]
+	}
+
+	if keyFile != nil {
+		key, e := keyFileKey(keyFile)
+		if e != nil {
+			return nil, e
+		}
+		c.keyFile = key
+	}
+
+	if c.password == nil && c.keyFile == nil {
+		return nil, errors.New("a password or a keyfile is required")
+	}
+
+	return c, nil
+}
+
+// Returns the composite key, which is the hash of the hashes of every component.
+func (c *Credentials) compositeKey() []byte {
+	h := sha256.New()
+	h.Write(c.password)
+	h.Write(c.keyFile)
+	return h.Sum(nil)
+}
+
+type xmlKeyFile struct {
+	Version string `xml:"Meta>Version"`
+	Data    struct {
+		Hash  string `xml:"Hash,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Key>Data"`
+}
+
+// Derives the key of a keyfile, which is either a KeePass XML keyfile, 32 raw bytes,
+// 64 hexadecimal characters or, for any other file, the hash of its contents.
+func keyFileKey(data []byte) ([]byte, error) {
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("<?xml")) || bytes.HasPrefix(trimmed, []byte("<KeyFile")) {
+		var kf xmlKeyFile
+		if e := xml.Unmarshal(data, &kf); e == nil && kf.Data.Value != "" {
+			return xmlKeyFileKey(&kf)
+		}
+	}
+
+	switch len(data) {
+	case 32:
+		return data, nil
+	case 64:
+		if key, e := hex.DecodeString(string(data)); e == nil {
+			return key, nil
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+func xmlKeyFileKey(kf *xmlKeyFile) ([]byte, error) {
+	if strings.HasPrefix(kf.Version, "2.") {
+		key, e := hex.DecodeString(strings.Join(strings.Fields(kf.Data.Value), ""))
+		if e != nil {
+			return nil, errors.New("keyfile data is not hexadecimal")
+		}
+
+		if kf.Data.Hash != "" {
+			sum := sha256.Sum256(key)
+			if hash, e := hex.DecodeString(kf.Data.Hash); e != nil || !bytes.Equal(hash, sum[:len(hash)]) {
+				return nil, errors.New("keyfile is corrupt, its hash does not match its data")
+			}
+		}
+
+		return key, nil
+	}
+
+	key, e := base64.StdEncoding.DecodeString(strings.TrimSpace(kf.Data.Value))
+	if e != nil {
+		return nil, errors.New("keyfile data is not base64")
+	}
+
+	return key, nil
+}
@@ -0,0 +1,427 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Signatures at the start of KeePass files. Every file starts with Signature1, which is
+// followed by a second signature that tells the formats apart.
+const (
+	Signature1      uint32 = 0x9AA2D903
+	Signature2      uint32 = 0xB54BFB67
+	SignatureKDB1   uint32 = 0xB54BFB65
+	SignaturePreKDB uint32 = 0xB54BFB66
+)
+
+// Fields of the outer header.
+const (
+	fieldEndOfHeader         byte = 0
+	fieldComment             byte = 1
+	fieldCipherID            byte = 2
+	fieldCompressionFlags    byte = 3
+	fieldMasterSeed          byte = 4
+	fieldTransformSeed       byte = 5
+	fieldTransformRounds     byte = 6
+	fieldEncryptionIV        byte = 7
+	fieldProtectedStreamKey  byte = 8
+	fieldStreamStartBytes    byte = 9
+	fieldInnerRandomStreamID byte = 10
+	fieldKdfParameters       byte = 11
+	fieldPublicCustomData    byte = 12
+)
+
+// Upper bound of the size of a single header field, so that a corrupt length
+// does not make the parser allocate gigabytes.
+const maxFieldSize = 1024 * 1024
+
+// Size of the fixed header of KDB 1.x files, including the signatures.
+const kdb1HeaderSize = 124
+
+// Flag of the KDB 1.x header that selects Twofish instead of AES.
+const kdb1FlagTwofish uint32 = 8
+
+// Compression algorithms of the payload.
+const (
+	CompressionNone uint32 = 0
+	CompressionGzip uint32 = 1
+)
+
+var (
+	ErrNotKDBX            = errors.New("not a KeePass database")
+	ErrLegacyKDB          = errors.New("database is in the KDB 1.x format of KeePass 1, convert it to KDBX with KeePassXC first")
+	ErrInvalidCredentials = errors.New("invalid credentials or corrupt database")
+)
+
+type UUID [16]byte
+
+func (u UUID) String() string {
+	return hex.EncodeToString(u[:])
+}
+
+func mustUUID(s string) UUID {
+	var u UUID
+	if _, e := hex.Decode(u[:], []byte(s)); e != nil {
+		panic(e)
+	}
+
+	return u
+}
+
+// Ciphers of the payload.
+var (
+	CipherAES256   = mustUUID("31c1f2e6bf714350be5805216afc5aff")
+	CipherTwofish  = mustUUID("ad68f29f576f4bb9a36ad47af965346c")
+	CipherChaCha20 = mustUUID("d6038a2b8b6f4cb5a524339a31dbb59a")
+)
+
+// Returns the name of a cipher, or its UUID if it is unknown.
+func CipherName(id UUID) string {
+	switch id {
+	case CipherAES256:
+		return "AES-256"
+	case CipherTwofish:
+		return "Twofish"
+	case CipherChaCha20:
+		return "ChaCha20"
+	default:
+		return id.String()
+	}
+}
+
+// Outer header of a KeePass file, which is stored unencrypted in front of the payload.
+type Header struct {
+	// Version of the format, 3 or 4 for KDBX and 1 for the KDB files of KeePass 1.
+	MajorVersion uint16
+	MinorVersion uint16
+
+	CipherID     UUID
+	Compression  uint32
+	MasterSeed   []byte
+	EncryptionIV []byte
+	Comment      []byte
+
+	// Fields of KDBX 3 and KDB 1.x.
+	TransformSeed   []byte
+	TransformRounds uint64
+
+	// Fields only present in KDBX 3.
+	ProtectedStreamKey  []byte
+	StreamStartBytes    []byte
+	InnerRandomStreamID uint32
+
+	// Fields only present in KDBX 4.
+	KdfParameters    *VariantMap
+	PublicCustomData *VariantMap
+	// SHA-256 and HMAC-SHA-256 of the header, which follow it in KDBX 4 files.
+	SHA256 []byte
+	HMAC   []byte
+
+	// Fields only present in KDB 1.x.
+	Legacy *LegacyHeader
+
+	// Header as it was read, which the integrity checks of the file are computed over.
+	raw []byte
+}
+
+// Fields of the fixed header of KDB 1.x files that have no KDBX counterpart.
+type LegacyHeader struct {
+	Flags   uint32
+	Version uint32
+	Groups  uint32
+	Entries uint32
+	// SHA-256 of the decrypted contents.
+	ContentsHash []byte
+}
+
+// Parses the outer header at the start of r, and for KDBX 4 the SHA-256 and HMAC that follow it.
+// Nothing beyond that is read, so a truncated payload is not noticed. KDB 1.x files are parsed
+// as well, but Open refuses them with ErrLegacyKDB.
+func ParseHeader(r io.Reader) (*Header, error) {
+	var raw bytes.Buffer
+	read := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		if _, e := io.ReadFull(r, b); errors.Is(e, io.EOF) || errors.Is(e, io.ErrUnexpectedEOF) {
+			return nil, errors.New("header is truncated")
+		} else if e != nil {
+			return nil, e
+		}
+
+		raw.Write(b)
+		return b, nil
+	}
+
+	sig, e := read(12)
+	if e != nil {
+		return nil, ErrNotKDBX
+	}
+
+	if binary.LittleEndian.Uint32(sig) != Signature1 {
+		return nil, ErrNotKDBX
+	}
+
+	switch binary.LittleEndian.Uint32(sig[4:]) {
+	case Signature2:
+	case SignatureKDB1:
+		return parseLegacyHeader(sig, read)
+	case SignaturePreKDB:
+		return nil, errors.New("database is in the format of a pre-release of KeePass 2, which is not supported")
+	default:
+		return nil, ErrNotKDBX
+	}
+
+	h := &Header{
+		MinorVersion: binary.LittleEndian.Uint16(sig[8:]),
+		MajorVersion: binary.LittleEndian.Uint16(sig[10:]),
+	}
+
+	if h.MajorVersion != 3 && h.MajorVersion != 4 {
+		return nil, fmt.Errorf("unsupported KDBX version %d.%d", h.MajorVersion, h.MinorVersion)
+	}
+
+	for {
+		var id byte
+		var size uint32
+		if h.MajorVersion < 4 {
+			b, e := read(3)
+			if e != nil {
+				return nil, e
+			}
+			id, size = b[0], uint32(binary.LittleEndian.Uint16(b[1:]))
+		} else {
+			b, e := read(5)
+			if e != nil {
+				return nil, e
+			}
+			id, size = b[0], binary.LittleEndian.Uint32(b[1:])
+		}
+
+		if size > maxFieldSize {
+			return nil, fmt.Errorf("header field %d claims to be %d bytes long", id, size)
+		}
+
+		value, e := read(int(size))
+		if e != nil {
+			return nil, e
+		}
+
+		if id == fieldEndOfHeader {
+			break
+		}
+
+		if e := h.setField(id, value); e != nil {
+			return nil, e
+		}
+	}
+
+	h.raw = raw.Bytes()
+
+	if h.MajorVersion >= 4 {
+		sums := make([]byte, 64)
+		if _, e := io.ReadFull(r, sums); e != nil {
+			return nil, errors.New("header is truncated, its hash is missing")
+		}
+		h.SHA256, h.HMAC = sums[:32], sums[32:]
+	}
+
+	return h, h.validate()
+}
+
+func parseLegacyHeader(sig []byte, read func(n int) ([]byte, error)) (*Header, error) {
+	b, e := read(kdb1HeaderSize - len(sig))
+	if e != nil {
+		return nil, e
+	}
+
+	// sig holds the signatures and the flags, b the rest of the fixed header.
+	h := &Header{
+		MajorVersion:    1,
+		MasterSeed:      b[4:20],
+		EncryptionIV:    b[20:36],
+		TransformSeed:   b[76:108],
+		TransformRounds: uint64(binary.LittleEndian.Uint32(b[108:])),
+		Legacy: &LegacyHeader{
+			Flags:        binary.LittleEndian.Uint32(sig[8:]),
+			Version:      binary.LittleEndian.Uint32(b),
+			Groups:       binary.LittleEndian.Uint32(b[36:]),
+			Entries:      binary.LittleEndian.Uint32(b[40:]),
+			ContentsHash: b[44:76],
+		},
+	}
+
+	h.CipherID = CipherAES256
+	if h.Legacy.Flags&kdb1FlagTwofish != 0 {
+		h.CipherID = CipherTwofish
+	}
+
+	h.raw = append(append([]byte(nil), sig...), b...)
+	return h, nil
+}
+
+func (h *Header) setField(id byte, value []byte) (e error) {
+	switch id {
+	case fieldComment:
+		h.Comment = value
+	case fieldCipherID:
+		if len(value) != 16 {
+			return errors.New("cipher id must be 16 bytes")
+		}
+		copy(h.CipherID[:], value)
+	case fieldCompressionFlags:
+		if len(value) != 4 {
+			return errors.New("compression flags must be 4 bytes")
+		}
+		h.Compression = binary.LittleEndian.Uint32(value)
+	case fieldMasterSeed:
+		h.MasterSeed = value
+	case fieldTransformSeed:
+		h.TransformSeed = value
+	case fieldTransformRounds:
+		if len(value) != 8 {
+			return errors.New("transform rounds must be 8 bytes")
+		}
+		h.TransformRounds = binary.LittleEndian.Uint64(value)
+	case fieldEncryptionIV:
+		h.EncryptionIV = value
+	case fieldProtectedStreamKey:
+		h.ProtectedStreamKey = value
+	case fieldStreamStartBytes:
+		h.StreamStartBytes = value
+	case fieldInnerRandomStreamID:
+		if len(value) != 4 {
+			return errors.New("inner random stream id must be 4 bytes")
+		}
+		h.InnerRandomStreamID = binary.LittleEndian.Uint32(value)
+	case fieldKdfParameters:
+		h.KdfParameters, e = readVariantMap(value)
+	case fieldPublicCustomData:
+		h.PublicCustomData, e = readVariantMap(value)
+	}
+
+	// Unknown fields are skipped, as KeePass does.
+	return e
+}
+
+// Checks that the fields needed to open a database of the version of h are present.
+func (h *Header) validate() error {
+	if len(h.MasterSeed) != 32 {
+		return errors.New("master seed must be 32 bytes")
+	}
+
+	if h.Compression > CompressionGzip {
+		return fmt.Errorf("unsupported compression %d", h.Compression)
+	}
+
+	if h.MajorVersion < 4 {
+		if len(h.TransformSeed) == 0 || len(h.StreamStartBytes) != 32 {
+			return errors.New("header lacks the key transformation or stream start bytes")
+		}
+	} else if h.KdfParameters == nil {
+		return errors.New("header lacks the KDF parameters")
+	}
+
+	return nil
+}
+
+// Returns the name and version of the format, like "KDBX 4.0".
+func (h *Header) Format() string {
+	if h.Legacy != nil {
+		return "KDB 1.x"
+	}
+
+	return fmt.Sprintf("KDBX %d.%d", h.MajorVersion, h.MinorVersion)
+}
+
+// Returns the length of the header in the file, without the hashes that follow it in KDBX 4.
+func (h *Header) Size() int {
+	return len(h.raw)
+}
+
+// Checks the SHA-256 that follows the header of KDBX 4, which needs no credentials and
+// catches a damaged header. Older formats carry no such hash outside of the payload.
+func (h *Header) VerifyHash() error {
+	if h.MajorVersion < 4 {
+		return nil
+	}
+
+	if sum := sha256.Sum256(h.raw); !bytes.Equal(h.SHA256, sum[:]) {
+		return errors.New("header is corrupt, it does not match its hash")
+	}
+
+	return nil
+}
+
+// Encodes the header for the version of h, ending with the end of header field.
+func (h *Header) bytes() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, Signature1)
+	binary.Write(&b, binary.LittleEndian, Signature2)
+	binary.Write(&b, binary.LittleEndian, h.MinorVersion)
+	binary.Write(&b, binary.LittleEndian, h.MajorVersion)
+
+	field := func(id byte, value []byte) {
+		b.WriteByte(id)
+		if h.MajorVersion < 4 {
+			binary.Write(&b, binary.LittleEndian, uint16(len(value)))
+		} else {
+			binary.Write(&b, binary.LittleEndian, uint32(len(value)))
+		}
+		b.Write(value)
+	}
+
+	if len(h.Comment) > 0 {
+		field(fieldComment, h.Comment)
+	}
+	field(fieldCipherID, h.CipherID[:])
+	field(fieldCompressionFlags, le32(h.Compression))
+	field(fieldMasterSeed, h.MasterSeed)
+
+	if h.MajorVersion < 4 {
+		field(fieldTransformSeed, h.TransformSeed)
+		field(fieldTransformRounds, le64(h.TransformRounds))
+		field(fieldEncryptionIV, h.EncryptionIV)
+		field(fieldProtectedStreamKey, h.ProtectedStreamKey)
+		field(fieldStreamStartBytes, h.StreamStartBytes)
+		field(fieldInnerRandomStreamID, le32(h.InnerRandomStreamID))
+	} else {
+		field(fieldEncryptionIV, h.EncryptionIV)
+		field(fieldKdfParameters, h.KdfParameters.bytes())
+		if h.PublicCustomData != nil {
+			field(fieldPublicCustomData, h.PublicCustomData.bytes())
+		}
+	}
+
+	field(fieldEndOfHeader, []byte("\r\n\r\n"))
+	return b.Bytes()
+}
+
+func le32(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+func le64(v uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, v)
+}
@@ -0,0 +1,219 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func encodeTestDatabase(t *testing.T, db *Database) []byte {
+	creds, _ := NewCredentials("password", nil)
+
+	var b bytes.Buffer
+	if e := db.Write(&b, creds); e != nil {
+		t.Fatalf("Write() error = %v", e)
+	}
+
+	return b.Bytes()
+}
+
+// Builds the fixed header of a KDB 1.x file.
+func newTestLegacyHeader(flags uint32) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, Signature1)
+	binary.Write(&b, binary.LittleEndian, SignatureKDB1)
+	binary.Write(&b, binary.LittleEndian, flags)
+	binary.Write(&b, binary.LittleEndian, uint32(0x00030004))
+	b.Write(bytes.Repeat([]byte{1}, 16))
+	b.Write(bytes.Repeat([]byte{2}, 16))
+	binary.Write(&b, binary.LittleEndian, uint32(3))
+	binary.Write(&b, binary.LittleEndian, uint32(42))
+	b.Write(bytes.Repeat([]byte{3}, 32))
+	b.Write(bytes.Repeat([]byte{4}, 32))
+	binary.Write(&b, binary.LittleEndian, uint32(50000))
+	return b.Bytes()
+}
+
+func TestParseHeader(t *testing.T) {
+	v4 := newTestDatabase(4, CipherChaCha20)
+	v4.Header.KdfParameters.Set(kdfUUID, VariantBytes, KdfArgon2id[:])
+	v3 := newTestDatabase(3, CipherTwofish)
+	aesKdf := newTestDatabase(4, CipherAES256)
+	aesKdf.Header.KdfParameters = &VariantMap{Version: variantMapVersion}
+	aesKdf.Header.KdfParameters.Set(kdfUUID, VariantBytes, KdfAES[:])
+	aesKdf.Header.KdfParameters.Set(kdfSeed, VariantBytes, make([]byte, 32))
+	aesKdf.Header.KdfParameters.Set(kdfRounds, VariantUint64, le64(1000))
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		cipher string
+		kdf    KDF
+		ivSize int
+	}{
+		{
+			name:   "1",
+			data:   encodeTestDatabase(t, v4),
+			format: "KDBX 4.0",
+			cipher: "ChaCha20",
+			kdf:    KDF{ID: KdfArgon2id, Memory: 1024 * 1024, Iterations: 1, Parallelism: 2, Version: argon2Version},
+			ivSize: 12,
+		},
+		{
+			name:   "2",
+			data:   encodeTestDatabase(t, v3),
+			format: "KDBX 3.1",
+			cipher: "Twofish",
+			kdf:    KDF{ID: KdfAES, Rounds: 1000},
+			ivSize: 16,
+		},
+		{
+			name:   "3",
+			data:   encodeTestDatabase(t, aesKdf),
+			format: "KDBX 4.0",
+			cipher: "AES-256",
+			kdf:    KDF{ID: KdfAES, Rounds: 1000},
+			ivSize: 16,
+		},
+		{
+			name:   "4",
+			data:   newTestLegacyHeader(kdb1FlagTwofish | 1),
+			format: "KDB 1.x",
+			cipher: "Twofish",
+			kdf:    KDF{ID: KdfAES, Rounds: 50000},
+			ivSize: 16,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, e := ParseHeader(bytes.NewReader(tt.data))
+			if e != nil {
+				t.Fatalf("ParseHeader() error = %v", e)
+			}
+
+			if h.Format() != tt.format || CipherName(h.CipherID) != tt.cipher || len(h.EncryptionIV) != tt.ivSize {
+				t.Errorf("ParseHeader() = %s %s with a %d byte IV, want %s %s with a %d byte IV",
+					h.Format(), CipherName(h.CipherID), len(h.EncryptionIV), tt.format, tt.cipher, tt.ivSize)
+			}
+
+			k, e := h.KDF()
+			if e != nil {
+				t.Fatalf("KDF() error = %v", e)
+			}
+			if k.ID != tt.kdf.ID || k.Rounds != tt.kdf.Rounds || k.Memory != tt.kdf.Memory || k.Iterations != tt.kdf.Iterations || k.Parallelism != tt.kdf.Parallelism || k.Version != tt.kdf.Version {
+				t.Errorf("KDF() = %+v, want %+v", k, tt.kdf)
+			}
+
+			if e := h.VerifyHash(); e != nil {
+				t.Errorf("VerifyHash() error = %v", e)
+			}
+		})
+	}
+}
+
+func TestParseHeaderLegacy(t *testing.T) {
+	data := newTestLegacyHeader(2)
+
+	h, e := ParseHeader(bytes.NewReader(data))
+	if e != nil {
+		t.Fatalf("ParseHeader() error = %v", e)
+	}
+
+	if h.Legacy == nil || h.Legacy.Groups != 3 || h.Legacy.Entries != 42 || h.Legacy.Version != 0x00030004 {
+		t.Errorf("ParseHeader() legacy fields = %+v", h.Legacy)
+	}
+
+	if h.CipherID != CipherAES256 || !bytes.Equal(h.MasterSeed, bytes.Repeat([]byte{1}, 16)) || !bytes.Equal(h.TransformSeed, bytes.Repeat([]byte{4}, 32)) {
+		t.Errorf("ParseHeader() misread the fixed header")
+	}
+
+	creds, _ := NewCredentials("password", nil)
+	if _, e := Open(bytes.NewReader(data), creds); !errors.Is(e, ErrLegacyKDB) {
+		t.Errorf("Open() error = %v, want %v", e, ErrLegacyKDB)
+	}
+}
+
+func TestParseHeaderInvalid(t *testing.T) {
+	valid := encodeTestDatabase(t, newTestDatabase(4, CipherAES256))
+	h, _ := ParseHeader(bytes.NewReader(valid))
+
+	// Flip a bit of the master seed, which follows the cipher and the compression fields.
+	tampered := append([]byte(nil), valid...)
+	tampered[12+21+9+5] ^= 0x01
+
+	huge := append([]byte(nil), valid[:12]...)
+	huge = append(huge, fieldCipherID, 0xFF, 0xFF, 0xFF, 0x7F)
+
+	preRelease := append([]byte(nil), valid...)
+	binary.LittleEndian.PutUint32(preRelease[4:], SignaturePreKDB)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{
+			name:    "1",
+			data:    nil,
+			wantErr: ErrNotKDBX,
+		},
+		{
+			name:    "2",
+			data:    make([]byte, 4096),
+			wantErr: ErrNotKDBX,
+		},
+		{
+			name: "3",
+			data: valid[:h.Size()-3],
+		},
+		{
+			name: "4",
+			data: valid[:h.Size()+40],
+		},
+		{
+			name: "5",
+			data: huge,
+		},
+		{
+			name: "6",
+			data: preRelease,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, e := ParseHeader(bytes.NewReader(tt.data))
+			if e == nil || (tt.wantErr != nil && !errors.Is(e, tt.wantErr)) {
+				t.Errorf("ParseHeader() error = %v, want %v", e, tt.wantErr)
+			}
+		})
+	}
+
+	// A damaged header still parses, but no longer matches its hash.
+	got, e := ParseHeader(bytes.NewReader(tampered))
+	if e != nil {
+		t.Fatalf("ParseHeader() error = %v", e)
+	}
+	if got.VerifyHash() == nil {
+		t.Errorf("VerifyHash() of a damaged header error = nil")
+	}
+}
@@ -0,0 +1,510 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package kdbx reads and writes KeePass databases in the KDBX 3.1 and 4.x formats, and
+// parses the headers of legacy KDB 1.x files so that they can be told apart.
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields of the inner header of KDBX 4.
+const (
+	innerEndOfHeader      byte = 0
+	innerRandomStreamID   byte = 1
+	innerRandomStreamKey  byte = 2
+	innerBinary           byte = 3
+	innerBinaryProtected  byte = 0x01
+	salsa20StreamKeySize       = 32
+	chacha20StreamKeySize      = 64
+)
+
+// Attachment of an entry. Entries refer to attachments by their index in Database.Binaries.
+type Binary struct {
+	// Whether KeePass keeps the attachment protected in memory.
+	Protected bool
+	Data      []byte
+}
+
+// Decrypted KeePass database.
+type Database struct {
+	Header *Header
+	// Inner random stream that protected values are encrypted with in the file.
+	InnerRandomStreamID uint32
+	Binaries            []Binary
+	// The KeePassFile element of the XML payload. Protected values hold their plain text.
+	Content *Node
+}
+
+// Reads and decrypts the database in r.
+func Open(r io.Reader, creds *Credentials) (*Database, error) {
+	data, e := io.ReadAll(r)
+	if e != nil {
+		return nil, e
+	}
+
+	h, e := ParseHeader(bytes.NewReader(data))
+	if e != nil {
+		return nil, e
+	}
+
+	if h.Legacy != nil {
+		return nil, ErrLegacyKDB
+	}
+
+	if creds == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	transformed, e := h.transformKey(creds.compositeKey())
+	if e != nil {
+		return nil, e
+	}
+
+	db := &Database{Header: h}
+	key := cipherKey(h.MasterSeed, transformed)
+	rest := data[len(h.raw):]
+
+	var payload, streamKey []byte
+	if h.MajorVersion < 4 {
+		plain, e := decryptPayload(h.CipherID, key, h.EncryptionIV, rest)
+		if e != nil {
+			return nil, e
+		}
+
+		if len(plain) < 32 || !bytes.Equal(plain[:32], h.StreamStartBytes) {
+			return nil, ErrInvalidCredentials
+		}
+
+		if payload, e = readHashedBlocks(plain[32:]); e != nil {
+			return nil, e
+		}
+
+		if payload, e = decompress(h.Compression, payload); e != nil {
+			return nil, e
+		}
+
+		db.InnerRandomStreamID, streamKey = h.InnerRandomStreamID, h.ProtectedStreamKey
+	} else {
+		if e := h.VerifyHash(); e != nil {
+			return nil, e
+		}
+
+		macKey := hmacKey(h.MasterSeed, transformed)
+		if !hmac.Equal(h.HMAC, headerMAC(macKey, h.raw)) {
+			return nil, ErrInvalidCredentials
+		}
+
+		encrypted, e := readHMACBlocks(rest[64:], macKey)
+		if e != nil {
+			return nil, e
+		}
+
+		plain, e := decryptPayload(h.CipherID, key, h.EncryptionIV, encrypted)
+		if e != nil {
+			return nil, e
+		}
+
+		if plain, e = decompress(h.Compression, plain); e != nil {
+			return nil, e
+		}
+
+		if payload, streamKey, e = db.readInnerHeader(plain); e != nil {
+			return nil, e
+		}
+	}
+
+	stream, e := newInnerStream(db.InnerRandomStreamID, streamKey)
+	if e != nil {
+		return nil, e
+	}
+
+	if db.Content, e = parseXML(bytes.NewReader(payload)); e != nil {
+		return nil, e
+	}
+
+	if db.Content.Name != "KeePassFile" || db.Content.Find("Root", "Group") == nil {
+		return nil, errors.New("payload is not a KeePass database")
+	}
+
+	if e := unprotect(db.Content, stream); e != nil {
+		return nil, e
+	}
+
+	if h.MajorVersion < 4 {
+		if hash := db.Content.Find("Meta", "HeaderHash"); hash != nil && hash.Text != "" {
+			if sum := sha256.Sum256(h.raw); hash.Text != base64.StdEncoding.EncodeToString(sum[:]) {
+				return nil, errors.New("header is corrupt, it does not match the hash in the payload")
+			}
+		}
+
+		if e := db.extractBinaries(); e != nil {
+			return nil, e
+		}
+	}
+
+	return db, nil
+}
+
+// Parses the inner header in front of the XML payload of KDBX 4.
+func (db *Database) readInnerHeader(data []byte) (payload, streamKey []byte, e error) {
+	for {
+		if len(data) < 5 {
+			return nil, nil, errors.New("inner header is truncated")
+		}
+
+		id, size := data[0], binary.LittleEndian.Uint32(data[1:])
+		data = data[5:]
+		if uint64(len(data)) < uint64(size) {
+			return nil, nil, errors.New("inner header is truncated")
+		}
+		value := data[:size]
+		data = data[size:]
+
+		switch id {
+		case innerEndOfHeader:
+			return data, streamKey, nil
+		case innerRandomStreamID:
+			if len(value) != 4 {
+				return nil, nil, errors.New("inner random stream id must be 4 bytes")
+			}
+			db.InnerRandomStreamID = binary.LittleEndian.Uint32(value)
+		case innerRandomStreamKey:
+			streamKey = append([]byte(nil), value...)
+		case innerBinary:
+			if len(value) < 1 {
+				return nil, nil, errors.New("inner header holds an empty binary")
+			}
+			db.Binaries = append(db.Binaries, Binary{Protected: value[0]&innerBinaryProtected != 0, Data: append([]byte(nil), value[1:]...)})
+		}
+	}
+}
+
+// Moves the attachments that KDBX 3 keeps in Meta/Binaries into db.Binaries, and
+// points the references of entries at their index.
+func (db *Database) extractBinaries() error {
+	meta := db.Content.Child("Meta")
+	if meta == nil || meta.Child("Binaries") == nil {
+		return nil
+	}
+
+	binaries := meta.Child("Binaries")
+	index := map[string]int{}
+	for _, b := range binaries.ChildrenNamed("Binary") {
+		var data []byte
+		if b.Protected() {
+			data = []byte(b.Text)
+		} else {
+			var e error
+			if data, e = base64.StdEncoding.DecodeString(strings.TrimSpace(b.Text)); e != nil {
+				return fmt.Errorf("binary %s is not base64: %w", b.Attr("ID"), e)
+			}
+
+			if strings.EqualFold(b.Attr("Compressed"), "True") {
+				if data, e = decompress(CompressionGzip, data); e != nil {
+					return e
+				}
+			}
+		}
+
+		index[b.Attr("ID")] = len(db.Binaries)
+		db.Binaries = append(db.Binaries, Binary{Protected: b.Protected(), Data: data})
+	}
+
+	meta.Remove(binaries)
+
+	var e error
+	db.Content.Child("Root").Walk(func(n *Node) {
+		if ref := n.Attr("Ref"); n.Name == "Value" && ref != "" {
+			if i, ok := index[ref]; ok {
+				n.SetAttr("Ref", strconv.Itoa(i))
+			} else if e == nil {
+				e = fmt.Errorf("entry refers to binary %s, which does not exist", ref)
+			}
+		}
+	})
+
+	return e
+}
+
+// Encrypts and writes db to w. Seeds and IVs are generated anew for every write.
+func (db *Database) Write(w io.Writer, creds *Credentials) error {
+	h := *db.Header
+	h.MasterSeed = randomBytes(32)
+	h.EncryptionIV = randomBytes(ivSize(h.CipherID))
+
+	var streamKey []byte
+	if h.MajorVersion < 4 {
+		streamKey = randomBytes(salsa20StreamKeySize)
+		h.TransformSeed = randomBytes(32)
+		h.StreamStartBytes = randomBytes(32)
+		h.ProtectedStreamKey = streamKey
+		h.InnerRandomStreamID = db.InnerRandomStreamID
+	} else {
+		streamKey = randomBytes(chacha20StreamKeySize)
+		h.KdfParameters = h.KdfParameters.clone()
+		h.KdfParameters.Set(kdfSeed, VariantBytes, randomBytes(32))
+	}
+
+	raw := h.bytes()
+	transformed, e := h.transformKey(creds.compositeKey())
+	if e != nil {
+		return e
+	}
+	key := cipherKey(h.MasterSeed, transformed)
+
+	content := db.Content.Clone()
+	content.Walk(func(n *Node) {
+		if isTimeElement(n.Name) && len(n.Children) == 0 {
+			if t, ok := ParseTime(n.Text); ok {
+				n.Text = FormatTime(t, h.MajorVersion)
+			}
+		}
+	})
+
+	if h.MajorVersion < 4 {
+		db.insertBinaries(content, raw)
+	}
+
+	stream, e := newInnerStream(db.InnerRandomStreamID, streamKey)
+	if e != nil {
+		return e
+	}
+	protect(content, stream)
+
+	var out bytes.Buffer
+	out.Write(raw)
+
+	if h.MajorVersion < 4 {
+		payload, e := compress(h.Compression, content.bytes())
+		if e != nil {
+			return e
+		}
+
+		encrypted, e := encryptPayload(h.CipherID, key, h.EncryptionIV, append(h.StreamStartBytes, writeHashedBlocks(payload)...))
+		if e != nil {
+			return e
+		}
+		out.Write(encrypted)
+	} else {
+		payload, e := compress(h.Compression, append(db.innerHeader(streamKey), content.bytes()...))
+		if e != nil {
+			return e
+		}
+
+		encrypted, e := encryptPayload(h.CipherID, key, h.EncryptionIV, payload)
+		if e != nil {
+			return e
+		}
+
+		macKey := hmacKey(h.MasterSeed, transformed)
+		sum := sha256.Sum256(raw)
+		out.Write(sum[:])
+		out.Write(headerMAC(macKey, raw))
+		out.Write(writeHMACBlocks(encrypted, macKey))
+	}
+
+	_, e = w.Write(out.Bytes())
+	return e
+}
+
+func (db *Database) innerHeader(streamKey []byte) []byte {
+	var b bytes.Buffer
+	field := func(id byte, value []byte) {
+		b.WriteByte(id)
+		binary.Write(&b, binary.LittleEndian, uint32(len(value)))
+		b.Write(value)
+	}
+
+	field(innerRandomStreamID, le32(db.InnerRandomStreamID))
+	field(innerRandomStreamKey, streamKey)
+	for _, bin := range db.Binaries {
+		flags := byte(0)
+		if bin.Protected {
+			flags = innerBinaryProtected
+		}
+		field(innerBinary, append([]byte{flags}, bin.Data...))
+	}
+	field(innerEndOfHeader, nil)
+
+	return b.Bytes()
+}
+
+// Puts the attachments back into Meta/Binaries and records the hash of the header, as KDBX 3 expects.
+func (db *Database) insertBinaries(content *Node, header []byte) {
+	meta := content.Ensure("Meta")
+
+	sum := sha256.Sum256(header)
+	meta.Ensure("HeaderHash").Text = base64.StdEncoding.EncodeToString(sum[:])
+
+	if len(db.Binaries) == 0 {
+		return
+	}
+
+	binaries := &Node{Name: "Binaries"}
+	for i, bin := range db.Binaries {
+		n := &Node{Name: "Binary"}
+		n.SetAttr("ID", strconv.Itoa(i))
+		if bin.Protected {
+			n.SetAttr("Protected", "True")
+			n.Text = string(bin.Data)
+		} else {
+			data, _ := compress(CompressionGzip, bin.Data)
+			n.SetAttr("Compressed", "True")
+			n.Text = base64.StdEncoding.EncodeToString(data)
+		}
+		binaries.Children = append(binaries.Children, n)
+	}
+	meta.Children = append(meta.Children, binaries)
+}
+
+// Decrypts the protected values of the payload in document order.
+func unprotect(content *Node, stream innerStream) (e error) {
+	content.Walk(func(n *Node) {
+		if e != nil || !n.Protected() {
+			return
+		}
+
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(n.Text))
+		if err != nil {
+			e = fmt.Errorf("protected value is not base64: %w", err)
+			return
+		}
+
+		stream.XORKeyStream(data, data)
+		n.Text = string(data)
+	})
+
+	return e
+}
+
+// Encrypts the protected values of the payload in document order.
+func protect(content *Node, stream innerStream) {
+	content.Walk(func(n *Node) {
+		if n.Protected() {
+			data := []byte(n.Text)
+			stream.XORKeyStream(data, data)
+			n.Text = base64.StdEncoding.EncodeToString(data)
+		}
+	})
+}
+
+func decompress(compression uint32, data []byte) ([]byte, error) {
+	if compression == CompressionNone {
+		return data, nil
+	}
+
+	r, e := gzip.NewReader(bytes.NewReader(data))
+	if e != nil {
+		return nil, e
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+func compress(compression uint32, data []byte) ([]byte, error) {
+	if compression == CompressionNone {
+		return data, nil
+	}
+
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, e := w.Write(data); e != nil {
+		return nil, e
+	}
+
+	if e := w.Close(); e != nil {
+		return nil, e
+	}
+
+	return b.Bytes(), nil
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, e := rand.Read(b); e != nil {
+		panic(e)
+	}
+
+	return b
+}
+
+// Returns a random UUID in the base64 encoding of the payload.
+func NewUUID() string {
+	return base64.StdEncoding.EncodeToString(randomBytes(16))
+}
+
+// Builds an empty KDBX 4 database with the defaults of KeePassXC: AES-256, Argon2d
+// and a root group with the given name.
+func New(name string) *Database {
+	params := &VariantMap{Version: variantMapVersion}
+	params.Set(kdfUUID, VariantBytes, KdfArgon2d[:])
+	params.Set(kdfSeed, VariantBytes, randomBytes(32))
+	params.Set(kdfParallelism, VariantUint32, le32(2))
+	params.Set(kdfMemory, VariantUint64, le64(64*1024*1024))
+	params.Set(kdfIterations, VariantUint64, le64(10))
+	params.Set(kdfVersion, VariantUint32, le32(argon2Version))
+
+	now := FormatTime(time.Now(), 4)
+	text := func(name, text string) *Node { return &Node{Name: name, Text: text} }
+	times := &Node{Name: "Times", Children: []*Node{
+		text("CreationTime", now), text("LastModificationTime", now), text("LastAccessTime", now),
+		text("ExpiryTime", now), text("Expires", "False"), text("UsageCount", "0"), text("LocationChanged", now),
+	}}
+
+	return &Database{
+		Header: &Header{
+			MajorVersion:  4,
+			CipherID:      CipherAES256,
+			Compression:   CompressionGzip,
+			MasterSeed:    randomBytes(32),
+			EncryptionIV:  randomBytes(16),
+			KdfParameters: params,
+		},
+		InnerRandomStreamID: StreamChaCha20,
+		Content: &Node{Name: "KeePassFile", Children: []*Node{
+			{Name: "Meta", Children: []*Node{
+				text("Generator", "keepassxcync"),
+				text("DatabaseName", name), text("DatabaseNameChanged", now),
+				text("SettingsChanged", now),
+				text("HistoryMaxItems", "10"), text("HistoryMaxSize", "6291456"),
+			}},
+			{Name: "Root", Children: []*Node{
+				{Name: "Group", Children: []*Node{
+					text("UUID", NewUUID()), text("Name", name), times,
+					text("IsExpanded", "True"),
+				}},
+				{Name: "DeletedObjects"},
+			}},
+		}},
+	}
+}
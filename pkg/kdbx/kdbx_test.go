@@ -0,0 +1,249 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Builds a database that is cheap to open, in the given KDBX version and with the given cipher.
+func newTestDatabase(major uint16, id UUID) *Database {
+	db := New("personal")
+	db.Header.CipherID = id
+	db.Header.KdfParameters.Set(kdfMemory, VariantUint64, le64(1024*1024))
+	db.Header.KdfParameters.Set(kdfIterations, VariantUint64, le64(1))
+
+	if major < 4 {
+		db.Header.MajorVersion, db.Header.MinorVersion = 3, 1
+		db.Header.TransformRounds = 1000
+		db.Header.KdfParameters = nil
+		db.InnerRandomStreamID = StreamSalsa20
+	}
+
+	return db
+}
+
+// Adds an entry with a protected password and an attachment to the root group of db.
+func addTestEntry(db *Database, title, password string, attachment []byte) *Node {
+	now := FormatTime(time.Now(), db.Header.MajorVersion)
+	entry := &Node{Name: "Entry", Children: []*Node{
+		{Name: "UUID", Text: NewUUID()},
+		{Name: "Times", Children: []*Node{{Name: "LastModificationTime", Text: now}}},
+		{Name: "String", Children: []*Node{{Name: "Key", Text: "Title"}, {Name: "Value", Text: title}}},
+		{Name: "String", Children: []*Node{{Name: "Key", Text: "Password"}, {Name: "Value", Text: password}}},
+		{Name: "Binary", Children: []*Node{{Name: "Key", Text: "attachment.txt"}, {Name: "Value"}}},
+	}}
+	entry.Children[3].Children[1].SetAttr("Protected", "True")
+	entry.Children[4].Children[1].SetAttr("Ref", strconv.Itoa(len(db.Binaries)))
+	db.Binaries = append(db.Binaries, Binary{Data: attachment})
+
+	root := db.Content.Find("Root", "Group")
+	root.Children = append(root.Children, entry)
+	return entry
+}
+
+func TestDatabaseRoundTrip(t *testing.T) {
+	creds, e := NewCredentials("correct horse battery staple", nil)
+	if e != nil {
+		t.Fatalf("NewCredentials() error = %v", e)
+	}
+
+	tests := []struct {
+		name   string
+		major  uint16
+		cipher UUID
+	}{
+		{
+			name:   "1",
+			major:  4,
+			cipher: CipherAES256,
+		},
+		{
+			name:   "2",
+			major:  4,
+			cipher: CipherChaCha20,
+		},
+		{
+			name:   "3",
+			major:  4,
+			cipher: CipherTwofish,
+		},
+		{
+			name:   "4",
+			major:  3,
+			cipher: CipherAES256,
+		},
+		{
+			name:   "5",
+			major:  3,
+			cipher: CipherTwofish,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDatabase(tt.major, tt.cipher)
+			addTestEntry(db, "mail", "hunter2", []byte("first attachment"))
+			addTestEntry(db, "bank", "s3cr3t & <stuff>", []byte("second attachment"))
+
+			var b bytes.Buffer
+			if e := db.Write(&b, creds); e != nil {
+				t.Fatalf("Write() error = %v", e)
+			}
+
+			if bytes.Contains(b.Bytes(), []byte("hunter2")) {
+				t.Fatalf("Write() stored a password in plain text")
+			}
+
+			got, e := Open(bytes.NewReader(b.Bytes()), creds)
+			if e != nil {
+				t.Fatalf("Open() error = %v", e)
+			}
+
+			if got.Header.MajorVersion != tt.major || got.Header.CipherID != tt.cipher {
+				t.Errorf("Open() header = %d %s, want %d %s", got.Header.MajorVersion, got.Header.CipherID, tt.major, tt.cipher)
+			}
+
+			entries := got.Content.Find("Root", "Group").ChildrenNamed("Entry")
+			if len(entries) != 2 {
+				t.Fatalf("Open() returned %d entries, want 2", len(entries))
+			}
+
+			for i, want := range []string{"hunter2", "s3cr3t & <stuff>"} {
+				password := entries[i].ChildrenNamed("String")[1].Child("Value")
+				if password.Text != want || !password.Protected() {
+					t.Errorf("entry %d password = %q, want protected %q", i, password.Text, want)
+				}
+
+				ref, _ := strconv.Atoi(entries[i].Find("Binary", "Value").Attr("Ref"))
+				if want := []string{"first attachment", "second attachment"}[i]; ref >= len(got.Binaries) || string(got.Binaries[ref].Data) != want {
+					t.Errorf("entry %d attachment is not %q", i, want)
+				}
+			}
+
+			if got.Content.Find("Meta", "Binaries") != nil {
+				t.Errorf("Open() left the binaries in the payload")
+			}
+		})
+	}
+}
+
+func TestOpenInvalidCredentials(t *testing.T) {
+	for _, major := range []uint16{3, 4} {
+		creds, _ := NewCredentials("password", nil)
+		db := newTestDatabase(major, CipherAES256)
+
+		var b bytes.Buffer
+		if e := db.Write(&b, creds); e != nil {
+			t.Fatalf("Write() error = %v", e)
+		}
+
+		wrong, _ := NewCredentials("passw0rd", nil)
+		if _, e := Open(bytes.NewReader(b.Bytes()), wrong); !errors.Is(e, ErrInvalidCredentials) {
+			t.Errorf("Open() error = %v, want %v", e, ErrInvalidCredentials)
+		}
+	}
+
+	if _, e := Open(bytes.NewReader([]byte("not a database at all")), nil); !errors.Is(e, ErrNotKDBX) {
+		t.Errorf("Open() error = %v, want %v", e, ErrNotKDBX)
+	}
+}
+
+func TestKeyFileKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xAB}, 32)
+
+	tests := []struct {
+		name    string
+		data    string
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "1",
+			data: string(raw),
+			want: raw,
+		},
+		{
+			name: "2",
+			data: "abababababababababababababababababababababababababababababababab",
+			want: raw,
+		},
+		{
+			name: "3",
+			data: `<?xml version="1.0" encoding="utf-8"?>
+<KeyFile><Meta><Version>1.0</Version></Meta><Key><Data>q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s=</Data></Key></KeyFile>`,
+			want: raw,
+		},
+		{
+			name: "4",
+			data: `<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta><Version>2.0</Version></Meta>
+	<Key>
+		<Data Hash="9a2db2e2">
+			ABABABAB ABABABAB ABABABAB ABABABAB
+			ABABABAB ABABABAB ABABABAB ABABABAB
+		</Data>
+	</Key>
+</KeyFile>`,
+			want: raw,
+		},
+		{
+			name: "5",
+			data: `<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta><Version>2.0</Version></Meta>
+	<Key>
+		<Data Hash="bd48ee8c">
+			ABABABAB ABABABAB ABABABAB ABABABAB
+			ABABABAB ABABABAB ABABABAB ABABABAB
+		</Data>
+	</Key>
+</KeyFile>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := keyFileKey([]byte(tt.data))
+			if (e != nil) != tt.wantErr {
+				t.Fatalf("keyFileKey() error = %v, wantErr %v", e, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Errorf("keyFileKey() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2023, 10, 1, 12, 30, 0, 0, time.UTC)
+	for _, major := range []uint16{3, 4} {
+		if got, ok := ParseTime(FormatTime(want, major)); !ok || !got.Equal(want) {
+			t.Errorf("ParseTime(FormatTime(%d)) = %v, %v, want %v", major, got, ok, want)
+		}
+	}
+
+	if _, ok := ParseTime("yesterday"); ok {
+		t.Errorf("ParseTime() accepted an invalid time")
+	}
+}
@@ -0,0 +1,193 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"crypto/aes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Key derivation functions of KDBX 4.
+var (
+	KdfAES      = mustUUID("c9d9f39a628a4460bf740d08c18a4fea")
+	KdfArgon2d  = mustUUID("ef636ddf8c29444b91f7a9a403e30a0c")
+	KdfArgon2id = mustUUID("9e298b1956db4773b23dfc3ec6f0a1e6")
+)
+
+// Keys of the KDF parameters.
+const (
+	kdfUUID        = "$UUID"
+	kdfRounds      = "R"
+	kdfSeed        = "S"
+	kdfParallelism = "P"
+	kdfMemory      = "M"
+	kdfIterations  = "I"
+	kdfVersion     = "V"
+	kdfSecret      = "K"
+	kdfData        = "A"
+)
+
+// Returns the name of a KDF, or its UUID if it is unknown.
+func KDFName(id UUID) string {
+	switch id {
+	case KdfAES:
+		return "AES-KDF"
+	case KdfArgon2d:
+		return "Argon2d"
+	case KdfArgon2id:
+		return "Argon2id"
+	default:
+		return id.String()
+	}
+}
+
+// Key derivation function that turns the credentials into the key of a database, with its costs.
+type KDF struct {
+	ID   UUID
+	Salt []byte
+	// Rounds of AES-KDF.
+	Rounds uint64
+	// Costs of Argon2, with the memory given in bytes.
+	Memory      uint64
+	Iterations  uint64
+	Parallelism uint32
+	Version     uint32
+	// Optional secret key and associated data of Argon2.
+	Secret []byte
+	Data   []byte
+}
+
+// Returns the KDF of the database. Formats before KDBX 4 always use AES-KDF,
+// with its parameters spread over the header.
+func (h *Header) KDF() (*KDF, error) {
+	if h.MajorVersion < 4 {
+		return &KDF{ID: KdfAES, Salt: h.TransformSeed, Rounds: h.TransformRounds}, nil
+	}
+
+	params := h.KdfParameters
+	id, ok := params.Bytes(kdfUUID)
+	if !ok || len(id) != 16 {
+		return nil, errors.New("KDF parameters lack the KDF")
+	}
+
+	k := &KDF{ID: UUID(id)}
+	if k.Salt, ok = params.Bytes(kdfSeed); !ok {
+		return nil, errors.New("KDF parameters lack the seed")
+	}
+
+	switch k.ID {
+	case KdfAES:
+		if k.Rounds, ok = params.Uint64(kdfRounds); !ok {
+			return nil, errors.New("KDF parameters lack the rounds")
+		}
+	case KdfArgon2d, KdfArgon2id:
+		var ok1, ok2, ok3 bool
+		k.Iterations, ok1 = params.Uint64(kdfIterations)
+		k.Memory, ok2 = params.Uint64(kdfMemory)
+		k.Parallelism, ok3 = params.Uint32(kdfParallelism)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, errors.New("KDF parameters lack the Argon2 costs")
+		}
+
+		if k.Version, ok = params.Uint32(kdfVersion); !ok {
+			k.Version = argon2Version
+		}
+
+		k.Secret, _ = params.Bytes(kdfSecret)
+		k.Data, _ = params.Bytes(kdfData)
+	default:
+		return nil, fmt.Errorf("unsupported KDF %s", k.ID)
+	}
+
+	return k, nil
+}
+
+// Returns the name of the KDF.
+func (k *KDF) Name() string {
+	return KDFName(k.ID)
+}
+
+// Derives the transformed key from the composite key with the KDF of the header.
+func (h *Header) transformKey(composite []byte) ([]byte, error) {
+	k, e := h.KDF()
+	if e != nil {
+		return nil, e
+	}
+
+	if k.ID == KdfAES {
+		return aesKdf(composite, k.Salt, k.Rounds)
+	}
+
+	if k.Version != argon2Version {
+		return nil, fmt.Errorf("unsupported Argon2 version %#x", k.Version)
+	}
+
+	if k.Iterations < 1 || k.Iterations > math.MaxUint32 || k.Memory/1024 > math.MaxUint32 || k.Parallelism < 1 || k.Parallelism > math.MaxUint8 {
+		return nil, errors.New("Argon2 costs are out of range")
+	}
+
+	mode := argon2d
+	if k.ID == KdfArgon2id {
+		mode = argon2id
+	}
+
+	return argon2Key(mode, composite, k.Salt, k.Secret, k.Data, uint32(k.Iterations), uint32(k.Memory/1024), uint8(k.Parallelism), 32), nil
+}
+
+// Encrypts the key rounds times with AES-256 in ECB mode, keyed by seed, and hashes the result.
+func aesKdf(composite, seed []byte, rounds uint64) ([]byte, error) {
+	if len(seed) != 32 {
+		return nil, errors.New("AES-KDF seed must be 32 bytes")
+	}
+
+	block, e := aes.NewCipher(seed)
+	if e != nil {
+		return nil, e
+	}
+
+	key := append([]byte(nil), composite...)
+	for i := uint64(0); i < rounds; i++ {
+		block.Encrypt(key[:16], key[:16])
+		block.Encrypt(key[16:], key[16:])
+	}
+
+	sum := sha256.Sum256(key)
+	return sum[:], nil
+}
+
+// Returns the key of the payload cipher.
+func cipherKey(masterSeed, transformed []byte) []byte {
+	h := sha256.New()
+	h.Write(masterSeed)
+	h.Write(transformed)
+	return h.Sum(nil)
+}
+
+// Returns the key that the HMACs of KDBX 4 are derived from.
+func hmacKey(masterSeed, transformed []byte) []byte {
+	h := sha512.New()
+	h.Write(masterSeed)
+	h.Write(transformed)
+	h.Write([]byte{1})
+	return h.Sum(nil)
+}
@@ -0,0 +1,160 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// Size of the smallest possible KDBX 3 payload, which is the stream start bytes
+// followed by the final block of the hashed block stream.
+const minPayloadV3 = 32 + 40
+
+// Checks that r holds a complete KDBX database without decrypting it, to catch files that were
+// only partly written or damaged before they are uploaded. The signature and the header must
+// parse, the header of KDBX 4 must match its hash, and the payload must have a plausible length.
+// With credentials the key is checked as well, against the header HMAC and the first block of
+// the payload for KDBX 4, and against the stream start bytes for KDBX 3.
+func Validate(r io.Reader, creds *Credentials) error {
+	data, e := io.ReadAll(r)
+	if e != nil {
+		return e
+	}
+
+	h, e := ParseHeader(bytes.NewReader(data))
+	if e != nil {
+		return e
+	}
+
+	if h.Legacy != nil {
+		return ErrLegacyKDB
+	}
+
+	payload := data[h.Size():]
+	if h.MajorVersion >= 4 {
+		if e := h.VerifyHash(); e != nil {
+			return e
+		}
+
+		payload = payload[64:]
+		if e := checkHMACBlocks(payload); e != nil {
+			return e
+		}
+	} else {
+		if len(payload) < minPayloadV3 {
+			return errors.New("payload is truncated")
+		}
+
+		if h.CipherID != CipherChaCha20 && len(payload)%16 != 0 {
+			return errors.New("payload is truncated, it does not end on a cipher block")
+		}
+	}
+
+	if creds == nil {
+		return nil
+	}
+
+	transformed, e := h.transformKey(creds.compositeKey())
+	if e != nil {
+		return e
+	}
+
+	if h.MajorVersion >= 4 {
+		macKey := hmacKey(h.MasterSeed, transformed)
+		if !hmac.Equal(h.HMAC, headerMAC(macKey, h.raw)) {
+			return ErrInvalidCredentials
+		}
+
+		size := binary.LittleEndian.Uint32(payload[32:])
+		if !hmac.Equal(payload[:32], blockMAC(macKey, 0, payload[36:36+size])) {
+			return errCorruptBlock
+		}
+
+		return nil
+	}
+
+	start, e := decryptPrefix(h.CipherID, cipherKey(h.MasterSeed, transformed), h.EncryptionIV, payload[:32])
+	if e != nil {
+		return e
+	}
+
+	if !bytes.Equal(start, h.StreamStartBytes) {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
+
+// Walks the HMAC block stream of KDBX 4 without checking the HMACs, to make sure that
+// it ends with the final empty block at the end of the file.
+func checkHMACBlocks(data []byte) error {
+	for {
+		if len(data) < 36 {
+			return errors.New("payload is truncated")
+		}
+
+		size := binary.LittleEndian.Uint32(data[32:])
+		data = data[36:]
+
+		if size == 0 {
+			if len(data) > 0 {
+				return errors.New("payload is followed by unexpected data")
+			}
+			return nil
+		}
+
+		if uint64(len(data)) < uint64(size) {
+			return errors.New("payload is truncated")
+		}
+		data = data[size:]
+	}
+}
+
+// Decrypts the first bytes of the payload, which must be a whole number of cipher blocks.
+func decryptPrefix(id UUID, key, iv, data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	if id == CipherChaCha20 {
+		c, e := chacha20.NewUnauthenticatedCipher(key, iv)
+		if e != nil {
+			return nil, e
+		}
+
+		c.XORKeyStream(out, data)
+		return out, nil
+	}
+
+	block, e := newBlockCipher(id, key)
+	if e != nil {
+		return nil, e
+	}
+
+	if len(iv) != block.BlockSize() {
+		return nil, errors.New("encryption IV does not match the cipher")
+	}
+
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+	return out, nil
+}
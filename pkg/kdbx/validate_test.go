@@ -0,0 +1,124 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	creds, _ := NewCredentials("password", nil)
+	wrong, _ := NewCredentials("passw0rd", nil)
+
+	v4 := newTestDatabase(4, CipherAES256)
+	addTestEntry(v4, "mail", "hunter2", []byte("attachment"))
+	v4data := encodeTestDatabase(t, v4)
+	v3data := encodeTestDatabase(t, newTestDatabase(3, CipherAES256))
+	h, _ := ParseHeader(bytes.NewReader(v4data))
+
+	// Damage the first block of the payload, which only the HMAC reveals.
+	damaged := append([]byte(nil), v4data...)
+	damaged[h.Size()+64+36] ^= 0x01
+
+	tests := []struct {
+		name    string
+		data    []byte
+		creds   *Credentials
+		wantErr error
+	}{
+		{
+			name: "1",
+			data: v4data,
+		},
+		{
+			name:  "2",
+			data:  v4data,
+			creds: creds,
+		},
+		{
+			name: "3",
+			data: v3data,
+		},
+		{
+			name:  "4",
+			data:  v3data,
+			creds: creds,
+		},
+		{
+			name:    "5",
+			data:    v4data,
+			creds:   wrong,
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "6",
+			data:    v3data,
+			creds:   wrong,
+			wantErr: ErrInvalidCredentials,
+		},
+		{
+			name:    "7",
+			data:    v4data[:len(v4data)-1],
+			wantErr: errors.New("payload is truncated"),
+		},
+		{
+			name:    "8",
+			data:    v3data[:len(v3data)-8],
+			wantErr: errors.New("payload is truncated, it does not end on a cipher block"),
+		},
+		{
+			name:    "9",
+			data:    append(append([]byte(nil), v4data...), 0),
+			wantErr: errors.New("payload is followed by unexpected data"),
+		},
+		{
+			name:    "10",
+			data:    make([]byte, len(v4data)),
+			wantErr: ErrNotKDBX,
+		},
+		{
+			name:    "11",
+			data:    newTestLegacyHeader(2),
+			wantErr: ErrLegacyKDB,
+		},
+		{
+			name: "12",
+			data: damaged,
+		},
+		{
+			name:    "13",
+			data:    damaged,
+			creds:   creds,
+			wantErr: errCorruptBlock,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Validate(bytes.NewReader(tt.data), tt.creds)
+			switch {
+			case tt.wantErr == nil && e != nil:
+				t.Errorf("Validate() error = %v, want nil", e)
+			case tt.wantErr != nil && (e == nil || e.Error() != tt.wantErr.Error()):
+				t.Errorf("Validate() error = %v, want %v", e, tt.wantErr)
+			}
+		})
+	}
+}
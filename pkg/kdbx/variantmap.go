@@ -0,0 +1,169 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Types of the values of a VariantMap.
+const (
+	VariantUint32 byte = 0x04
+	VariantUint64 byte = 0x05
+	VariantBool   byte = 0x08
+	VariantInt32  byte = 0x0C
+	VariantInt64  byte = 0x0D
+	VariantString byte = 0x18
+	VariantBytes  byte = 0x42
+)
+
+const variantMapVersion uint16 = 0x0100
+
+// Single typed value of a VariantMap, with its value in the little endian encoding of the file.
+type Variant struct {
+	Key   string
+	Type  byte
+	Value []byte
+}
+
+// Dictionary that KDBX 4 uses for the KDF parameters and the public custom data of the header.
+// Items keep the order they were read in, so that writing a map back does not reorder it.
+type VariantMap struct {
+	Version uint16
+	Items   []Variant
+}
+
+func readVariantMap(data []byte) (*VariantMap, error) {
+	if len(data) < 2 {
+		return nil, errors.New("variant map is truncated")
+	}
+
+	m := &VariantMap{Version: binary.LittleEndian.Uint16(data)}
+	if m.Version>>8 > variantMapVersion>>8 {
+		return nil, fmt.Errorf("unsupported variant map version %#04x", m.Version)
+	}
+
+	data = data[2:]
+	for {
+		if len(data) < 1 {
+			return nil, errors.New("variant map is truncated")
+		}
+
+		typ := data[0]
+		if typ == 0 {
+			return m, nil
+		}
+
+		if len(data) < 5 {
+			return nil, errors.New("variant map is truncated")
+		}
+		n := binary.LittleEndian.Uint32(data[1:])
+		data = data[5:]
+		if uint64(len(data)) < uint64(n)+4 {
+			return nil, errors.New("variant map is truncated")
+		}
+		key := string(data[:n])
+		data = data[n:]
+
+		n = binary.LittleEndian.Uint32(data)
+		data = data[4:]
+		if uint64(len(data)) < uint64(n) {
+			return nil, errors.New("variant map is truncated")
+		}
+
+		m.Items = append(m.Items, Variant{Key: key, Type: typ, Value: append([]byte(nil), data[:n]...)})
+		data = data[n:]
+	}
+}
+
+func (m *VariantMap) bytes() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, m.Version)
+
+	for _, v := range m.Items {
+		b.WriteByte(v.Type)
+		binary.Write(&b, binary.LittleEndian, uint32(len(v.Key)))
+		b.WriteString(v.Key)
+		binary.Write(&b, binary.LittleEndian, uint32(len(v.Value)))
+		b.Write(v.Value)
+	}
+
+	b.WriteByte(0)
+	return b.Bytes()
+}
+
+// Returns the item with the given key, or nil if there is none.
+func (m *VariantMap) Get(key string) *Variant {
+	for i := range m.Items {
+		if m.Items[i].Key == key {
+			return &m.Items[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns the value of key if it holds a byte array.
+func (m *VariantMap) Bytes(key string) ([]byte, bool) {
+	if v := m.Get(key); v != nil && v.Type == VariantBytes {
+		return v.Value, true
+	}
+
+	return nil, false
+}
+
+// Returns the value of key if it holds an unsigned 32 bit integer.
+func (m *VariantMap) Uint32(key string) (uint32, bool) {
+	if v := m.Get(key); v != nil && v.Type == VariantUint32 && len(v.Value) == 4 {
+		return binary.LittleEndian.Uint32(v.Value), true
+	}
+
+	return 0, false
+}
+
+// Returns the value of key if it holds an unsigned 64 bit integer.
+func (m *VariantMap) Uint64(key string) (uint64, bool) {
+	if v := m.Get(key); v != nil && v.Type == VariantUint64 && len(v.Value) == 8 {
+		return binary.LittleEndian.Uint64(v.Value), true
+	}
+
+	return 0, false
+}
+
+// Sets key to a value of the given type, replacing the existing item in place.
+func (m *VariantMap) Set(key string, typ byte, value []byte) {
+	if v := m.Get(key); v != nil {
+		v.Type, v.Value = typ, value
+		return
+	}
+
+	m.Items = append(m.Items, Variant{Key: key, Type: typ, Value: value})
+}
+
+func (m *VariantMap) clone() *VariantMap {
+	c := &VariantMap{Version: m.Version}
+	for _, v := range m.Items {
+		c.Items = append(c.Items, Variant{Key: v.Key, Type: v.Type, Value: append([]byte(nil), v.Value...)})
+	}
+
+	return c
+}
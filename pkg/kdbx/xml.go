@@ -0,0 +1,288 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package kdbx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Element of the XML payload. The payload is kept as a generic tree rather than
+// being mapped onto structs, so that elements this package does not know about,
+// like those added by newer versions of KeePass, survive being read and written.
+// Elements hold either text or child elements, never both.
+type Node struct {
+	Name     string
+	Attrs    []xml.Attr
+	Children []*Node
+	Text     string
+}
+
+func parseXML(r io.Reader) (*Node, error) {
+	d := xml.NewDecoder(r)
+
+	var root *Node
+	var stack []*Node
+	for {
+		tok, e := d.Token()
+		if e == io.EOF {
+			break
+		} else if e != nil {
+			return nil, e
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &Node{Name: t.Name.Local}
+			for _, a := range t.Attr {
+				n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: a.Name.Local}, Value: a.Value})
+			}
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			n := stack[len(stack)-1]
+			if len(n.Children) > 0 {
+				n.Text = ""
+			}
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("payload holds no XML document")
+	}
+
+	return root, nil
+}
+
+func (n *Node) encode(w *bufio.Writer, depth int) {
+	w.WriteString(strings.Repeat("\t", depth))
+	w.WriteString("<" + n.Name)
+	for _, a := range n.Attrs {
+		w.WriteString(" " + a.Name.Local + "=\"")
+		xml.EscapeText(w, []byte(a.Value))
+		w.WriteString("\"")
+	}
+
+	switch {
+	case len(n.Children) > 0:
+		w.WriteString(">\n")
+		for _, c := range n.Children {
+			c.encode(w, depth+1)
+		}
+		w.WriteString(strings.Repeat("\t", depth))
+	case n.Text != "":
+		w.WriteString(">")
+		xml.EscapeText(w, []byte(n.Text))
+	default:
+		w.WriteString(" />\n")
+		return
+	}
+
+	w.WriteString("</" + n.Name + ">\n")
+}
+
+func (n *Node) bytes() []byte {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	w.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\" standalone=\"yes\"?>\n")
+	n.encode(w, 0)
+	w.Flush()
+	return b.Bytes()
+}
+
+// Returns the first child with the given name, or nil if there is none. Lookups on a nil
+// Node find nothing, so that lookups of optional elements can be chained.
+func (n *Node) Child(name string) *Node {
+	if n == nil {
+		return nil
+	}
+
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Returns the children with the given name.
+func (n *Node) ChildrenNamed(name string) []*Node {
+	if n == nil {
+		return nil
+	}
+
+	var children []*Node
+	for _, c := range n.Children {
+		if c.Name == name {
+			children = append(children, c)
+		}
+	}
+
+	return children
+}
+
+// Follows a path of child names, returning nil if any of them is missing.
+func (n *Node) Find(path ...string) *Node {
+	for _, name := range path {
+		if n = n.Child(name); n == nil {
+			return nil
+		}
+	}
+
+	return n
+}
+
+// Returns the text of the first child with the given name.
+func (n *Node) ChildText(name string) string {
+	if c := n.Child(name); c != nil {
+		return c.Text
+	}
+
+	return ""
+}
+
+// Returns the child with the given name, appending an empty one if there is none.
+func (n *Node) Ensure(name string) *Node {
+	if c := n.Child(name); c != nil {
+		return c
+	}
+
+	c := &Node{Name: name}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// Returns the value of the attribute with the given name.
+func (n *Node) Attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+
+	return ""
+}
+
+// Sets the attribute with the given name, replacing an existing one.
+func (n *Node) SetAttr(name, value string) {
+	for i := range n.Attrs {
+		if n.Attrs[i].Name.Local == name {
+			n.Attrs[i].Value = value
+			return
+		}
+	}
+
+	n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+}
+
+// Removes child from n, reporting whether it was a child of n.
+func (n *Node) Remove(child *Node) bool {
+	for i, c := range n.Children {
+		if c == child {
+			n.Children = append(n.Children[:i], n.Children[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns a deep copy of n.
+func (n *Node) Clone() *Node {
+	c := &Node{Name: n.Name, Text: n.Text, Attrs: append([]xml.Attr(nil), n.Attrs...)}
+	for _, child := range n.Children {
+		c.Children = append(c.Children, child.Clone())
+	}
+
+	return c
+}
+
+// Calls f for n and all of its descendants in document order.
+func (n *Node) Walk(f func(*Node)) {
+	f(n)
+	for _, c := range n.Children {
+		c.Walk(f)
+	}
+}
+
+// Reports whether the value of n is encrypted with the inner random stream in the file.
+func (n *Node) Protected() bool {
+	return strings.EqualFold(n.Attr("Protected"), "True")
+}
+
+// Seconds between 0001-01-01, which KDBX 4 counts times from, and the Unix epoch.
+const kdbxEpoch = 62135596800
+
+// Parses a time of the payload, which KDBX 3 stores as an ISO 8601 string and KDBX 4 as
+// the base64 encoded number of seconds since 0001-01-01.
+func ParseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	if t, e := time.Parse(time.RFC3339, s); e == nil {
+		return t.UTC(), true
+	}
+
+	if b, e := base64.StdEncoding.DecodeString(s); e == nil && len(b) == 8 {
+		secs := int64(binary.LittleEndian.Uint64(b))
+		return time.Unix(secs-kdbxEpoch, 0).UTC(), true
+	}
+
+	return time.Time{}, false
+}
+
+// Formats a time the way the given major version of KDBX stores it.
+func FormatTime(t time.Time, major uint16) string {
+	if major < 4 {
+		return t.UTC().Format("2006-01-02T15:04:05Z")
+	}
+
+	return base64.StdEncoding.EncodeToString(le64(uint64(t.Unix() + kdbxEpoch)))
+}
+
+// Reports whether elements with the given name hold a time.
+func isTimeElement(name string) bool {
+	switch name {
+	case "CreationTime", "LastModificationTime", "LastAccessTime", "ExpiryTime", "DeletionTime":
+		return true
+	}
+
+	return strings.HasSuffix(name, "Changed")
+}
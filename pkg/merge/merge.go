@@ -0,0 +1,509 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package merge merges two copies of a KeePass database entry by entry, the way the
+// "Merge from database" action of KeePassXC does.
+package merge
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/kdbx"
+)
+
+// Counts of the changes a merge made to the local database.
+type Stats struct {
+	Added   int
+	Updated int
+	Moved   int
+	Deleted int
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d added, %d updated, %d moved, %d deleted", s.Added, s.Updated, s.Moved, s.Deleted)
+}
+
+// Decrypts the local and the remote database with creds, merges the remote into the local
+// one and returns the local database encrypted again with its own settings.
+func Files(local, remote []byte, creds *kdbx.Credentials) ([]byte, Stats, error) {
+	l, e := kdbx.Open(bytes.NewReader(local), creds)
+	if e != nil {
+		return nil, Stats{}, fmt.Errorf("unable to open the local database: %w", e)
+	}
+
+	r, e := kdbx.Open(bytes.NewReader(remote), creds)
+	if e != nil {
+		return nil, Stats{}, fmt.Errorf("unable to open the remote database: %w", e)
+	}
+
+	stats, e := Merge(l, r)
+	if e != nil {
+		return nil, stats, e
+	}
+
+	var b bytes.Buffer
+	if e := l.Write(&b, creds); e != nil {
+		return nil, stats, e
+	}
+
+	return b.Bytes(), stats, nil
+}
+
+type item struct {
+	node   *kdbx.Node
+	parent *kdbx.Node
+}
+
+type merger struct {
+	local  *kdbx.Database
+	remote *kdbx.Database
+
+	// Groups and entries of the local database by UUID.
+	index map[string]item
+	// Deletions recorded by either database, by UUID.
+	deleted map[string]time.Time
+	// Index of remote attachments in the local database.
+	binaries map[int]int
+	stats    Stats
+}
+
+// Merges remote into local. Groups and entries are matched by UUID and the side that was modified
+// last wins, with the version it replaces kept in the history of the entry. Items that only exist
+// on one side are added, unless the other side deleted them after they were last modified.
+func Merge(local, remote *kdbx.Database) (Stats, error) {
+	lroot := local.Content.Find("Root", "Group")
+	rroot := remote.Content.Find("Root", "Group")
+	if lroot == nil || rroot == nil {
+		return Stats{}, errors.New("database has no root group")
+	}
+
+	if uuid(lroot) != uuid(rroot) {
+		return Stats{}, errors.New("databases do not share their root group, they are not copies of the same database")
+	}
+
+	m := &merger{
+		local:    local,
+		remote:   remote,
+		index:    map[string]item{},
+		deleted:  map[string]time.Time{},
+		binaries: map[int]int{},
+	}
+
+	m.indexGroup(lroot, nil)
+	m.readDeletions(local)
+	m.readDeletions(remote)
+
+	m.mergeGroup(rroot, lroot)
+	m.applyDeletions()
+	m.writeDeletions()
+	m.mergeMeta()
+
+	return m.stats, nil
+}
+
+func (m *merger) indexGroup(group, parent *kdbx.Node) {
+	m.index[uuid(group)] = item{node: group, parent: parent}
+	for _, c := range group.Children {
+		switch c.Name {
+		case "Entry":
+			m.index[uuid(c)] = item{node: c, parent: group}
+		case "Group":
+			m.indexGroup(c, group)
+		}
+	}
+}
+
+// Merges the remote group r into its local counterpart l, along with everything below it.
+func (m *merger) mergeGroup(r, l *kdbx.Node) {
+	if modified(r).After(modified(l)) {
+		copyProperties(l, r)
+		m.stats.Updated++
+	}
+
+	for _, c := range r.Children {
+		switch c.Name {
+		case "Entry":
+			m.mergeEntry(c, l)
+		case "Group":
+			it, ok := m.index[uuid(c)]
+			if !ok {
+				if m.isDeleted(c) {
+					continue
+				}
+
+				g := &kdbx.Node{Name: "Group"}
+				copyProperties(g, c)
+				l.Children = append(l.Children, g)
+				m.index[uuid(c)] = item{node: g, parent: l}
+				m.stats.Added++
+				m.mergeGroup(c, g)
+				continue
+			}
+
+			m.relocate(it, c, l)
+			m.mergeGroup(c, it.node)
+		}
+	}
+}
+
+// Merges the remote entry r, whose parent has the local counterpart parent.
+func (m *merger) mergeEntry(r, parent *kdbx.Node) {
+	it, ok := m.index[uuid(r)]
+	if !ok {
+		if m.isDeleted(r) {
+			return
+		}
+
+		e := m.imported(r)
+		insertEntry(parent, e)
+		m.index[uuid(r)] = item{node: e, parent: parent}
+		m.stats.Added++
+		return
+	}
+
+	it = m.relocate(it, r, parent)
+	l := it.node
+
+	e := m.imported(r)
+	history := append(l.Child("History").ChildrenNamed("Entry"), e.Child("History").ChildrenNamed("Entry")...)
+	switch lt, rt := modified(l), modified(r); {
+	case rt.After(lt):
+		replaceChild(it.parent, l, e)
+		m.index[uuid(r)] = item{node: e, parent: it.parent}
+		m.setHistory(e, append(history, withoutHistory(l)))
+		m.stats.Updated++
+	case lt.After(rt):
+		m.setHistory(l, append(history, withoutHistory(e)))
+	default:
+		m.setHistory(l, history)
+	}
+}
+
+// Moves a local group or entry under the local counterpart of its remote parent,
+// if the remote side moved it last.
+func (m *merger) relocate(it item, r, parent *kdbx.Node) item {
+	if it.parent == nil || it.parent == parent || !locationChanged(r).After(locationChanged(it.node)) {
+		return it
+	}
+
+	// A group cannot be moved below itself, which would detach it from the tree.
+	inside := false
+	it.node.Walk(func(n *kdbx.Node) { inside = inside || n == parent })
+	if inside {
+		return it
+	}
+
+	it.parent.Remove(it.node)
+	if it.node.Name == "Entry" {
+		insertEntry(parent, it.node)
+	} else {
+		parent.Children = append(parent.Children, it.node)
+	}
+
+	if changed := r.Child("Times").Child("LocationChanged"); changed != nil {
+		it.node.Ensure("Times").Ensure("LocationChanged").Text = changed.Text
+	}
+
+	it.parent = parent
+	m.index[uuid(it.node)] = it
+	m.stats.Moved++
+	return it
+}
+
+// Sets the history of entry to the given versions, dropping duplicates and the current version,
+// sorted from oldest to newest and limited to the history size of the local database.
+func (m *merger) setHistory(entry *kdbx.Node, versions []*kdbx.Node) {
+	current := modified(entry)
+	seen := map[int64]bool{}
+
+	var history []*kdbx.Node
+	for _, v := range versions {
+		t := modified(v)
+		if t.Equal(current) || seen[t.Unix()] {
+			continue
+		}
+
+		seen[t.Unix()] = true
+		history = append(history, v)
+	}
+
+	sort.SliceStable(history, func(i, j int) bool {
+		return modified(history[i]).Before(modified(history[j]))
+	})
+
+	if max, e := strconv.Atoi(m.local.Content.Child("Meta").ChildText("HistoryMaxItems")); e == nil && max >= 0 && len(history) > max {
+		history = history[len(history)-max:]
+	}
+
+	h := entry.Child("History")
+	if len(history) == 0 {
+		if h != nil {
+			entry.Remove(h)
+		}
+		return
+	}
+
+	if h == nil {
+		h = &kdbx.Node{Name: "History"}
+		entry.Children = append(entry.Children, h)
+	}
+	h.Children = history
+}
+
+// Returns a copy of a remote node whose attachment references point into the local database.
+func (m *merger) imported(r *kdbx.Node) *kdbx.Node {
+	n := r.Clone()
+	n.Walk(func(v *kdbx.Node) {
+		ref := v.Attr("Ref")
+		if v.Name != "Value" || ref == "" {
+			return
+		}
+
+		i, e := strconv.Atoi(ref)
+		if e != nil || i < 0 || i >= len(m.remote.Binaries) {
+			return
+		}
+
+		if _, ok := m.binaries[i]; !ok {
+			m.binaries[i] = m.importBinary(m.remote.Binaries[i])
+		}
+		v.SetAttr("Ref", strconv.Itoa(m.binaries[i]))
+	})
+
+	return n
+}
+
+func (m *merger) importBinary(b kdbx.Binary) int {
+	for i, l := range m.local.Binaries {
+		if bytes.Equal(l.Data, b.Data) {
+			return i
+		}
+	}
+
+	m.local.Binaries = append(m.local.Binaries, kdbx.Binary{Protected: b.Protected, Data: append([]byte(nil), b.Data...)})
+	return len(m.local.Binaries) - 1
+}
+
+func (m *merger) readDeletions(db *kdbx.Database) {
+	deleted := db.Content.Find("Root", "DeletedObjects")
+	if deleted == nil {
+		return
+	}
+
+	for _, d := range deleted.ChildrenNamed("DeletedObject") {
+		t, ok := kdbx.ParseTime(d.ChildText("DeletionTime"))
+		if !ok {
+			continue
+		}
+
+		if id := uuid(d); t.After(m.deleted[id]) {
+			m.deleted[id] = t
+		}
+	}
+}
+
+// Reports whether a remote item was deleted locally after it was last modified.
+func (m *merger) isDeleted(n *kdbx.Node) bool {
+	t, ok := m.deleted[uuid(n)]
+	return ok && !modified(n).After(t)
+}
+
+// Removes local entries and groups that were deleted on either side after they were last
+// modified. Groups that still hold anything are kept, so nothing is removed implicitly.
+func (m *merger) applyDeletions() {
+	var groups []item
+	for id, t := range m.deleted {
+		it, ok := m.index[id]
+		if !ok || it.parent == nil || modified(it.node).After(t) {
+			continue
+		}
+
+		if it.node.Name == "Group" {
+			groups = append(groups, it)
+			continue
+		}
+
+		it.parent.Remove(it.node)
+		delete(m.index, id)
+		m.stats.Deleted++
+	}
+
+	// Remove the deepest groups first, so that their parents may become empty in turn.
+	sort.Slice(groups, func(i, j int) bool { return m.depth(groups[i]) > m.depth(groups[j]) })
+	for _, it := range groups {
+		if it.node.Child("Entry") != nil || it.node.Child("Group") != nil {
+			continue
+		}
+
+		it.parent.Remove(it.node)
+		delete(m.index, uuid(it.node))
+		m.stats.Deleted++
+	}
+}
+
+func (m *merger) depth(it item) int {
+	d := 0
+	for it.parent != nil {
+		it = m.index[uuid(it.parent)]
+		d++
+	}
+
+	return d
+}
+
+// Replaces the deleted objects of the local database with those of both databases.
+func (m *merger) writeDeletions() {
+	ids := make([]string, 0, len(m.deleted))
+	for id := range m.deleted {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if !m.deleted[ids[i]].Equal(m.deleted[ids[j]]) {
+			return m.deleted[ids[i]].Before(m.deleted[ids[j]])
+		}
+		return ids[i] < ids[j]
+	})
+
+	deleted := m.local.Content.Child("Root").Ensure("DeletedObjects")
+	deleted.Children = nil
+	for _, id := range ids {
+		deleted.Children = append(deleted.Children, &kdbx.Node{Name: "DeletedObject", Children: []*kdbx.Node{
+			{Name: "UUID", Text: id},
+			{Name: "DeletionTime", Text: kdbx.FormatTime(m.deleted[id], m.local.Header.MajorVersion)},
+		}})
+	}
+}
+
+// Settings of the database that are merged, each with the element that records when they changed.
+var metaFields = []struct {
+	changed string
+	fields  []string
+}{
+	{changed: "DatabaseNameChanged", fields: []string{"DatabaseName"}},
+	{changed: "DatabaseDescriptionChanged", fields: []string{"DatabaseDescription"}},
+	{changed: "DefaultUserNameChanged", fields: []string{"DefaultUserName"}},
+	{changed: "RecycleBinChanged", fields: []string{"RecycleBinEnabled", "RecycleBinUUID"}},
+	{changed: "EntryTemplatesGroupChanged", fields: []string{"EntryTemplatesGroup"}},
+}
+
+// Takes the settings that the remote changed last, and adds the custom icons of the remote.
+func (m *merger) mergeMeta() {
+	l, r := m.local.Content.Child("Meta"), m.remote.Content.Child("Meta")
+	if l == nil || r == nil {
+		return
+	}
+
+	for _, f := range metaFields {
+		rt, ok := kdbx.ParseTime(r.ChildText(f.changed))
+		if lt, _ := kdbx.ParseTime(l.ChildText(f.changed)); !ok || !rt.After(lt) {
+			continue
+		}
+
+		for _, name := range append(f.fields, f.changed) {
+			if c := r.Child(name); c != nil {
+				l.Ensure(name).Text = c.Text
+			}
+		}
+	}
+
+	icons := r.Child("CustomIcons")
+	if icons == nil {
+		return
+	}
+
+	known := map[string]bool{}
+	local := l.Ensure("CustomIcons")
+	for _, icon := range local.ChildrenNamed("Icon") {
+		known[uuid(icon)] = true
+	}
+
+	for _, icon := range icons.ChildrenNamed("Icon") {
+		if !known[uuid(icon)] {
+			local.Children = append(local.Children, icon.Clone())
+		}
+	}
+}
+
+// Replaces the properties of a group, which are all of its children but its entries and groups.
+func copyProperties(dst, src *kdbx.Node) {
+	var children []*kdbx.Node
+	for _, c := range src.Children {
+		if c.Name != "Entry" && c.Name != "Group" {
+			children = append(children, c.Clone())
+		}
+	}
+
+	for _, c := range dst.Children {
+		if c.Name == "Entry" || c.Name == "Group" {
+			children = append(children, c)
+		}
+	}
+
+	dst.Children = children
+}
+
+// Adds an entry to a group after its other entries, as KeePass lists entries before subgroups.
+func insertEntry(group, entry *kdbx.Node) {
+	for i, c := range group.Children {
+		if c.Name == "Group" {
+			group.Children = append(group.Children[:i], append([]*kdbx.Node{entry}, group.Children[i:]...)...)
+			return
+		}
+	}
+
+	group.Children = append(group.Children, entry)
+}
+
+func replaceChild(parent, old, n *kdbx.Node) {
+	for i, c := range parent.Children {
+		if c == old {
+			parent.Children[i] = n
+			return
+		}
+	}
+}
+
+func withoutHistory(entry *kdbx.Node) *kdbx.Node {
+	n := entry.Clone()
+	if h := n.Child("History"); h != nil {
+		n.Remove(h)
+	}
+
+	return n
+}
+
+func uuid(n *kdbx.Node) string {
+	return strings.TrimSpace(n.ChildText("UUID"))
+}
+
+func modified(n *kdbx.Node) time.Time {
+	t, _ := kdbx.ParseTime(n.Child("Times").ChildText("LastModificationTime"))
+	return t
+}
+
+func locationChanged(n *kdbx.Node) time.Time {
+	t, _ := kdbx.ParseTime(n.Child("Times").ChildText("LocationChanged"))
+	return t
+}
@@ -0,0 +1,437 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package merge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/kdbx"
+)
+
+var base = time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// Returns the time of the nth change after base, in the format of KDBX 4.
+func at(n int) string {
+	return kdbx.FormatTime(base.Add(time.Duration(n)*time.Minute), 4)
+}
+
+func newTestEntry(id, title string, modified int) *kdbx.Node {
+	return &kdbx.Node{Name: "Entry", Children: []*kdbx.Node{
+		{Name: "UUID", Text: id},
+		{Name: "Times", Children: []*kdbx.Node{
+			{Name: "LastModificationTime", Text: at(modified)},
+			{Name: "LocationChanged", Text: at(0)},
+		}},
+		{Name: "String", Children: []*kdbx.Node{{Name: "Key", Text: "Title"}, {Name: "Value", Text: title}}},
+	}}
+}
+
+func newTestGroup(id, name string, children ...*kdbx.Node) *kdbx.Node {
+	return &kdbx.Node{Name: "Group", Children: append([]*kdbx.Node{
+		{Name: "UUID", Text: id},
+		{Name: "Name", Text: name},
+		{Name: "Times", Children: []*kdbx.Node{
+			{Name: "LastModificationTime", Text: at(0)},
+			{Name: "LocationChanged", Text: at(0)},
+		}},
+	}, children...)}
+}
+
+// Builds a database with a few entries, and returns two independent copies of it.
+func newTestCopies() (*kdbx.Database, *kdbx.Database) {
+	db := kdbx.New("personal")
+	db.Header.KdfParameters.Set("M", kdbx.VariantUint64, binary.LittleEndian.AppendUint64(nil, 1024*1024))
+	db.Header.KdfParameters.Set("I", kdbx.VariantUint64, binary.LittleEndian.AppendUint64(nil, 1))
+
+	root := db.Content.Find("Root", "Group")
+	root.Children = append(root.Children,
+		newTestEntry("mail", "Mail", 0),
+		newTestEntry("bank", "Bank", 0),
+		newTestEntry("shop", "Shop", 0),
+		newTestGroup("work", "Work", newTestEntry("vpn", "VPN", 0)),
+	)
+
+	copyOf := func() *kdbx.Database {
+		return &kdbx.Database{Header: db.Header, InnerRandomStreamID: db.InnerRandomStreamID, Content: db.Content.Clone()}
+	}
+
+	return copyOf(), copyOf()
+}
+
+// Returns the local entry or group with the given UUID, and its parent.
+func find(db *kdbx.Database, id string) (node, parent *kdbx.Node) {
+	db.Content.Child("Root").Walk(func(n *kdbx.Node) {
+		for _, c := range n.Children {
+			if n.Name != "History" && (c.Name == "Entry" || c.Name == "Group") && uuid(c) == id {
+				node, parent = c, n
+			}
+		}
+	})
+
+	return node, parent
+}
+
+func title(entry *kdbx.Node) string {
+	for _, s := range entry.ChildrenNamed("String") {
+		if s.ChildText("Key") == "Title" {
+			return s.ChildText("Value")
+		}
+	}
+
+	return ""
+}
+
+func setTitle(db *kdbx.Database, id, t string, modified int) {
+	entry, _ := find(db, id)
+	entry.ChildrenNamed("String")[0].Child("Value").Text = t
+	entry.Find("Times", "LastModificationTime").Text = at(modified)
+}
+
+func deleteItem(db *kdbx.Database, id string, when int) {
+	node, parent := find(db, id)
+	parent.Remove(node)
+
+	deleted := db.Content.Find("Root", "DeletedObjects")
+	deleted.Children = append(deleted.Children, &kdbx.Node{Name: "DeletedObject", Children: []*kdbx.Node{
+		{Name: "UUID", Text: id},
+		{Name: "DeletionTime", Text: at(when)},
+	}})
+}
+
+func TestMerge(t *testing.T) {
+	local, remote := newTestCopies()
+
+	// Both sides edit the same entry, the remote one last.
+	setTitle(local, "mail", "Mail (laptop)", 1)
+	setTitle(remote, "mail", "Mail (phone)", 2)
+	// Both sides edit the same entry, the local one last.
+	setTitle(remote, "bank", "Bank (phone)", 1)
+	setTitle(local, "bank", "Bank (laptop)", 2)
+	// The remote side adds an entry with an attachment.
+	added := newTestEntry("news", "News", 3)
+	added.Children = append(added.Children, &kdbx.Node{Name: "Binary", Children: []*kdbx.Node{
+		{Name: "Key", Text: "notes.txt"},
+		{Name: "Value"},
+	}})
+	added.Find("Binary", "Value").SetAttr("Ref", "0")
+	remote.Binaries = []kdbx.Binary{{Data: []byte("attached")}}
+	group, _ := find(remote, "work")
+	group.Children = append(group.Children, added)
+	// The local side deletes an entry the remote side did not touch since.
+	deleteItem(local, "shop", 4)
+	// The remote side moves an entry into the root group.
+	vpn, work := find(remote, "vpn")
+	work.Remove(vpn)
+	vpn.Find("Times", "LocationChanged").Text = at(5)
+	remoteRoot := remote.Content.Find("Root", "Group")
+	remoteRoot.Children = append(remoteRoot.Children, vpn)
+
+	stats, e := Merge(local, remote)
+	if e != nil {
+		t.Fatalf("Merge() error = %v", e)
+	}
+
+	if want := (Stats{Added: 1, Updated: 1, Moved: 1, Deleted: 0}); stats != want {
+		t.Errorf("Merge() = %+v, want %+v", stats, want)
+	}
+
+	tests := []struct {
+		name    string
+		id      string
+		title   string
+		history []string
+		parent  string
+	}{
+		{
+			name:    "1",
+			id:      "mail",
+			title:   "Mail (phone)",
+			history: []string{"Mail (laptop)"},
+			parent:  "personal",
+		},
+		{
+			name:    "2",
+			id:      "bank",
+			title:   "Bank (laptop)",
+			history: []string{"Bank (phone)"},
+			parent:  "personal",
+		},
+		{
+			name:   "3",
+			id:     "news",
+			title:  "News",
+			parent: "Work",
+		},
+		{
+			name:   "4",
+			id:     "vpn",
+			title:  "VPN",
+			parent: "personal",
+		},
+		{
+			name: "5",
+			id:   "shop",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, parent := find(local, tt.id)
+			if tt.title == "" {
+				if entry != nil {
+					t.Errorf("entry %s was not deleted", tt.id)
+				}
+				return
+			}
+
+			if entry == nil {
+				t.Fatalf("entry %s is missing", tt.id)
+			}
+
+			if got := title(entry); got != tt.title {
+				t.Errorf("title = %q, want %q", got, tt.title)
+			}
+
+			var history []string
+			for _, h := range entry.Find("History").ChildrenNamed("Entry") {
+				history = append(history, title(h))
+			}
+			if !reflect.DeepEqual(history, tt.history) {
+				t.Errorf("history = %q, want %q", history, tt.history)
+			}
+
+			if got := parent.ChildText("Name"); got != tt.parent {
+				t.Errorf("parent = %q, want %q", got, tt.parent)
+			}
+		})
+	}
+
+	news, _ := find(local, "news")
+	if ref, _ := strconv.Atoi(news.Find("Binary", "Value").Attr("Ref")); ref >= len(local.Binaries) || string(local.Binaries[ref].Data) != "attached" {
+		t.Errorf("attachment of the added entry was not carried over")
+	}
+
+	if deleted := local.Content.Find("Root", "DeletedObjects").ChildrenNamed("DeletedObject"); len(deleted) != 1 || uuid(deleted[0]) != "shop" {
+		t.Errorf("deleted objects = %d, want the deletion of shop", len(deleted))
+	}
+}
+
+func TestMergeDeletions(t *testing.T) {
+	local, remote := newTestCopies()
+
+	// Deleted remotely and not modified locally since, so the deletion wins.
+	deleteItem(remote, "mail", 2)
+	// Deleted remotely but modified locally afterwards, so the entry survives.
+	deleteItem(remote, "bank", 2)
+	setTitle(local, "bank", "Bank (laptop)", 3)
+	// Deleted remotely along with the entry inside it.
+	deleteItem(remote, "vpn", 2)
+	deleteItem(remote, "work", 2)
+
+	stats, e := Merge(local, remote)
+	if e != nil {
+		t.Fatalf("Merge() error = %v", e)
+	}
+
+	if stats.Deleted != 3 {
+		t.Errorf("Merge() deleted %d items, want 3", stats.Deleted)
+	}
+
+	for id, want := range map[string]bool{"mail": false, "bank": true, "vpn": false, "work": false, "shop": true} {
+		if got, _ := find(local, id); (got != nil) != want {
+			t.Errorf("%s exists = %v, want %v", id, got != nil, want)
+		}
+	}
+
+	// Merging again changes nothing.
+	if stats, _ := Merge(local, remote); stats != (Stats{}) {
+		t.Errorf("second Merge() = %+v, want no changes", stats)
+	}
+}
+
+func TestMergeUnrelated(t *testing.T) {
+	local, _ := newTestCopies()
+	other, _ := newTestCopies()
+
+	if _, e := Merge(local, other); e == nil {
+		t.Errorf("Merge() of unrelated databases did not fail")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	local, remote := newTestCopies()
+	setTitle(remote, "mail", "Mail (phone)", 2)
+
+	creds, _ := kdbx.NewCredentials("password", nil)
+	encode := func(db *kdbx.Database) []byte {
+		var b bytes.Buffer
+		if e := db.Write(&b, creds); e != nil {
+			t.Fatalf("Write() error = %v", e)
+		}
+		return b.Bytes()
+	}
+
+	merged, stats, e := Files(encode(local), encode(remote), creds)
+	if e != nil || stats.Updated != 1 {
+		t.Fatalf("Files() = %+v, %v, want 1 update", stats, e)
+	}
+
+	db, e := kdbx.Open(bytes.NewReader(merged), creds)
+	if e != nil {
+		t.Fatalf("Open() error = %v", e)
+	}
+
+	if entry, _ := find(db, "mail"); entry == nil || title(entry) != "Mail (phone)" {
+		t.Errorf("merged database lacks the remote change")
+	}
+
+	wrong, _ := kdbx.NewCredentials("wrong", nil)
+	if _, _, e := Files(encode(local), encode(remote), wrong); e == nil {
+		t.Errorf("Files() with wrong credentials did not fail")
+	}
+}
+
+// Returns the entry with the given title, outside of any history.
+func byTitle(db *kdbx.Database, t string) *kdbx.Node {
+	var found *kdbx.Node
+	db.Content.Child("Root").Walk(func(n *kdbx.Node) {
+		for _, c := range n.ChildrenNamed("Entry") {
+			if n.Name != "History" && title(c) == t {
+				found = c
+			}
+		}
+	})
+
+	return found
+}
+
+func field(entry *kdbx.Node, key string) string {
+	for _, s := range entry.ChildrenNamed("String") {
+		if s.ChildText("Key") == key {
+			return s.ChildText("Value")
+		}
+	}
+
+	return ""
+}
+
+// Merges the copies of a database in testdata that two devices edited apart in KeePassXC, see
+// testdata/README.md, and reads the merged database back. Skipped until the copies are added.
+func TestFilesFixtures(t *testing.T) {
+	keyFile, e := os.ReadFile(filepath.Join("testdata", "kdbx4.keyx"))
+	if os.IsNotExist(e) {
+		t.Skip("the KeePassXC fixtures are missing, see testdata/README.md")
+	} else if e != nil {
+		t.Fatal(e)
+	}
+
+	tests := []struct {
+		name       string
+		local      string
+		remote     string
+		keyFile    []byte
+		wantFormat string
+	}{
+		{
+			name:       "1",
+			local:      "kdbx3-laptop.kdbx",
+			remote:     "kdbx3-desktop.kdbx",
+			wantFormat: "KDBX 3.1",
+		},
+		{
+			name:       "2",
+			local:      "kdbx4-laptop.kdbx",
+			remote:     "kdbx4-desktop.kdbx",
+			keyFile:    keyFile,
+			wantFormat: "KDBX 4.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, e := os.ReadFile(filepath.Join("testdata", tt.local))
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			remote, e := os.ReadFile(filepath.Join("testdata", tt.remote))
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			creds, e := kdbx.NewCredentials("correct horse battery staple", tt.keyFile)
+			if e != nil {
+				t.Fatalf("NewCredentials() error = %v", e)
+			}
+
+			merged, stats, e := Files(local, remote, creds)
+			if want := (Stats{Added: 1, Updated: 1, Deleted: 1}); e != nil || stats != want {
+				t.Fatalf("Files() = %+v, %v, want %+v", stats, e, want)
+			}
+
+			before, _ := kdbx.ParseHeader(bytes.NewReader(local))
+			after, e := kdbx.ParseHeader(bytes.NewReader(merged))
+			if e != nil || after.Format() != tt.wantFormat || after.CipherID != before.CipherID {
+				t.Fatalf("ParseHeader() = %+v, %v, want %s with the cipher of the local database", after, e, tt.wantFormat)
+			}
+
+			db, e := kdbx.Open(bytes.NewReader(merged), creds)
+			if e != nil {
+				t.Fatalf("Open() error = %v", e)
+			}
+
+			if byTitle(db, "VPN") != nil {
+				t.Errorf("entry deleted on the remote is still there")
+			}
+
+			for _, want := range []string{"Forum", "Shop"} {
+				if byTitle(db, want) == nil {
+					t.Errorf("entry %s is missing", want)
+				}
+			}
+
+			if bank := byTitle(db, "Bank (joint)"); bank == nil || field(bank, "Notes") != "Shared with Bob" || field(bank, "Password") != "bank-1" {
+				t.Errorf("remote edit of the bank entry is missing")
+			}
+
+			mail := byTitle(db, "Mail")
+			if mail == nil {
+				t.Fatalf("mail entry is missing")
+			}
+
+			if got := field(mail, "Password"); got != "mail-2 <laptop> & co" {
+				t.Errorf("protected password = %q, want the local edit", got)
+			}
+
+			if history := mail.Child("History").ChildrenNamed("Entry"); len(history) != 2 || field(history[0], "Password") != "mail-0" {
+				t.Errorf("history of the mail entry was not kept")
+			}
+
+			ref, e := strconv.Atoi(mail.Child("Binary").Child("Value").Attr("Ref"))
+			if e != nil || ref >= len(db.Binaries) || !bytes.HasPrefix(db.Binaries[ref].Data, []byte("Recovery codes")) {
+				t.Errorf("attachment of the mail entry is missing")
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package all registers every remote backend with the remotes registry when imported.
+package all
+
+import (
+	_ "github.com/fire833/keepassxcync/pkg/remotes/fs"
+	_ "github.com/fire833/keepassxcync/pkg/remotes/git"
+	_ "github.com/fire833/keepassxcync/pkg/remotes/http"
+	_ "github.com/fire833/keepassxcync/pkg/remotes/s3"
+	_ "github.com/fire833/keepassxcync/pkg/remotes/sftp"
+	_ "github.com/fire833/keepassxcync/pkg/remotes/webdav"
+)
@@ -0,0 +1,359 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Options for constructing a new FSRemote.
+type Options struct {
+	// Directory that versions are stored within, such as a network mount
+	// or a folder replicated by another tool.
+	Dir string
+	// Name of the database that is being versioned on this remote.
+	Database string
+}
+
+var (
+	_ remotes.Remote  = &FSRemote{}
+	_ remotes.Deleter = &FSRemote{}
+)
+
+func init() {
+	remotes.Register(config.RemoteTypeFS, func(ctx context.Context, conf *config.KeepassxCyncRemote, database string) (remotes.Remote, error) {
+		return New(&Options{
+			Dir:      config.ExpandPath(conf.FS.Dir),
+			Database: database,
+		})
+	})
+}
+
+// FSRemote stores every version of a database as its own file under
+// <dir>/<database>/<version>.kdbx, with a <version>.json file alongside
+// it that holds the version metadata.
+type FSRemote struct {
+	dir      string
+	database string
+}
+
+func New(opts *Options) (*FSRemote, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("fs remote requires a directory")
+	}
+
+	if opts.Database == "" {
+		return nil, errors.New("fs remote requires a database name")
+	}
+
+	dir := filepath.Join(opts.Dir, opts.Database)
+	if e := os.MkdirAll(dir, 0o700); e != nil {
+		return nil, e
+	}
+
+	return &FSRemote{dir: dir, database: opts.Database}, nil
+}
+
+func (r *FSRemote) PersistVersion(ctx context.Context, data io.Reader, parent uint) (remotes.VersionInfo, error) {
+	last, e := r.lastVersionID()
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	if last != parent {
+		return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent, Actual: last}
+	}
+
+	body, e := io.ReadAll(data)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	info := remotes.NewVersionInfo(r.database, body)
+	info.ID = parent + 1
+
+	meta, e := remotes.EncodeSidecar(info)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	// Creating the version file fails if another writer already stored this version.
+	if e := writeExclusive(r.path(info.ID, remotes.VersionSuffix), body); e != nil {
+		if errors.Is(e, fs.ErrExist) {
+			return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent, Actual: info.ID}
+		}
+		return remotes.VersionInfo{}, e
+	}
+
+	if e := writeAtomic(r.path(info.ID, remotes.MetaSuffix), meta); e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	return info, nil
+}
+
+func (r *FSRemote) GetVersion(ctx context.Context, id uint) (io.ReadCloser, remotes.VersionInfo, error) {
+	info, e := r.statVersion(id)
+	if e != nil {
+		return nil, remotes.VersionInfo{}, e
+	}
+
+	file, e := os.Open(r.path(id, remotes.VersionSuffix))
+	if e != nil {
+		return nil, remotes.VersionInfo{}, translateError(e)
+	}
+
+	return file, info, nil
+}
+
+func (r *FSRemote) GetLastVersion(ctx context.Context) (remotes.VersionInfo, error) {
+	last, e := r.lastVersionID()
+	if e != nil || last == 0 {
+		return remotes.VersionInfo{}, e
+	}
+
+	return r.statVersion(last)
+}
+
+func (r *FSRemote) ListVersions(ctx context.Context, after uint, limit int) ([]remotes.VersionInfo, error) {
+	ids, e := r.versionIDs()
+	if e != nil {
+		return nil, e
+	}
+
+	var versions []remotes.VersionInfo
+	for _, id := range ids {
+		if id <= after {
+			continue
+		}
+
+		if len(versions) == limit {
+			break
+		}
+
+		info, e := r.statVersion(id)
+		if e != nil {
+			return nil, e
+		}
+
+		versions = append(versions, info)
+	}
+
+	return versions, nil
+}
+
+func (r *FSRemote) DeleteVersion(ctx context.Context, id uint) error {
+	// The version file goes first, a sidecar left behind without it is never read.
+	if e := os.Remove(r.path(id, remotes.VersionSuffix)); e != nil {
+		return translateError(e)
+	}
+
+	if e := os.Remove(r.path(id, remotes.MetaSuffix)); e != nil && !os.IsNotExist(e) {
+		return e
+	}
+
+	return nil
+}
+
+// Reads the sidecar metadata of a version. Version files that were copied in without
+// a sidecar have their metadata rebuilt from the file itself.
+func (r *FSRemote) statVersion(id uint) (remotes.VersionInfo, error) {
+	if meta, e := os.ReadFile(r.path(id, remotes.MetaSuffix)); e == nil {
+		return remotes.DecodeSidecar(id, meta)
+	} else if !os.IsNotExist(e) {
+		return remotes.VersionInfo{}, e
+	}
+
+	stat, e := os.Stat(r.path(id, remotes.VersionSuffix))
+	if e != nil {
+		return remotes.VersionInfo{}, translateError(e)
+	}
+
+	data, e := os.ReadFile(r.path(id, remotes.VersionSuffix))
+	if e != nil {
+		return remotes.VersionInfo{}, translateError(e)
+	}
+
+	return remotes.RebuildVersionInfo(r.database, id, stat.ModTime(), data), nil
+}
+
+func (r *FSRemote) lastVersionID() (uint, error) {
+	ids, e := r.versionIDs()
+	if e != nil || len(ids) == 0 {
+		return 0, e
+	}
+
+	return ids[len(ids)-1], nil
+}
+
+// Returns the number of every version file within the directory, in ascending order.
+// Versions that are still being written are left out.
+func (r *FSRemote) versionIDs() ([]uint, error) {
+	entries, e := os.ReadDir(r.dir)
+	if e != nil {
+		return nil, e
+	}
+
+	// ReadDir sorts entries by name, and names are zero-padded,
+	// so the returned IDs are already in order.
+	var ids []uint
+	for _, entry := range entries {
+		if id, ok := remotes.ParseVersionName(entry.Name()); ok && entry.Type().IsRegular() && !r.pending(entry, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// Reports whether version id is an empty file without a sidecar, which is what a version
+// claimed on a file system without hard links looks like until its data is renamed over it.
+func (r *FSRemote) pending(entry fs.DirEntry, id uint) bool {
+	info, e := entry.Info()
+	if e != nil || info.Size() > 0 {
+		return false
+	}
+
+	_, e = os.Stat(r.path(id, remotes.MetaSuffix))
+	return os.IsNotExist(e)
+}
+
+func (r *FSRemote) path(id uint, suffix string) string {
+	return filepath.Join(r.dir, remotes.VersionName(id, suffix))
+}
+
+// Writes data to a temporary file next to path, syncs it, and then renames it
+// into place so that readers never observe a partially written file.
+func writeAtomic(path string, data []byte) error {
+	tmp, e := writeTemp(path, data)
+	if e != nil {
+		return e
+	}
+
+	if e := os.Rename(tmp, path); e != nil {
+		os.Remove(tmp)
+		return e
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// Like writeAtomic, but fails with an error matching fs.ErrExist if path already exists.
+func writeExclusive(path string, data []byte) error {
+	tmp, e := writeTemp(path, data)
+	if e != nil {
+		return e
+	}
+	defer os.Remove(tmp)
+
+	// Linking the written file into place is atomic and exclusive, but FAT, exFAT and
+	// many network shares do not support hard links.
+	if e := link(tmp, path); linkUnsupported(e) {
+		if e := claimExclusive(tmp, path); e != nil {
+			return e
+		}
+	} else if e != nil {
+		return e
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// Creates hard links, replaced by tests to act like file systems without them.
+var link = os.Link
+
+// Reports whether e is the error of a file system that does not support hard links.
+func linkUnsupported(e error) bool {
+	return errors.Is(e, syscall.EPERM) || errors.Is(e, syscall.ENOTSUP) || errors.Is(e, syscall.EOPNOTSUPP) || errors.Is(e, syscall.ENOSYS)
+}
+
+// Claims path with an exclusive create and renames tmp over the still empty file.
+// Readers take an empty version without a sidecar for one that is being written.
+func claimExclusive(tmp, path string) error {
+	claim, e := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if e != nil {
+		return e
+	}
+	claim.Close()
+
+	if e := os.Rename(tmp, path); e != nil {
+		os.Remove(path)
+		return e
+	}
+
+	return nil
+}
+
+// Writes data to a synced temporary file next to path and returns its name.
+func writeTemp(path string, data []byte) (string, error) {
+	tmp, e := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if e != nil {
+		return "", e
+	}
+
+	if _, e := io.Copy(tmp, bytes.NewReader(data)); e != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", e
+	}
+
+	if e := tmp.Sync(); e != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", e
+	}
+
+	if e := tmp.Close(); e != nil {
+		os.Remove(tmp.Name())
+		return "", e
+	}
+
+	return tmp.Name(), nil
+}
+
+// Flushes the directory entry of a rename to disk. Not every filesystem
+// supports syncing a directory, so failures to do so are ignored.
+func syncDir(dir string) error {
+	d, e := os.Open(dir)
+	if e != nil {
+		return e
+	}
+	defer d.Close()
+
+	d.Sync()
+	return nil
+}
+
+func translateError(e error) error {
+	if os.IsNotExist(e) {
+		return remotes.ErrVersionNotFound
+	}
+
+	return e
+}
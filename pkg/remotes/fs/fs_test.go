@@ -0,0 +1,305 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+func newTestRemote(t *testing.T, dir string) *FSRemote {
+	r, e := New(&Options{Dir: dir, Database: "personal"})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+	return r
+}
+
+func TestFSRemoteVersions(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRemote(t, t.TempDir())
+
+	if last, e := r.GetLastVersion(ctx); e != nil || last.ID != 0 {
+		t.Fatalf("GetLastVersion() = %v, %v, want 0, nil", last.ID, e)
+	}
+
+	versions := [][]byte{
+		[]byte("first version"),
+		[]byte("second version"),
+		[]byte("third version"),
+	}
+
+	for i, data := range versions {
+		info, e := r.PersistVersion(ctx, bytes.NewReader(data), uint(i))
+		if e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+		if info.ID != uint(i+1) || info.SHA256 != remotes.HashBytes(data) {
+			t.Errorf("PersistVersion() = %+v, unexpected metadata", info)
+		}
+
+		last, e := r.GetLastVersion(ctx)
+		if e != nil {
+			t.Fatalf("GetLastVersion() error = %v", e)
+		}
+		if last.ID != info.ID || last.SHA256 != info.SHA256 || !last.Timestamp.Equal(info.Timestamp) {
+			t.Errorf("GetLastVersion() = %+v, want %+v", last, info)
+		}
+	}
+
+	for i, want := range versions {
+		body, info, e := r.GetVersion(ctx, uint(i+1))
+		if e != nil {
+			t.Fatalf("GetVersion(%d) error = %v", i+1, e)
+		}
+
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if !bytes.Equal(got, want) || info.SHA256 != remotes.HashBytes(want) {
+			t.Errorf("GetVersion(%d) = %q, %+v, want %q", i+1, got, info, want)
+		}
+	}
+
+	if _, _, e := r.GetVersion(ctx, 42); !errors.Is(e, remotes.ErrVersionNotFound) {
+		t.Errorf("GetVersion(42) error = %v, want %v", e, remotes.ErrVersionNotFound)
+	}
+
+	// No temporary files should be left behind by the atomic writes.
+	entries, _ := os.ReadDir(r.dir)
+	if len(entries) != 2*len(versions) {
+		t.Errorf("remote directory has %d entries, want %d", len(entries), 2*len(versions))
+	}
+}
+
+func TestFSRemoteListVersions(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRemote(t, t.TempDir())
+
+	for i := 0; i < 5; i++ {
+		if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte{byte(i)}), uint(i)); e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+	}
+
+	// Stray files in the directory must not be treated as versions.
+	os.WriteFile(filepath.Join(r.dir, "notes.txt"), []byte("hi"), 0o600)
+	os.WriteFile(filepath.Join(r.dir, ".00000000000000000006.kdbx.tmp-1"), []byte("hi"), 0o600)
+
+	tests := []struct {
+		name  string
+		after uint
+		limit int
+		want  []uint
+	}{
+		{
+			name:  "1",
+			after: 0,
+			limit: 2,
+			want:  []uint{1, 2},
+		},
+		{
+			name:  "2",
+			after: 2,
+			limit: 10,
+			want:  []uint{3, 4, 5},
+		},
+		{
+			name:  "3",
+			after: 5,
+			limit: 10,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := r.ListVersions(ctx, tt.after, tt.limit)
+			if e != nil {
+				t.Errorf("ListVersions() error = %v", e)
+				return
+			}
+
+			var ids []uint
+			for _, v := range got {
+				ids = append(ids, v.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("ListVersions() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestFSRemoteMissingSidecar(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRemote(t, t.TempDir())
+
+	data := []byte("copied in by hand")
+	if e := os.WriteFile(filepath.Join(r.dir, "00000000000000000001.kdbx"), data, 0o600); e != nil {
+		t.Fatal(e)
+	}
+
+	info, e := r.GetLastVersion(ctx)
+	if e != nil {
+		t.Fatalf("GetLastVersion() error = %v", e)
+	}
+
+	if info.ID != 1 || info.SHA256 != remotes.HashBytes(data) || info.Size != int64(len(data)) {
+		t.Errorf("GetLastVersion() = %+v, unexpected metadata", info)
+	}
+
+	next, e := r.PersistVersion(ctx, bytes.NewReader([]byte("next")), 1)
+	if e != nil || next.ID != 2 {
+		t.Errorf("PersistVersion() = %v, %v, want 2", next.ID, e)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{
+			name:    "1",
+			opts:    &Options{Dir: t.TempDir(), Database: "personal"},
+			wantErr: false,
+		},
+		{
+			name:    "2",
+			opts:    &Options{Database: "personal"},
+			wantErr: true,
+		},
+		{
+			name:    "3",
+			opts:    &Options{Dir: t.TempDir()},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFSRemoteConflict(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRemote(t, t.TempDir())
+
+	if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte("laptop")), 0); e != nil {
+		t.Fatalf("PersistVersion() error = %v", e)
+	}
+
+	// The desktop still believes the remote to be empty.
+	_, e := r.PersistVersion(ctx, bytes.NewReader([]byte("desktop")), 0)
+	var conflict *remotes.ConflictError
+	if !errors.As(e, &conflict) || conflict.Expected != 0 || conflict.Actual != 1 {
+		t.Fatalf("PersistVersion() error = %v, want conflict with version 1", e)
+	}
+
+	// Another writer claiming the same version in between the check and the write.
+	if e := writeExclusive(r.path(1, remotes.VersionSuffix), []byte("late")); !errors.Is(e, fs.ErrExist) {
+		t.Errorf("writeExclusive() error = %v, want %v", e, fs.ErrExist)
+	}
+
+	body, _, e := r.GetVersion(ctx, 1)
+	if e != nil {
+		t.Fatalf("GetVersion() error = %v", e)
+	}
+	defer body.Close()
+
+	if got, _ := io.ReadAll(body); !bytes.Equal(got, []byte("laptop")) {
+		t.Errorf("GetVersion(1) = %q, want %q", got, "laptop")
+	}
+}
+
+func TestFSRemoteWithoutHardLinks(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRemote(t, t.TempDir())
+
+	link = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: syscall.EPERM}
+	}
+	t.Cleanup(func() { link = os.Link })
+
+	if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte("laptop")), 0); e != nil {
+		t.Fatalf("PersistVersion() error = %v", e)
+	}
+
+	if e := writeExclusive(r.path(1, remotes.VersionSuffix), []byte("late")); !errors.Is(e, fs.ErrExist) {
+		t.Errorf("writeExclusive() error = %v, want %v", e, fs.ErrExist)
+	}
+
+	// Another writer claimed version 2 and has not renamed its data over it yet.
+	os.WriteFile(r.path(2, remotes.VersionSuffix), nil, 0o600)
+
+	if last, e := r.GetLastVersion(ctx); e != nil || last.ID != 1 || last.SHA256 != remotes.HashBytes([]byte("laptop")) {
+		t.Errorf("GetLastVersion() = %+v, %v, want version 1", last, e)
+	}
+
+	if versions, e := r.ListVersions(ctx, 0, 10); e != nil || len(versions) != 1 {
+		t.Errorf("ListVersions() = %+v, %v, want only version 1", versions, e)
+	}
+
+	_, e := r.PersistVersion(ctx, bytes.NewReader([]byte("desktop")), 1)
+	if !remotes.IsConflict(e) {
+		t.Errorf("PersistVersion() error = %v, want conflict with the claimed version", e)
+	}
+}
+
+func TestFSRemoteDeleteVersion(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRemote(t, t.TempDir())
+
+	for i, data := range []string{"first", "second", "third"} {
+		if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte(data)), uint(i)); e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+	}
+
+	if e := r.DeleteVersion(ctx, 1); e != nil {
+		t.Fatalf("DeleteVersion() error = %v", e)
+	}
+
+	if e := r.DeleteVersion(ctx, 1); !errors.Is(e, remotes.ErrVersionNotFound) {
+		t.Errorf("DeleteVersion() error = %v, want %v", e, remotes.ErrVersionNotFound)
+	}
+
+	versions, e := remotes.ListAllVersions(ctx, r)
+	if e != nil || len(versions) != 2 || versions[0].ID != 2 {
+		t.Fatalf("ListAllVersions() = %+v, %v, want versions 2 and 3", versions, e)
+	}
+
+	if next, e := r.PersistVersion(ctx, bytes.NewReader([]byte("fourth")), 3); e != nil || next.ID != 4 {
+		t.Errorf("PersistVersion() = %v, %v, want 4", next.ID, e)
+	}
+}
@@ -0,0 +1,170 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Name of the file within the database directory that holds the current lease.
+const lockName string = ".lock"
+
+var _ remotes.Locker = &FSRemote{}
+
+func (r *FSRemote) Lock(ctx context.Context, owner string, ttl time.Duration, takeover bool) (remotes.Lease, error) {
+	lease, e := remotes.NewLease(owner, ttl)
+	if e != nil {
+		return remotes.Lease{}, e
+	}
+
+	data, e := json.MarshalIndent(lease, "", "	")
+	if e != nil {
+		return remotes.Lease{}, e
+	}
+
+	// A lease that is released between failing to create the lock and reading
+	// it back is retried a few times before giving up.
+	for attempt := 0; attempt < 3; attempt++ {
+		e := writeExclusive(r.lockPath(), data)
+		if e == nil {
+			return lease, nil
+		} else if !errors.Is(e, fs.ErrExist) {
+			return remotes.Lease{}, e
+		}
+
+		current, e := r.readLease(r.lockPath())
+		if os.IsNotExist(e) {
+			continue
+		} else if e != nil {
+			return remotes.Lease{}, e
+		}
+
+		if !current.Expired(time.Now()) || !takeover {
+			return remotes.Lease{}, &remotes.LockedError{Lease: current, Stale: current.Expired(time.Now())}
+		}
+
+		if e := r.takeover(current); e != nil {
+			return remotes.Lease{}, e
+		}
+	}
+
+	return remotes.Lease{}, errors.New("unable to acquire lease, the lock keeps changing")
+}
+
+func (r *FSRemote) Renew(ctx context.Context, lease remotes.Lease, ttl time.Duration) (remotes.Lease, error) {
+	if e := r.checkLease(lease); e != nil {
+		return remotes.Lease{}, e
+	}
+
+	lease.Expires = time.Now().UTC().Add(ttl)
+	data, e := json.MarshalIndent(lease, "", "	")
+	if e != nil {
+		return remotes.Lease{}, e
+	}
+
+	return lease, writeAtomic(r.lockPath(), data)
+}
+
+func (r *FSRemote) Unlock(ctx context.Context, lease remotes.Lease) error {
+	if e := r.checkLease(lease); e != nil {
+		return e
+	}
+
+	return os.Remove(r.lockPath())
+}
+
+func (r *FSRemote) CurrentLease(ctx context.Context) (*remotes.Lease, error) {
+	lease, e := r.readLease(r.lockPath())
+	if os.IsNotExist(e) {
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+
+	return &lease, nil
+}
+
+func (r *FSRemote) BreakLock(ctx context.Context) error {
+	if e := os.Remove(r.lockPath()); e != nil && !os.IsNotExist(e) {
+		return e
+	}
+
+	return nil
+}
+
+// Moves the expired lease stale out of the way. The lock is renamed rather than removed, so
+// that a lease another device acquired in the meantime can be detected and put back.
+func (r *FSRemote) takeover(stale remotes.Lease) error {
+	moved := r.lockPath() + ".stale-" + stale.ID
+	if e := os.Rename(r.lockPath(), moved); e != nil {
+		if os.IsNotExist(e) {
+			return nil
+		}
+		return e
+	}
+	defer os.Remove(moved)
+
+	current, e := r.readLease(moved)
+	if e != nil || current.ID == stale.ID {
+		return e
+	}
+
+	// Another device replaced the stale lease first, hand its lease back.
+	data, e := os.ReadFile(moved)
+	if e != nil {
+		return e
+	}
+
+	if e := writeExclusive(r.lockPath(), data); e != nil && !os.IsExist(e) {
+		return e
+	}
+
+	return &remotes.LockedError{Lease: current}
+}
+
+// Returns ErrLeaseLost unless lease is the lease currently stored in the lock.
+func (r *FSRemote) checkLease(lease remotes.Lease) error {
+	current, e := r.readLease(r.lockPath())
+	if os.IsNotExist(e) || (e == nil && current.ID != lease.ID) {
+		return remotes.ErrLeaseLost
+	}
+
+	return e
+}
+
+func (r *FSRemote) readLease(path string) (remotes.Lease, error) {
+	data, e := os.ReadFile(path)
+	if e != nil {
+		return remotes.Lease{}, e
+	}
+
+	return remotes.DecodeLease(data), nil
+}
+
+func (r *FSRemote) lockPath() string {
+	return filepath.Join(r.dir, lockName)
+}
@@ -0,0 +1,515 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Trailers of the commit message that version metadata is recorded under.
+const (
+	trailerVersion   string = "Keepassxcync-Version"
+	trailerDatabase  string = "Keepassxcync-Database"
+	trailerHost      string = "Keepassxcync-Host"
+	trailerTimestamp string = "Keepassxcync-Timestamp"
+	trailerSize      string = "Keepassxcync-Size"
+	trailerSHA256    string = "Keepassxcync-SHA256"
+)
+
+// Options for constructing a new GitRemote.
+type Options struct {
+	// URL of the repository, anything that git accepts as a remote works, such as a
+	// path to a local bare repository, a file:// url or an ssh url.
+	URL string
+	// Branch that versions are committed to, defaults to main.
+	Branch string
+	// Name of the database that is being versioned on this remote.
+	Database string
+	// Local directory used to cache the repository, defaults to a directory
+	// under the user cache directory that is unique to the URL.
+	CacheDir string
+	// Identity that commits are authored with. If empty, the git configuration
+	// of the user is used, falling back to a keepassxcync identity.
+	AuthorName  string
+	AuthorEmail string
+	// GPG sign every version commit.
+	Sign bool
+}
+
+var _ remotes.Remote = &GitRemote{}
+
+func init() {
+	remotes.Register(config.RemoteTypeGit, func(ctx context.Context, conf *config.KeepassxCyncRemote, database string) (remotes.Remote, error) {
+		return New(&Options{
+			URL:         conf.Git.URL,
+			Branch:      conf.Git.Branch,
+			Database:    database,
+			CacheDir:    config.ExpandPath(conf.Git.CacheDir),
+			AuthorName:  conf.Git.AuthorName,
+			AuthorEmail: conf.Git.AuthorEmail,
+			Sign:        conf.Git.Sign,
+		})
+	})
+}
+
+// GitRemote stores a database as <database>.kdbx within a git repository, where
+// every version is its own commit on a branch and the version metadata is recorded
+// as trailers of the commit message. All operations are carried out on a local bare
+// cache of the repository, which is synchronized with the remote on every call.
+type GitRemote struct {
+	url      string
+	branch   string
+	database string
+	cache    string
+
+	authorName  string
+	authorEmail string
+	sign        bool
+
+	mu   sync.Mutex
+	init bool
+
+	// Called right before a version is pushed, so tests can race another clone.
+	beforePush func()
+}
+
+// A version commit as parsed from the branch history.
+type commit struct {
+	hash string
+	info remotes.VersionInfo
+}
+
+func New(opts *Options) (*GitRemote, error) {
+	if opts.URL == "" {
+		return nil, errors.New("git remote requires a repository url")
+	}
+
+	if opts.Database == "" {
+		return nil, errors.New("git remote requires a database name")
+	}
+
+	if _, e := exec.LookPath("git"); e != nil {
+		return nil, errors.New("git remote requires git to be installed")
+	}
+
+	branch := opts.Branch
+	if branch == "" {
+		branch = "main"
+	}
+
+	cache := opts.CacheDir
+	if cache == "" {
+		dir, e := os.UserCacheDir()
+		if e != nil {
+			return nil, e
+		}
+
+		sum := sha256.Sum256([]byte(opts.URL))
+		cache = filepath.Join(dir, "keepassxcync", "git", hex.EncodeToString(sum[:8]))
+	}
+
+	return &GitRemote{
+		url:         opts.URL,
+		branch:      branch,
+		database:    opts.Database,
+		cache:       cache,
+		authorName:  opts.AuthorName,
+		authorEmail: opts.AuthorEmail,
+		sign:        opts.Sign,
+	}, nil
+}
+
+func (r *GitRemote) PersistVersion(ctx context.Context, data io.Reader, parent uint) (remotes.VersionInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	head, e := r.fetch(ctx)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	var last uint
+	if head != "" {
+		commits, e := r.log(ctx, 1)
+		if e != nil {
+			return remotes.VersionInfo{}, e
+		}
+
+		if len(commits) > 0 {
+			last = commits[0].info.ID
+		}
+	}
+
+	if last != parent {
+		return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent, Actual: last}
+	}
+
+	body, e := io.ReadAll(data)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	info := remotes.NewVersionInfo(r.database, body)
+	info.ID = parent + 1
+
+	blob, e := r.git(ctx, bytes.NewReader(body), nil, "hash-object", "-w", "--stdin")
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	// Build the tree in a throwaway index, starting from the tree of the current head
+	// so that any other files within the repository are carried forward.
+	index, e := os.CreateTemp("", "keepassxcync-index-*")
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+	index.Close()
+	os.Remove(index.Name())
+	defer os.Remove(index.Name())
+
+	env := []string{"GIT_INDEX_FILE=" + index.Name()}
+	if head != "" {
+		if _, e := r.git(ctx, nil, env, "read-tree", head); e != nil {
+			return remotes.VersionInfo{}, e
+		}
+	}
+
+	if _, e := r.git(ctx, nil, env, "update-index", "--add", "--cacheinfo", "100644,"+blob+","+r.file()); e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	tree, e := r.git(ctx, nil, env, "write-tree")
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	args := []string{"commit-tree", tree, "-m", r.message(info)}
+	if head != "" {
+		args = append(args, "-p", head)
+	}
+	if r.sign {
+		args = append(args, "-S")
+	}
+
+	hash, e := r.git(ctx, nil, r.identity(ctx), args...)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	if r.beforePush != nil {
+		r.beforePush()
+	}
+
+	// Pushes are fast-forward only, so this is rejected if another device
+	// pushed a version after the fetch above.
+	ref := "refs/heads/" + r.branch
+	if out, e := r.git(ctx, nil, nil, "push", "--porcelain", "origin", hash+":"+ref); e != nil {
+		if pushRejected(out, ref) {
+			return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent}
+		}
+		return remotes.VersionInfo{}, e
+	}
+
+	if _, e := r.git(ctx, nil, nil, "update-ref", r.trackingRef(), hash); e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	return info, nil
+}
+
+func (r *GitRemote) GetVersion(ctx context.Context, id uint) (io.ReadCloser, remotes.VersionInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, e := r.findVersion(ctx, id)
+	if e != nil {
+		return nil, remotes.VersionInfo{}, e
+	}
+
+	data, e := r.gitRaw(ctx, nil, nil, "cat-file", "blob", c.hash+":"+r.file())
+	if e != nil {
+		return nil, remotes.VersionInfo{}, e
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), c.info, nil
+}
+
+func (r *GitRemote) GetLastVersion(ctx context.Context) (remotes.VersionInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	head, e := r.fetch(ctx)
+	if e != nil || head == "" {
+		return remotes.VersionInfo{}, e
+	}
+
+	commits, e := r.log(ctx, 1)
+	if e != nil || len(commits) == 0 {
+		return remotes.VersionInfo{}, e
+	}
+
+	return commits[0].info, nil
+}
+
+func (r *GitRemote) ListVersions(ctx context.Context, after uint, limit int) ([]remotes.VersionInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	head, e := r.fetch(ctx)
+	if e != nil || head == "" {
+		return nil, e
+	}
+
+	commits, e := r.log(ctx, 0)
+	if e != nil {
+		return nil, e
+	}
+
+	// History is returned newest first.
+	var versions []remotes.VersionInfo
+	for i := len(commits) - 1; i >= 0 && len(versions) < limit; i-- {
+		if commits[i].info.ID > after {
+			versions = append(versions, commits[i].info)
+		}
+	}
+
+	return versions, nil
+}
+
+func (r *GitRemote) findVersion(ctx context.Context, id uint) (*commit, error) {
+	head, e := r.fetch(ctx)
+	if e != nil {
+		return nil, e
+	}
+
+	if head == "" {
+		return nil, remotes.ErrVersionNotFound
+	}
+
+	commits, e := r.log(ctx, 0)
+	if e != nil {
+		return nil, e
+	}
+
+	for _, c := range commits {
+		if c.info.ID == id {
+			return &c, nil
+		}
+	}
+
+	return nil, remotes.ErrVersionNotFound
+}
+
+// Brings the local cache up to date with the branch on the remote, and returns
+// the hash of the head of the branch, or an empty string if the branch does not exist yet.
+func (r *GitRemote) fetch(ctx context.Context) (string, error) {
+	if !r.init {
+		if _, e := os.Stat(filepath.Join(r.cache, "HEAD")); os.IsNotExist(e) {
+			if e := os.MkdirAll(r.cache, 0o700); e != nil {
+				return "", e
+			}
+
+			if _, e := r.git(ctx, nil, nil, "init", "--quiet", "--bare"); e != nil {
+				return "", e
+			}
+
+			if _, e := r.git(ctx, nil, nil, "remote", "add", "origin", r.url); e != nil {
+				return "", e
+			}
+		} else if _, e := r.git(ctx, nil, nil, "remote", "set-url", "origin", r.url); e != nil {
+			return "", e
+		}
+
+		r.init = true
+	}
+
+	refs, e := r.git(ctx, nil, nil, "ls-remote", "origin", "refs/heads/"+r.branch)
+	if e != nil {
+		return "", e
+	}
+
+	if refs == "" {
+		return "", nil
+	}
+
+	if _, e := r.git(ctx, nil, nil, "fetch", "--quiet", "origin", "+refs/heads/"+r.branch+":"+r.trackingRef()); e != nil {
+		return "", e
+	}
+
+	return r.git(ctx, nil, nil, "rev-parse", r.trackingRef())
+}
+
+// Returns the version commits of the branch, newest first. A max of 0 returns all commits.
+func (r *GitRemote) log(ctx context.Context, max int) ([]commit, error) {
+	args := []string{"log", "--format=%H%x1f%B%x1e"}
+	if max > 0 {
+		// The limit is applied after the path filter, so commits that only
+		// touch other files in the repository do not count towards it.
+		args = append(args, "-n", strconv.Itoa(max))
+	}
+	args = append(args, r.trackingRef(), "--", r.file())
+
+	out, e := r.git(ctx, nil, nil, args...)
+	if e != nil {
+		return nil, e
+	}
+
+	var commits []commit
+	for _, record := range strings.Split(out, "\x1e") {
+		hash, msg, ok := strings.Cut(strings.TrimSpace(record), "\x1f")
+		if !ok {
+			continue
+		}
+
+		if info, ok := r.parseMessage(msg); ok {
+			commits = append(commits, commit{hash: hash, info: info})
+		}
+	}
+
+	return commits, nil
+}
+
+func (r *GitRemote) message(info remotes.VersionInfo) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Update %s to version %d\n\n", r.database, info.ID)
+	fmt.Fprintf(b, "%s: %d\n", trailerVersion, info.ID)
+	fmt.Fprintf(b, "%s: %s\n", trailerDatabase, info.Database)
+	fmt.Fprintf(b, "%s: %s\n", trailerHost, info.Host)
+	fmt.Fprintf(b, "%s: %s\n", trailerTimestamp, info.Timestamp.Format(time.RFC3339Nano))
+	fmt.Fprintf(b, "%s: %d\n", trailerSize, info.Size)
+	fmt.Fprintf(b, "%s: %s\n", trailerSHA256, info.SHA256)
+	return b.String()
+}
+
+// Parses the version metadata out of the trailers of a commit message, returns false
+// if the commit was not written by keepassxcync for this database.
+func (r *GitRemote) parseMessage(msg string) (remotes.VersionInfo, bool) {
+	trailers := map[string]string{}
+
+	scan := bufio.NewScanner(strings.NewReader(msg))
+	for scan.Scan() {
+		if k, v, ok := strings.Cut(scan.Text(), ": "); ok {
+			trailers[k] = strings.TrimSpace(v)
+		}
+	}
+
+	id, e := strconv.ParseUint(trailers[trailerVersion], 10, 64)
+	if e != nil || id == 0 || trailers[trailerDatabase] != r.database {
+		return remotes.VersionInfo{}, false
+	}
+
+	info := remotes.VersionInfo{
+		ID:       uint(id),
+		Host:     trailers[trailerHost],
+		SHA256:   trailers[trailerSHA256],
+		Database: trailers[trailerDatabase],
+	}
+
+	info.Timestamp, _ = time.Parse(time.RFC3339Nano, trailers[trailerTimestamp])
+	info.Size, _ = strconv.ParseInt(trailers[trailerSize], 10, 64)
+	return info, true
+}
+
+// Returns the environment that sets the identity commits are made with. The identity
+// configured for git is preferred when no identity was given in the options.
+func (r *GitRemote) identity(ctx context.Context) []string {
+	name, email := r.authorName, r.authorEmail
+
+	if name == "" {
+		name, _ = r.git(ctx, nil, nil, "config", "user.name")
+	}
+	if email == "" {
+		email, _ = r.git(ctx, nil, nil, "config", "user.email")
+	}
+
+	if name == "" {
+		name = "keepassxcync"
+	}
+	if email == "" {
+		email = "keepassxcync@" + remotes.Hostname()
+	}
+
+	return []string{
+		"GIT_AUTHOR_NAME=" + name,
+		"GIT_AUTHOR_EMAIL=" + email,
+		"GIT_COMMITTER_NAME=" + name,
+		"GIT_COMMITTER_EMAIL=" + email,
+	}
+}
+
+// Reports whether the porcelain output of a push says that ref was rejected for not being
+// a fast-forward, as opposed to being declined by the server.
+func pushRejected(out, ref string) bool {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 3 && fields[0] == "!" && strings.HasSuffix(fields[1], ":"+ref) && strings.HasPrefix(fields[2], "[rejected]") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *GitRemote) file() string {
+	return r.database + ".kdbx"
+}
+
+func (r *GitRemote) trackingRef() string {
+	return "refs/remotes/origin/" + r.branch
+}
+
+// Runs git within the cache repository and returns its trimmed output.
+func (r *GitRemote) git(ctx context.Context, stdin io.Reader, env []string, args ...string) (string, error) {
+	out, e := r.gitRaw(ctx, stdin, env, args...)
+	return strings.TrimSpace(string(out)), e
+}
+
+func (r *GitRemote) gitRaw(ctx context.Context, stdin io.Reader, env []string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--git-dir", r.cache}, args...)...)
+	cmd.Stdin = stdin
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "LC_ALL=C"), env...)
+
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	// The output is returned along with errors, as some commands report failures on stdout.
+	out, e := cmd.Output()
+	if e != nil {
+		return out, fmt.Errorf("git %s: %w: %s", args[0], e, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,256 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Creates an empty bare repository to act as the remote.
+func newBareRepo(t *testing.T) string {
+	if _, e := exec.LookPath("git"); e != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Keep the configuration of the machine running the tests out of the way.
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	dir := filepath.Join(t.TempDir(), "vaults.git")
+	if out, e := exec.Command("git", "init", "--quiet", "--bare", dir).CombinedOutput(); e != nil {
+		t.Fatalf("git init: %v: %s", e, out)
+	}
+
+	return dir
+}
+
+func newTestRemote(t *testing.T, url string) *GitRemote {
+	r, e := New(&Options{URL: url, Database: "personal", CacheDir: filepath.Join(t.TempDir(), "cache")})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+	return r
+}
+
+func TestGitRemoteVersions(t *testing.T) {
+	ctx := context.Background()
+	repo := newBareRepo(t)
+	r := newTestRemote(t, "file://"+repo)
+
+	if last, e := r.GetLastVersion(ctx); e != nil || last.ID != 0 {
+		t.Fatalf("GetLastVersion() = %v, %v, want 0, nil", last.ID, e)
+	}
+
+	versions := [][]byte{
+		[]byte("first version"),
+		[]byte("second version"),
+		[]byte("third version"),
+	}
+
+	for i, data := range versions {
+		info, e := r.PersistVersion(ctx, bytes.NewReader(data), uint(i))
+		if e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+		if info.ID != uint(i+1) || info.SHA256 != remotes.HashBytes(data) {
+			t.Errorf("PersistVersion() = %+v, unexpected metadata", info)
+		}
+
+		last, e := r.GetLastVersion(ctx)
+		if e != nil {
+			t.Fatalf("GetLastVersion() error = %v", e)
+		}
+		if last.ID != info.ID || last.SHA256 != info.SHA256 || last.Size != info.Size || !last.Timestamp.Equal(info.Timestamp) {
+			t.Errorf("GetLastVersion() = %+v, want %+v", last, info)
+		}
+	}
+
+	for i, want := range versions {
+		body, info, e := r.GetVersion(ctx, uint(i+1))
+		if e != nil {
+			t.Fatalf("GetVersion(%d) error = %v", i+1, e)
+		}
+
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if !bytes.Equal(got, want) || info.SHA256 != remotes.HashBytes(want) {
+			t.Errorf("GetVersion(%d) = %q, %+v, want %q", i+1, got, info, want)
+		}
+	}
+
+	if _, _, e := r.GetVersion(ctx, 42); !errors.Is(e, remotes.ErrVersionNotFound) {
+		t.Errorf("GetVersion(42) error = %v, want %v", e, remotes.ErrVersionNotFound)
+	}
+
+	page, e := r.ListVersions(ctx, 1, 10)
+	if e != nil {
+		t.Fatalf("ListVersions() error = %v", e)
+	}
+
+	var ids []uint
+	for _, v := range page {
+		ids = append(ids, v.ID)
+	}
+	if !reflect.DeepEqual(ids, []uint{2, 3}) {
+		t.Errorf("ListVersions() = %v, want %v", ids, []uint{2, 3})
+	}
+
+	// Every version should be its own commit on the branch of the bare repository.
+	out, e := exec.Command("git", "--git-dir", repo, "rev-list", "--count", "main").Output()
+	if e != nil || strings.TrimSpace(string(out)) != "3" {
+		t.Errorf("rev-list --count main = %q, %v, want 3", out, e)
+	}
+}
+
+func TestGitRemoteSharedRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := newBareRepo(t)
+
+	// Two devices with their own caches, plus a second database in the same repository.
+	a := newTestRemote(t, repo)
+	b := newTestRemote(t, repo)
+	other, e := New(&Options{URL: repo, Database: "work", CacheDir: filepath.Join(t.TempDir(), "cache")})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+
+	steps := []struct {
+		remote *GitRemote
+		data   string
+		parent uint
+	}{
+		{remote: a, data: "from a", parent: 0},
+		{remote: other, data: "work db", parent: 0},
+		{remote: b, data: "from b", parent: 1},
+		{remote: a, data: "from a again", parent: 2},
+	}
+
+	for _, step := range steps {
+		if _, e := step.remote.PersistVersion(ctx, strings.NewReader(step.data), step.parent); e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		remote *GitRemote
+		want   uint
+		data   string
+	}{
+		{
+			name:   "1",
+			remote: a,
+			want:   3,
+			data:   "from a again",
+		},
+		{
+			name:   "2",
+			remote: b,
+			want:   3,
+			data:   "from a again",
+		},
+		{
+			name:   "3",
+			remote: other,
+			want:   1,
+			data:   "work db",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last, e := tt.remote.GetLastVersion(ctx)
+			if e != nil || last.ID != tt.want {
+				t.Errorf("GetLastVersion() = %v, %v, want %v", last.ID, e, tt.want)
+				return
+			}
+
+			body, _, e := tt.remote.GetVersion(ctx, last.ID)
+			if e != nil {
+				t.Errorf("GetVersion() error = %v", e)
+				return
+			}
+
+			got, _ := io.ReadAll(body)
+			if string(got) != tt.data {
+				t.Errorf("GetVersion() = %q, want %q", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestGitRemoteConflict(t *testing.T) {
+	ctx := context.Background()
+	repo := newBareRepo(t)
+
+	a := newTestRemote(t, repo)
+	b := newTestRemote(t, repo)
+
+	if _, e := a.PersistVersion(ctx, strings.NewReader("laptop"), 0); e != nil {
+		t.Fatalf("PersistVersion() error = %v", e)
+	}
+
+	_, e := b.PersistVersion(ctx, strings.NewReader("desktop"), 0)
+	var conflict *remotes.ConflictError
+	if !errors.As(e, &conflict) || conflict.Actual != 1 {
+		t.Fatalf("PersistVersion() error = %v, want conflict with version 1", e)
+	}
+
+	if last, e := b.GetLastVersion(ctx); e != nil || last.SHA256 != remotes.HashBytes([]byte("laptop")) {
+		t.Errorf("GetLastVersion() = %+v, %v, want the version of a", last, e)
+	}
+}
+
+func TestGitRemoteRejectedPush(t *testing.T) {
+	ctx := context.Background()
+	repo := newBareRepo(t)
+
+	a := newTestRemote(t, repo)
+	b := newTestRemote(t, repo)
+
+	if _, e := a.PersistVersion(ctx, strings.NewReader("first"), 0); e != nil {
+		t.Fatalf("PersistVersion() error = %v", e)
+	}
+
+	// The other clone pushes after b checked the remote, but before b pushes.
+	b.beforePush = func() {
+		if _, e := a.PersistVersion(ctx, strings.NewReader("laptop"), 1); e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+	}
+
+	_, e := b.PersistVersion(ctx, strings.NewReader("desktop"), 1)
+	var conflict *remotes.ConflictError
+	if !errors.As(e, &conflict) || conflict.Expected != 1 {
+		t.Fatalf("PersistVersion() error = %v, want conflict based on version 1", e)
+	}
+
+	if last, e := b.GetLastVersion(ctx); e != nil || last.ID != 2 || last.SHA256 != remotes.HashBytes([]byte("laptop")) {
+		t.Errorf("GetLastVersion() = %+v, %v, want the version of a", last, e)
+	}
+}
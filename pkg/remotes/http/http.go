@@ -0,0 +1,310 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+// Package http implements a remote that speaks a small REST protocol, so that
+// keepassxcync can be pointed at simple self-hosted services and gateways.
+//
+// All paths are relative to the configured base URL, and {db} is the name of the database.
+// Every request carries an "Authorization: Bearer <token>" header when a token is configured.
+//
+//	GET  {base}/{db}
+//	HEAD {base}/{db}
+//		Returns the latest version, or 404 if no versions exist yet.
+//	GET  {base}/{db}/versions/{id}
+//		Returns a specific version, or 404 if it does not exist.
+//	PUT  {base}/{db}
+//		Stores the request body as the next version and responds with 201 and the
+//		metadata of the new version as a JSON object. The request carries either
+//		"If-Match" with the ETag of the latest version the client has seen, or
+//		"If-None-Match: *" when the client expects no versions to exist. If the
+//		precondition does not hold the server must respond with 412 and store nothing.
+//	GET  {base}/{db}/versions?after={id}&limit={n}
+//		Returns a JSON array with the metadata of up to n versions with an ID
+//		greater than id, in ascending order.
+//
+// Responses carrying the contents of a version set the ETag header to the quoted version ID,
+// along with the metadata headers below. PUT requests set the Host, SHA256 and Timestamp headers
+// to describe the uploaded contents. JSON metadata uses the field names of remotes.VersionInfo.
+//
+//	Keepassxcync-Version: 3
+//	Keepassxcync-Timestamp: 2023-08-20T17:04:05.123456789Z
+//	Keepassxcync-Size: 2046
+//	Keepassxcync-SHA256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+//	Keepassxcync-Host: laptop
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Headers that version metadata is transferred in.
+const (
+	HeaderVersion   string = "Keepassxcync-Version"
+	HeaderTimestamp string = "Keepassxcync-Timestamp"
+	HeaderSize      string = "Keepassxcync-Size"
+	HeaderSHA256    string = "Keepassxcync-SHA256"
+	HeaderHost      string = "Keepassxcync-Host"
+)
+
+// Options for constructing a new HTTPRemote.
+type Options struct {
+	// Base URL of the service.
+	URL string
+	// Name of the database that is being versioned on this remote.
+	Database string
+	// Token for bearer authentication.
+	Token string
+	// HTTP client to issue requests with, defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+var _ remotes.Remote = &HTTPRemote{}
+
+func init() {
+	remotes.Register(config.RemoteTypeHTTP, func(ctx context.Context, conf *config.KeepassxCyncRemote, database string) (remotes.Remote, error) {
+		return New(&Options{
+			URL:      conf.HTTP.URL,
+			Database: database,
+			Token:    conf.HTTP.Token,
+		})
+	})
+}
+
+// HTTPRemote stores versions of a database on a service that implements
+// the protocol described in the package documentation.
+type HTTPRemote struct {
+	client *http.Client
+
+	base     *url.URL
+	database string
+	token    string
+}
+
+func New(opts *Options) (*HTTPRemote, error) {
+	if opts.URL == "" {
+		return nil, errors.New("http remote requires a url")
+	}
+
+	if opts.Database == "" {
+		return nil, errors.New("http remote requires a database name")
+	}
+
+	base, e := url.Parse(opts.URL)
+	if e != nil {
+		return nil, e
+	}
+
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("http remote url must be http or https, not %q", base.Scheme)
+	}
+
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/" + opts.Database
+
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HTTPRemote{
+		client:   client,
+		base:     base,
+		database: opts.Database,
+		token:    opts.Token,
+	}, nil
+}
+
+func (r *HTTPRemote) PersistVersion(ctx context.Context, data io.Reader, parent uint) (remotes.VersionInfo, error) {
+	body, e := io.ReadAll(data)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	info := remotes.NewVersionInfo(r.database, body)
+
+	headers := map[string]string{
+		"Content-Type":  "application/octet-stream",
+		HeaderHost:      info.Host,
+		HeaderSHA256:    info.SHA256,
+		HeaderTimestamp: info.Timestamp.Format(time.RFC3339Nano),
+	}
+
+	// The server checks the precondition and stores the version atomically.
+	if parent == 0 {
+		headers["If-None-Match"] = "*"
+	} else {
+		headers["If-Match"] = etag(parent)
+	}
+
+	res, e := r.do(ctx, http.MethodPut, r.base, bytes.NewReader(body), headers)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusPreconditionFailed:
+		return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent}
+	default:
+		return remotes.VersionInfo{}, statusError(res)
+	}
+
+	stored := remotes.VersionInfo{}
+	if e := json.NewDecoder(res.Body).Decode(&stored); e != nil {
+		return remotes.VersionInfo{}, fmt.Errorf("unable to parse metadata of new version: %w", e)
+	}
+
+	return stored, nil
+}
+
+func (r *HTTPRemote) GetVersion(ctx context.Context, id uint) (io.ReadCloser, remotes.VersionInfo, error) {
+	res, e := r.do(ctx, http.MethodGet, r.path("versions", strconv.FormatUint(uint64(id), 10)), nil, nil)
+	if e != nil {
+		return nil, remotes.VersionInfo{}, e
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, remotes.VersionInfo{}, statusError(res)
+	}
+
+	info, e := r.parseHeaders(res)
+	if e != nil {
+		res.Body.Close()
+		return nil, remotes.VersionInfo{}, e
+	}
+
+	return res.Body, info, nil
+}
+
+func (r *HTTPRemote) GetLastVersion(ctx context.Context) (remotes.VersionInfo, error) {
+	res, e := r.do(ctx, http.MethodHead, r.base, nil, nil)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return r.parseHeaders(res)
+	case http.StatusNotFound:
+		// Nothing has been pushed to this remote yet.
+		return remotes.VersionInfo{}, nil
+	default:
+		return remotes.VersionInfo{}, statusError(res)
+	}
+}
+
+func (r *HTTPRemote) ListVersions(ctx context.Context, after uint, limit int) ([]remotes.VersionInfo, error) {
+	u := r.path("versions")
+	u.RawQuery = url.Values{
+		"after": {strconv.FormatUint(uint64(after), 10)},
+		"limit": {strconv.Itoa(limit)},
+	}.Encode()
+
+	res, e := r.do(ctx, http.MethodGet, u, nil, map[string]string{"Accept": "application/json"})
+	if e != nil {
+		return nil, e
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(res)
+	}
+
+	var versions []remotes.VersionInfo
+	if e := json.NewDecoder(res.Body).Decode(&versions); e != nil {
+		return nil, fmt.Errorf("unable to parse version list: %w", e)
+	}
+
+	for i := range versions {
+		if versions[i].Database == "" {
+			versions[i].Database = r.database
+		}
+	}
+
+	return versions, nil
+}
+
+// Reads the version metadata from the headers of a response.
+func (r *HTTPRemote) parseHeaders(res *http.Response) (remotes.VersionInfo, error) {
+	id, e := strconv.ParseUint(res.Header.Get(HeaderVersion), 10, 64)
+	if e != nil {
+		return remotes.VersionInfo{}, fmt.Errorf("response is missing a valid %s header", HeaderVersion)
+	}
+
+	info := remotes.VersionInfo{
+		ID:       uint(id),
+		SHA256:   res.Header.Get(HeaderSHA256),
+		Host:     res.Header.Get(HeaderHost),
+		Database: r.database,
+	}
+
+	info.Timestamp, _ = time.Parse(time.RFC3339Nano, res.Header.Get(HeaderTimestamp))
+	info.Size, _ = strconv.ParseInt(res.Header.Get(HeaderSize), 10, 64)
+	return info, nil
+}
+
+func (r *HTTPRemote) do(ctx context.Context, method string, u *url.URL, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, e := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if e != nil {
+		return nil, e
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	return r.client.Do(req)
+}
+
+func (r *HTTPRemote) path(elem ...string) *url.URL {
+	u := *r.base
+	u.Path += "/" + strings.Join(elem, "/")
+	return &u
+}
+
+// Returns the ETag that identifies a version.
+func etag(id uint) string {
+	return `"` + strconv.FormatUint(uint64(id), 10) + `"`
+}
+
+func statusError(res *http.Response) error {
+	if res.StatusCode == http.StatusNotFound {
+		return remotes.ErrVersionNotFound
+	}
+
+	return fmt.Errorf("http %s %s failed: %s", res.Request.Method, res.Request.URL.Redacted(), res.Status)
+}
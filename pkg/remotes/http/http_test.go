@@ -0,0 +1,293 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// In-memory implementation of the server side of the protocol.
+type testServer struct {
+	mu       sync.Mutex
+	token    string
+	versions map[string][]testVersion
+}
+
+type testVersion struct {
+	info remotes.VersionInfo
+	data []byte
+}
+
+func newTestServer(t *testing.T, token string) (*testServer, string) {
+	s := &testServer{token: token, versions: map[string][]testVersion{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv.URL + "/api/v1"
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/"), "/")
+	db := parts[0]
+	versions := s.versions[db]
+
+	switch {
+	case len(parts) == 1 && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		if len(versions) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.writeVersion(w, r, versions[len(versions)-1])
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		var current string
+		if len(versions) > 0 {
+			current = `"` + strconv.Itoa(int(versions[len(versions)-1].info.ID)) + `"`
+		}
+
+		if (r.Header.Get("If-None-Match") == "*" && current != "") || (r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != current) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		data, _ := io.ReadAll(r.Body)
+		ts, _ := time.Parse(time.RFC3339Nano, r.Header.Get(HeaderTimestamp))
+		v := testVersion{data: data, info: remotes.VersionInfo{
+			ID:        uint(len(versions) + 1),
+			Timestamp: ts,
+			Size:      int64(len(data)),
+			SHA256:    r.Header.Get(HeaderSHA256),
+			Host:      r.Header.Get(HeaderHost),
+			Database:  db,
+		}}
+		s.versions[db] = append(versions, v)
+
+		w.Header().Set("ETag", `"`+strconv.Itoa(int(v.info.ID))+`"`)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(v.info)
+	case len(parts) == 2 && parts[1] == "versions" && r.Method == http.MethodGet:
+		after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+		list := []remotes.VersionInfo{}
+		for _, v := range versions {
+			if int(v.info.ID) > after && len(list) < limit {
+				list = append(list, v.info)
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+	case len(parts) == 3 && parts[1] == "versions" && r.Method == http.MethodGet:
+		id, e := strconv.Atoi(parts[2])
+		if e != nil || id < 1 || id > len(versions) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.writeVersion(w, r, versions[id-1])
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *testServer) writeVersion(w http.ResponseWriter, r *http.Request, v testVersion) {
+	w.Header().Set("ETag", `"`+strconv.Itoa(int(v.info.ID))+`"`)
+	w.Header().Set(HeaderVersion, strconv.Itoa(int(v.info.ID)))
+	w.Header().Set(HeaderTimestamp, v.info.Timestamp.Format(time.RFC3339Nano))
+	w.Header().Set(HeaderSize, strconv.Itoa(len(v.data)))
+	w.Header().Set(HeaderSHA256, v.info.SHA256)
+	w.Header().Set(HeaderHost, v.info.Host)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(v.data)
+	}
+}
+
+func TestHTTPRemoteVersions(t *testing.T) {
+	ctx := context.Background()
+	_, base := newTestServer(t, "s3cr3t")
+
+	r, e := New(&Options{URL: base, Database: "personal", Token: "s3cr3t"})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+
+	if last, e := r.GetLastVersion(ctx); e != nil || last.ID != 0 {
+		t.Fatalf("GetLastVersion() = %v, %v, want 0, nil", last.ID, e)
+	}
+
+	versions := [][]byte{
+		[]byte("first version"),
+		[]byte("second version"),
+		[]byte("third version"),
+	}
+
+	for i, data := range versions {
+		info, e := r.PersistVersion(ctx, bytes.NewReader(data), uint(i))
+		if e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+		if info.ID != uint(i+1) || info.SHA256 != remotes.HashBytes(data) {
+			t.Errorf("PersistVersion() = %+v, unexpected metadata", info)
+		}
+
+		last, e := r.GetLastVersion(ctx)
+		if e != nil {
+			t.Fatalf("GetLastVersion() error = %v", e)
+		}
+		if last.ID != info.ID || last.SHA256 != info.SHA256 || last.Size != info.Size || !last.Timestamp.Equal(info.Timestamp) {
+			t.Errorf("GetLastVersion() = %+v, want %+v", last, info)
+		}
+	}
+
+	for i, want := range versions {
+		body, info, e := r.GetVersion(ctx, uint(i+1))
+		if e != nil {
+			t.Fatalf("GetVersion(%d) error = %v", i+1, e)
+		}
+
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if !bytes.Equal(got, want) || info.SHA256 != remotes.HashBytes(want) {
+			t.Errorf("GetVersion(%d) = %q, %+v, want %q", i+1, got, info, want)
+		}
+	}
+
+	if _, _, e := r.GetVersion(ctx, 42); !errors.Is(e, remotes.ErrVersionNotFound) {
+		t.Errorf("GetVersion(42) error = %v, want %v", e, remotes.ErrVersionNotFound)
+	}
+
+	page, e := r.ListVersions(ctx, 0, 2)
+	if e != nil {
+		t.Fatalf("ListVersions() error = %v", e)
+	}
+
+	var ids []uint
+	for _, v := range page {
+		ids = append(ids, v.ID)
+	}
+	if !reflect.DeepEqual(ids, []uint{1, 2}) {
+		t.Errorf("ListVersions() = %v, want %v", ids, []uint{1, 2})
+	}
+}
+
+func TestHTTPRemoteAuth(t *testing.T) {
+	_, base := newTestServer(t, "s3cr3t")
+
+	r, e := New(&Options{URL: base, Database: "personal", Token: "wrong"})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+
+	if _, e := r.PersistVersion(context.Background(), strings.NewReader("data"), 0); e == nil {
+		t.Errorf("PersistVersion() error = nil, want unauthorized error")
+	}
+}
+
+func TestHTTPRemoteConditionalUpload(t *testing.T) {
+	ctx := context.Background()
+	srv, base := newTestServer(t, "s3cr3t")
+
+	r, e := New(&Options{URL: base, Database: "personal", Token: "s3cr3t"})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+
+	// Wrap the client so that another device sneaks a version in between the
+	// client looking up the latest version and uploading the next one.
+	r.client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method == http.MethodPut {
+			srv.mu.Lock()
+			srv.versions["personal"] = append(srv.versions["personal"], testVersion{
+				info: remotes.VersionInfo{ID: uint(len(srv.versions["personal"]) + 1)},
+			})
+			srv.mu.Unlock()
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+
+	if _, e := r.PersistVersion(ctx, strings.NewReader("data"), 0); !remotes.IsConflict(e) {
+		t.Errorf("PersistVersion() error = %v, want conflict", e)
+	}
+
+	if n := len(srv.versions["personal"]); n != 1 {
+		t.Errorf("server holds %d versions, want 1", n)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{
+			name:    "1",
+			opts:    &Options{URL: "https://vault.example.com/api", Database: "personal"},
+			wantErr: false,
+		},
+		{
+			name:    "2",
+			opts:    &Options{URL: "ftp://vault.example.com/api", Database: "personal"},
+			wantErr: true,
+		},
+		{
+			name:    "3",
+			opts:    &Options{Database: "personal"},
+			wantErr: true,
+		},
+		{
+			name:    "4",
+			opts:    &Options{URL: "https://vault.example.com/api"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -20,14 +20,65 @@ package remotes
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 )
 
+// Returned by GetVersion when the requested version does not exist on the remote.
+var ErrVersionNotFound = errors.New("version not found on remote")
+
+// Returned by PersistVersion when the latest version on the remote is no longer the
+// version the upload was based on, because another device pushed in the meantime.
+type ConflictError struct {
+	// Version the upload was based on.
+	Expected uint
+	// Latest version on the remote, or 0 if the remote could not tell.
+	Actual uint
+}
+
+func (e *ConflictError) Error() string {
+	if e.Actual == 0 {
+		return fmt.Sprintf("version %d is no longer the latest version on the remote", e.Expected)
+	}
+
+	return fmt.Sprintf("remote is at version %d, but the upload was based on version %d", e.Actual, e.Expected)
+}
+
+// Reports whether any error in the tree of e is a *ConflictError.
+func IsConflict(e error) bool {
+	var conflict *ConflictError
+	return errors.As(e, &conflict)
+}
+
 // A remote should be considered an object store that is able to store all
 // versions of the database that are uploaded to it, and be able to reference
 // a specific version, including the latest version on that remote.
+//
+// Versions are numbered starting at 1, and each call to PersistVersion stores
+// the data as the next version. A latest version with an ID of 0 means the remote
+// does not hold any versions of the database yet.
 type Remote interface {
-	PersistVersion(ctx context.Context, data io.WriteCloser) error
-	GetVersion(ctx context.Context, version uint) (io.ReadCloser, error)
-	GetLastVersion(ctx context.Context) (uint, error)
+	// Store the contents of data as the next version of the database, and
+	// return the metadata that was recorded alongside it. Parent is the ID of the
+	// latest version the caller has seen, or 0 if it expects the remote to be empty.
+	// If parent is no longer the latest version nothing is stored, and a *ConflictError
+	// is returned. The check and the write must be atomic, so that of two devices
+	// uploading on top of the same parent only one succeeds.
+	PersistVersion(ctx context.Context, data io.Reader, parent uint) (VersionInfo, error)
+	// Open the contents of a specific version along with its metadata.
+	GetVersion(ctx context.Context, id uint) (io.ReadCloser, VersionInfo, error)
+	// Return the metadata of the newest version on the remote.
+	GetLastVersion(ctx context.Context) (VersionInfo, error)
+	// Return up to limit versions with an ID greater than after, in ascending order.
+	// Callers page through history by passing the ID of the last version they received.
+	ListVersions(ctx context.Context, after uint, limit int) ([]VersionInfo, error)
+}
+
+// Deleter is an optional capability of a remote, for remotes that are able to remove
+// individual versions. The latest version must never be deleted, as new versions are
+// numbered after it.
+type Deleter interface {
+	// Remove a version along with its metadata, or return ErrVersionNotFound if it does not exist.
+	DeleteVersion(ctx context.Context, id uint) error
 }
@@ -0,0 +1,108 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package remotes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Returned by Renew and Unlock when the lease is no longer held by the caller,
+// because it was taken over or broken in the meantime.
+var ErrLeaseLost = errors.New("lease is no longer held")
+
+// Lease on the database of a remote, held by a single device while it writes. Leases are
+// advisory, they keep well behaved writers from interleaving but are not enforced by the remote.
+type Lease struct {
+	// Random token that identifies the holder, so that a holder never mistakes
+	// a lease taken over by another device for its own.
+	ID string `json:"id" yaml:"id"`
+	// Hostname of the device holding the lease.
+	Owner string `json:"owner" yaml:"owner"`
+	// Time the lease was first acquired.
+	Acquired time.Time `json:"acquired" yaml:"acquired"`
+	// Time after which the lease is considered stale, unless it is renewed.
+	Expires time.Time `json:"expires" yaml:"expires"`
+}
+
+// Builds a new lease for owner that expires after ttl.
+func NewLease(owner string, ttl time.Duration) (Lease, error) {
+	id := make([]byte, 16)
+	if _, e := rand.Read(id); e != nil {
+		return Lease{}, fmt.Errorf("unable to generate lease id: %w", e)
+	}
+
+	now := time.Now().UTC()
+	return Lease{ID: hex.EncodeToString(id), Owner: owner, Acquired: now, Expires: now.Add(ttl)}, nil
+}
+
+// Decodes a stored lease. A lease that is empty or cannot be parsed, such as one left behind
+// by a device that crashed while writing it, is returned as an expired lease of an unknown
+// owner, so that it can be taken over or broken.
+func DecodeLease(data []byte) Lease {
+	lease := Lease{}
+	if e := json.Unmarshal(data, &lease); e != nil || lease.ID == "" {
+		return Lease{Owner: "unknown device"}
+	}
+
+	return lease
+}
+
+// Reports whether the lease has expired at now.
+func (l Lease) Expired(now time.Time) bool {
+	return !now.Before(l.Expires)
+}
+
+// Returned by Lock when another device holds the lease.
+type LockedError struct {
+	Lease Lease
+	// Whether the lease has expired, in which case it can be taken over.
+	Stale bool
+}
+
+func (e *LockedError) Error() string {
+	if e.Stale {
+		return fmt.Sprintf("remote is locked by %s with a lease that expired at %s", e.Lease.Owner, e.Lease.Expires.Local().Format(time.RFC3339))
+	}
+
+	return fmt.Sprintf("remote is locked by %s until %s", e.Lease.Owner, e.Lease.Expires.Local().Format(time.RFC3339))
+}
+
+// Locker is an optional capability of a remote, for remotes that are able to store a lease
+// object next to the versions of a database and replace it atomically.
+type Locker interface {
+	// Acquire the lease for owner for the duration of ttl. If another device holds an active
+	// lease a *LockedError is returned. An expired lease of another device is only taken over
+	// if takeover is set, otherwise a *LockedError with Stale set is returned.
+	Lock(ctx context.Context, owner string, ttl time.Duration, takeover bool) (Lease, error)
+	// Extend a held lease by ttl from now, or return ErrLeaseLost if it is no longer held.
+	Renew(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error)
+	// Release a held lease, or return ErrLeaseLost if it is no longer held.
+	Unlock(ctx context.Context, lease Lease) error
+	// Return the current lease, or nil if the database is not locked.
+	CurrentLease(ctx context.Context) (*Lease, error)
+	// Remove the current lease regardless of who holds it, for leases left behind by
+	// devices that are gone. Breaking a lock that does not exist is not an error.
+	BreakLock(ctx context.Context) error
+}
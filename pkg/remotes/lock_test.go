@@ -0,0 +1,66 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package remotes
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecodeLease(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		wantID    string
+		wantOwner string
+	}{
+		{
+			name:      "1",
+			data:      []byte(`{"id":"abc","owner":"laptop","acquired":"2023-01-01T00:00:00Z","expires":"2100-01-01T00:00:00Z"}`),
+			wantID:    "abc",
+			wantOwner: "laptop",
+		},
+		{
+			name:      "2",
+			data:      []byte{},
+			wantOwner: "unknown device",
+		},
+		{
+			name:      "3",
+			data:      []byte(`{"id":"ab`),
+			wantOwner: "unknown device",
+		},
+		{
+			name:      "4",
+			data:      []byte(`{}`),
+			wantOwner: "unknown device",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DecodeLease(tt.data)
+			if got.ID != tt.wantID || got.Owner != tt.wantOwner {
+				t.Errorf("DecodeLease() = %+v, want id %q of %q", got, tt.wantID, tt.wantOwner)
+			}
+			if got.Expired(time.Now()) != (tt.wantID == "") {
+				t.Errorf("DecodeLease().Expired() = %v, want %v", got.Expired(time.Now()), tt.wantID == "")
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package remotes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+)
+
+// Constructs a remote for database from a remote config entry. Factories can
+// assume that the config has already been validated.
+type Factory func(ctx context.Context, conf *config.KeepassxCyncRemote, database string) (Remote, error)
+
+var (
+	registryLock sync.RWMutex
+	registry     map[string]Factory = map[string]Factory{}
+)
+
+// Registers the factory for a remote type, backends call this from their init function.
+// Registering the same type twice panics, as it is a programming error.
+func Register(t string, f Factory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if _, ok := registry[t]; ok {
+		panic("remote type " + t + " is registered twice")
+	}
+
+	registry[t] = f
+}
+
+// Returns the remote types that have a registered factory.
+func Registered() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	var types []string
+	for t := range registry {
+		types = append(types, t)
+	}
+
+	sort.Strings(types)
+	return types
+}
+
+// Validates a remote config entry and builds the remote it describes for database.
+func New(ctx context.Context, conf *config.KeepassxCyncRemote, database string) (Remote, error) {
+	if e := conf.Validate(); e != nil {
+		return nil, e
+	}
+
+	registryLock.RLock()
+	f, ok := registry[conf.Type]
+	registryLock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("remote type %s is not supported by this build", conf.Type)
+	}
+
+	return f(ctx, conf, database)
+}
@@ -0,0 +1,74 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package remotes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+)
+
+func TestNew(t *testing.T) {
+	// The backends are not linked into this test, so only the factory registered here exists.
+	var built string
+	Register(config.RemoteTypeFS, func(ctx context.Context, conf *config.KeepassxCyncRemote, database string) (Remote, error) {
+		built = conf.Name + "/" + database
+		return nil, nil
+	})
+	defer func() {
+		registryLock.Lock()
+		delete(registry, config.RemoteTypeFS)
+		registryLock.Unlock()
+	}()
+
+	tests := []struct {
+		name    string
+		conf    *config.KeepassxCyncRemote
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "1",
+			conf: &config.KeepassxCyncRemote{Name: "nas", Type: config.RemoteTypeFS, FS: &config.FSRemoteConfig{Dir: "/mnt"}},
+			want: "nas/personal",
+		},
+		{
+			name:    "2",
+			conf:    &config.KeepassxCyncRemote{Name: "nas", Type: config.RemoteTypeFS},
+			wantErr: true,
+		},
+		{
+			name:    "3",
+			conf:    &config.KeepassxCyncRemote{Name: "aws", Type: config.RemoteTypeS3, S3: &config.S3RemoteConfig{Bucket: "vault"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			built = ""
+			if _, err := New(context.Background(), tt.conf, "personal"); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if built != tt.want {
+				t.Errorf("New() built %q, want %q", built, tt.want)
+			}
+		})
+	}
+}
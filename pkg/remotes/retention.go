@@ -0,0 +1,93 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package remotes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+)
+
+// Returns the versions that policy does not keep at now, in the order they were given.
+// Versions must be in ascending order, as returned by ListAllVersions.
+func Prunable(policy *config.RetentionPolicy, versions []VersionInfo, now time.Time) ([]VersionInfo, error) {
+	if policy.Empty() || len(versions) == 0 {
+		return nil, nil
+	}
+
+	maxAge, e := policy.MaxAgeDuration()
+	if e != nil {
+		return nil, e
+	}
+
+	keep := make([]bool, len(versions))
+	if !policy.HasKeepRules() {
+		for i := range keep {
+			keep[i] = true
+		}
+	}
+
+	for i := len(versions) - 1; i >= 0 && i >= len(versions)-policy.KeepLast; i-- {
+		keep[i] = true
+	}
+
+	// Calendar boundaries are those of the local time zone of now.
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	keepPeriods(versions, keep, policy.KeepDaily, today.AddDate(0, 0, 1-policy.KeepDaily), now.Location(), func(t time.Time) string {
+		return t.Format("2006-01-02")
+	})
+
+	week := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	keepPeriods(versions, keep, policy.KeepWeekly, week.AddDate(0, 0, -7*(policy.KeepWeekly-1)), now.Location(), func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+
+	var prunable []VersionInfo
+	for i, v := range versions {
+		expired := maxAge > 0 && now.Sub(v.Timestamp) > maxAge
+		if i != len(versions)-1 && (!keep[i] || expired) {
+			prunable = append(prunable, v)
+		}
+	}
+
+	return prunable, nil
+}
+
+// Marks the last version of every period since start as kept, where period
+// returns the key of the period a timestamp falls into.
+func keepPeriods(versions []VersionInfo, keep []bool, count int, start time.Time, loc *time.Location, period func(time.Time) string) {
+	if count <= 0 {
+		return
+	}
+
+	seen := map[string]bool{}
+	for i := len(versions) - 1; i >= 0; i-- {
+		t := versions[i].Timestamp.In(loc)
+		if t.Before(start) {
+			continue
+		}
+
+		if key := period(t); !seen[key] {
+			seen[key] = true
+			keep[i] = true
+		}
+	}
+}
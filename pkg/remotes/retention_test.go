@@ -0,0 +1,115 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package remotes
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+)
+
+func TestPrunable(t *testing.T) {
+	// A Sunday, so that the current week started on the 14th.
+	now := time.Date(2023, 8, 20, 12, 0, 0, 0, time.UTC)
+
+	at := func(times ...time.Time) []VersionInfo {
+		var versions []VersionInfo
+		for i, ts := range times {
+			versions = append(versions, VersionInfo{ID: uint(i + 1), Timestamp: ts})
+		}
+		return versions
+	}
+
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	day := func(d, h int) time.Time { return time.Date(2023, 8, d, h, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name     string
+		policy   *config.RetentionPolicy
+		versions []VersionInfo
+		want     []uint
+	}{
+		{
+			name:     "1",
+			policy:   nil,
+			versions: at(ago(time.Hour), ago(time.Minute)),
+			want:     nil,
+		},
+		{
+			name:     "2",
+			policy:   &config.RetentionPolicy{KeepLast: 2},
+			versions: at(ago(5*time.Hour), ago(4*time.Hour), ago(3*time.Hour), ago(2*time.Hour), ago(time.Hour)),
+			want:     []uint{1, 2, 3},
+		},
+		{
+			name:     "3",
+			policy:   &config.RetentionPolicy{KeepDaily: 2},
+			versions: at(day(18, 10), day(19, 9), day(19, 18), day(20, 8), day(20, 11)),
+			want:     []uint{1, 2, 4},
+		},
+		{
+			name:     "4",
+			policy:   &config.RetentionPolicy{KeepWeekly: 2},
+			versions: at(day(1, 10), day(8, 10), day(10, 10), day(15, 10), day(19, 10)),
+			want:     []uint{1, 2, 4},
+		},
+		{
+			name:     "5",
+			policy:   &config.RetentionPolicy{MaxAge: "48h"},
+			versions: at(ago(72*time.Hour), ago(24*time.Hour), ago(time.Hour)),
+			want:     []uint{1},
+		},
+		{
+			name:     "6",
+			policy:   &config.RetentionPolicy{KeepLast: 3, MaxAge: "48h"},
+			versions: at(ago(100*time.Hour), ago(72*time.Hour), ago(24*time.Hour), ago(time.Hour)),
+			want:     []uint{1, 2},
+		},
+		{
+			name:     "7",
+			policy:   &config.RetentionPolicy{MaxAge: "1h"},
+			versions: at(ago(3*time.Hour), ago(2*time.Hour)),
+			want:     []uint{1},
+		},
+		{
+			name:     "8",
+			policy:   &config.RetentionPolicy{KeepLast: 1, KeepDaily: 1},
+			versions: at(day(19, 10), day(20, 9), day(20, 10)),
+			want:     []uint{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prunable, err := Prunable(tt.policy, tt.versions, now)
+			if err != nil {
+				t.Fatalf("Prunable() error = %v", err)
+			}
+
+			var got []uint
+			for _, v := range prunable {
+				got = append(got, v.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Prunable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
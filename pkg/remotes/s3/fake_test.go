@@ -0,0 +1,234 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Minimal in-process implementation of the S3 API, only supporting the path-style
+// object operations that S3Remote depends on.
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]*fakeObject
+	// Called with the lock held before an object is stored, so tests can race a write.
+	beforePut func(key string)
+}
+
+type fakeObject struct {
+	data     []byte
+	meta     http.Header
+	modified time.Time
+}
+
+type fakeListResult struct {
+	XMLName               xml.Name          `xml:"ListBucketResult"`
+	Name                  string            `xml:"Name"`
+	Prefix                string            `xml:"Prefix"`
+	KeyCount              int               `xml:"KeyCount"`
+	MaxKeys               int               `xml:"MaxKeys"`
+	IsTruncated           bool              `xml:"IsTruncated"`
+	NextContinuationToken string            `xml:"NextContinuationToken,omitempty"`
+	Contents              []fakeListContent `xml:"Contents"`
+}
+
+type fakeListContent struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+}
+
+type fakeError struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func newFakeS3(t *testing.T, bucket string) *Options {
+	_, opts := newFakeS3Server(t, bucket)
+	return opts
+}
+
+func newFakeS3Server(t *testing.T, bucket string) (*fakeS3, *Options) {
+	f := &fakeS3{bucket: bucket, objects: map[string]*fakeObject{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	return f, &Options{
+		Endpoint:        srv.URL,
+		Region:          "us-east-1",
+		Bucket:          bucket,
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		UsePathStyle:    true,
+	}
+}
+
+func newTestRemote(t *testing.T, opts *Options) *S3Remote {
+	r, e := New(context.Background(), opts)
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+	return r
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		f.error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	switch {
+	case key == "" && req.Method == http.MethodGet:
+		f.list(w, req)
+	case req.Method == http.MethodPut:
+		data, e := io.ReadAll(req.Body)
+		if e != nil {
+			f.error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		if f.beforePut != nil {
+			f.beforePut(key)
+		}
+		if !f.precondition(key, req) {
+			f.error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		meta := http.Header{}
+		for k, v := range req.Header {
+			if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+				meta[k] = v
+			}
+		}
+		f.objects[key] = &fakeObject{data: data, meta: meta, modified: time.Now().UTC()}
+		w.Header().Set("ETag", etag(data))
+		w.WriteHeader(http.StatusOK)
+	case req.Method == http.MethodGet || req.Method == http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			f.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		for k, v := range obj.meta {
+			w.Header()[k] = v
+		}
+		w.Header().Set("ETag", etag(obj.data))
+		w.Header().Set("Last-Modified", obj.modified.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.WriteHeader(http.StatusOK)
+		if req.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case req.Method == http.MethodDelete:
+		if !f.precondition(key, req) {
+			f.error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// Evaluates the If-None-Match and If-Match conditions of a write against the current object.
+func (f *fakeS3) precondition(key string, req *http.Request) bool {
+	obj, ok := f.objects[key]
+	if req.Header.Get("If-None-Match") == "*" && ok {
+		return false
+	}
+
+	if match := req.Header.Get("If-Match"); match != "" && (!ok || etag(obj.data) != match) {
+		return false
+	}
+
+	return true
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	prefix := q.Get("prefix")
+	after := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		after = token
+	}
+
+	max := 1000
+	if m, e := strconv.Atoi(q.Get("max-keys")); e == nil && m > 0 {
+		max = m
+	}
+
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) && k > after {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	res := &fakeListResult{Name: f.bucket, Prefix: prefix, MaxKeys: max}
+	if len(keys) > max {
+		keys = keys[:max]
+		res.IsTruncated = true
+		res.NextContinuationToken = keys[len(keys)-1]
+	}
+
+	for _, k := range keys {
+		obj := f.objects[k]
+		res.Contents = append(res.Contents, fakeListContent{
+			Key:          k,
+			LastModified: obj.modified.Format(time.RFC3339),
+			ETag:         etag(obj.data),
+			Size:         len(obj.data),
+		})
+	}
+	res.KeyCount = len(res.Contents)
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(res)
+}
+
+func (f *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(&fakeError{Code: code, Message: code})
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,190 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Name of the object under the prefix of the database that holds the current lease.
+const lockName string = ".lock"
+
+var _ remotes.Locker = &S3Remote{}
+
+func (r *S3Remote) Lock(ctx context.Context, owner string, ttl time.Duration, takeover bool) (remotes.Lease, error) {
+	lease, e := remotes.NewLease(owner, ttl)
+	if e != nil {
+		return remotes.Lease{}, e
+	}
+
+	// A lease that is released between failing to create the lock and reading
+	// it back is retried a few times before giving up.
+	for attempt := 0; attempt < 3; attempt++ {
+		e := r.putLease(ctx, lease, "If-None-Match", "*")
+		if e == nil {
+			return lease, nil
+		} else if !preconditionFailed(e) {
+			return remotes.Lease{}, e
+		}
+
+		current, tag, e := r.getLease(ctx)
+		if errors.Is(e, remotes.ErrVersionNotFound) {
+			continue
+		} else if e != nil {
+			return remotes.Lease{}, e
+		}
+
+		if !current.Expired(time.Now()) || !takeover {
+			return remotes.Lease{}, &remotes.LockedError{Lease: current, Stale: current.Expired(time.Now())}
+		}
+
+		// Replacing the stale lease is conditional on its ETag, so only one device wins a takeover.
+		if e := r.putLease(ctx, lease, "If-Match", tag); e == nil {
+			return lease, nil
+		} else if !preconditionFailed(e) {
+			return remotes.Lease{}, e
+		}
+	}
+
+	return remotes.Lease{}, errors.New("unable to acquire lease, the lock keeps changing")
+}
+
+func (r *S3Remote) Renew(ctx context.Context, lease remotes.Lease, ttl time.Duration) (remotes.Lease, error) {
+	tag, e := r.checkLease(ctx, lease)
+	if e != nil {
+		return remotes.Lease{}, e
+	}
+
+	lease.Expires = time.Now().UTC().Add(ttl)
+	if e := r.putLease(ctx, lease, "If-Match", tag); e != nil {
+		if preconditionFailed(e) {
+			return remotes.Lease{}, remotes.ErrLeaseLost
+		}
+		return remotes.Lease{}, e
+	}
+
+	return lease, nil
+}
+
+func (r *S3Remote) Unlock(ctx context.Context, lease remotes.Lease) error {
+	tag, e := r.checkLease(ctx, lease)
+	if e != nil {
+		return e
+	}
+
+	_, e = r.s3client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.lockKey()),
+	}, s3.WithAPIOptions(smithyhttp.AddHeaderValue("If-Match", tag)))
+	if preconditionFailed(e) {
+		return remotes.ErrLeaseLost
+	}
+
+	return e
+}
+
+func (r *S3Remote) CurrentLease(ctx context.Context) (*remotes.Lease, error) {
+	lease, _, e := r.getLease(ctx)
+	if errors.Is(e, remotes.ErrVersionNotFound) {
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+
+	return &lease, nil
+}
+
+func (r *S3Remote) BreakLock(ctx context.Context) error {
+	// Deleting a key that does not exist succeeds on S3.
+	_, e := r.s3client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.lockKey()),
+	})
+
+	return e
+}
+
+// Returns the ETag of the lock, or ErrLeaseLost unless lease is the lease currently stored in it.
+func (r *S3Remote) checkLease(ctx context.Context, lease remotes.Lease) (string, error) {
+	current, tag, e := r.getLease(ctx)
+	if errors.Is(e, remotes.ErrVersionNotFound) || (e == nil && current.ID != lease.ID) {
+		return "", remotes.ErrLeaseLost
+	}
+
+	return tag, e
+}
+
+// Writes lease to the lock, conditional on the given precondition header.
+func (r *S3Remote) putLease(ctx context.Context, lease remotes.Lease, header, value string) error {
+	data, e := json.Marshal(lease)
+	if e != nil {
+		return e
+	}
+
+	_, e = r.s3client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(r.bucket),
+		Key:         aws.String(r.lockKey()),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}, s3.WithAPIOptions(smithyhttp.AddHeaderValue(header, value)))
+
+	return e
+}
+
+// Reads the current lease along with the ETag of the lock object.
+func (r *S3Remote) getLease(ctx context.Context) (remotes.Lease, string, error) {
+	out, e := r.s3client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.lockKey()),
+	})
+	if e != nil {
+		return remotes.Lease{}, "", translateError(e)
+	}
+	defer out.Body.Close()
+
+	data, e := io.ReadAll(out.Body)
+	if e != nil {
+		return remotes.Lease{}, "", e
+	}
+
+	return remotes.DecodeLease(data), aws.ToString(out.ETag), nil
+}
+
+func (r *S3Remote) lockKey() string {
+	return r.prefix + lockName
+}
+
+// Reports whether a conditional request was rejected. A 409 is returned
+// when a conflicting conditional write is still in flight.
+func preconditionFailed(e error) bool {
+	var re *awshttp.ResponseError
+	return errors.As(e, &re) && (re.HTTPStatusCode() == http.StatusPreconditionFailed || re.HTTPStatusCode() == http.StatusConflict)
+}
@@ -0,0 +1,116 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+func TestS3RemoteLock(t *testing.T) {
+	ctx := context.Background()
+	opts := newFakeS3(t, "vaults")
+	opts.Database = "personal"
+	r := newTestRemote(t, opts)
+
+	if current, e := r.CurrentLease(ctx); e != nil || current != nil {
+		t.Fatalf("CurrentLease() = %v, %v, want nil, nil", current, e)
+	}
+
+	lease, e := r.Lock(ctx, "laptop", time.Minute, false)
+	if e != nil {
+		t.Fatalf("Lock() error = %v", e)
+	}
+
+	if current, e := r.CurrentLease(ctx); e != nil || current == nil || current.ID != lease.ID || current.Owner != "laptop" {
+		t.Fatalf("CurrentLease() = %v, %v, want lease of laptop", current, e)
+	}
+
+	// An active lease is never taken over.
+	var locked *remotes.LockedError
+	if _, e := r.Lock(ctx, "desktop", time.Minute, true); !errors.As(e, &locked) || locked.Stale || locked.Lease.Owner != "laptop" {
+		t.Fatalf("Lock() error = %v, want active lease of laptop", e)
+	}
+
+	renewed, e := r.Renew(ctx, lease, time.Hour)
+	if e != nil {
+		t.Fatalf("Renew() error = %v", e)
+	}
+	if !renewed.Expires.After(lease.Expires) {
+		t.Errorf("Renew() expires %v, want after %v", renewed.Expires, lease.Expires)
+	}
+
+	if e := r.Unlock(ctx, renewed); e != nil {
+		t.Fatalf("Unlock() error = %v", e)
+	}
+
+	if e := r.Unlock(ctx, renewed); !errors.Is(e, remotes.ErrLeaseLost) {
+		t.Errorf("Unlock() error = %v, want %v", e, remotes.ErrLeaseLost)
+	}
+
+	if _, e := r.Lock(ctx, "desktop", time.Minute, false); e != nil {
+		t.Errorf("Lock() after Unlock() error = %v", e)
+	}
+}
+
+func TestS3RemoteLockTakeover(t *testing.T) {
+	ctx := context.Background()
+	opts := newFakeS3(t, "vaults")
+	opts.Database = "personal"
+	r := newTestRemote(t, opts)
+
+	stale, e := r.Lock(ctx, "laptop", -time.Second, false)
+	if e != nil {
+		t.Fatalf("Lock() error = %v", e)
+	}
+
+	var locked *remotes.LockedError
+	if _, e := r.Lock(ctx, "desktop", time.Minute, false); !errors.As(e, &locked) || !locked.Stale {
+		t.Fatalf("Lock() error = %v, want stale lease", e)
+	}
+
+	lease, e := r.Lock(ctx, "desktop", time.Minute, true)
+	if e != nil {
+		t.Fatalf("Lock() with takeover error = %v", e)
+	}
+
+	if _, e := r.Renew(ctx, stale, time.Minute); !errors.Is(e, remotes.ErrLeaseLost) {
+		t.Errorf("Renew() of taken over lease error = %v, want %v", e, remotes.ErrLeaseLost)
+	}
+
+	if current, e := r.CurrentLease(ctx); e != nil || current == nil || current.ID != lease.ID {
+		t.Fatalf("CurrentLease() = %v, %v, want lease of desktop", current, e)
+	}
+
+	if e := r.BreakLock(ctx); e != nil {
+		t.Fatalf("BreakLock() error = %v", e)
+	}
+
+	if e := r.BreakLock(ctx); e != nil {
+		t.Errorf("BreakLock() without lock error = %v", e)
+	}
+
+	if current, e := r.CurrentLease(ctx); e != nil || current != nil {
+		t.Errorf("CurrentLease() = %v, %v, want nil, nil", current, e)
+	}
+}
@@ -19,43 +19,328 @@
 package s3
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"io"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
 )
 
+// User metadata keys that version information is recorded under.
+const (
+	metaSHA256    string = "sha256"
+	metaHost      string = "host"
+	metaTimestamp string = "timestamp"
+	metaDatabase  string = "database"
+)
+
+// Options for constructing a new S3Remote.
+type Options struct {
+	// Endpoint of the S3 compatible API, leave empty to use AWS.
+	Endpoint string
+	// Region to sign requests for.
+	Region string
+	// Bucket that versions are stored within.
+	Bucket string
+	// Optional key prefix for all objects written by this remote.
+	Prefix string
+	// Name of the database that is being versioned on this remote.
+	Database string
+	// Static credentials, if left empty the default AWS credential chain is used.
+	AccessKeyID     string
+	SecretAccessKey string
+	// Address the bucket by path rather than by virtual host, which
+	// is required by most self-hosted S3 implementations.
+	UsePathStyle bool
+}
+
+var (
+	_ remotes.Remote  = &S3Remote{}
+	_ remotes.Deleter = &S3Remote{}
+)
+
+func init() {
+	remotes.Register(config.RemoteTypeS3, func(ctx context.Context, conf *config.KeepassxCyncRemote, database string) (remotes.Remote, error) {
+		return New(ctx, &Options{
+			Endpoint:        conf.S3.Endpoint,
+			Region:          conf.S3.Region,
+			Bucket:          conf.S3.Bucket,
+			Prefix:          conf.S3.Prefix,
+			Database:        database,
+			AccessKeyID:     conf.S3.AccessKeyID,
+			SecretAccessKey: conf.S3.SecretAccessKey,
+			UsePathStyle:    conf.S3.UsePathStyle,
+		})
+	})
+}
+
+// S3Remote stores every version of a database as its own object under
+// <prefix>/<database>/<version>.kdbx, with the version number zero-padded
+// so that lexical ordering of keys matches version ordering.
 type S3Remote struct {
 	cfg aws.Config
 
 	s3client *s3.Client
+
+	bucket   string
+	prefix   string
+	database string
 }
 
-func New() (*S3Remote, error) {
-	c, e := config.LoadDefaultConfig(context.Background())
+func New(ctx context.Context, opts *Options) (*S3Remote, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("s3 remote requires a bucket")
+	}
+
+	if opts.Database == "" {
+		return nil, errors.New("s3 remote requires a database name")
+	}
+
+	var loadOpts []func(*awsconfig.LoadOptions) error
+	if opts.Region != "" {
+		loadOpts = append(loadOpts, awsconfig.WithRegion(opts.Region))
+	}
+
+	if opts.AccessKeyID != "" || opts.SecretAccessKey != "" {
+		loadOpts = append(loadOpts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretAccessKey, ""),
+		))
+	}
+
+	c, e := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
 	if e != nil {
 		return nil, e
 	}
 
-	client := s3.NewFromConfig(c)
-	return &S3Remote{cfg: c, s3client: client}, nil
+	client := s3.NewFromConfig(c, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+	})
+
+	return &S3Remote{
+		cfg:      c,
+		s3client: client,
+		bucket:   opts.Bucket,
+		prefix:   path.Join(opts.Prefix, opts.Database) + "/",
+		database: opts.Database,
+	}, nil
+}
+
+func (r *S3Remote) PersistVersion(ctx context.Context, data io.Reader, parent uint) (remotes.VersionInfo, error) {
+	last, e := r.lastVersionID(ctx)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	if last != parent {
+		return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent, Actual: last}
+	}
+
+	// Buffer the data so that the SDK is able to seek over the body when
+	// computing the payload signature.
+	body, e := io.ReadAll(data)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	info := remotes.NewVersionInfo(r.database, body)
+	info.ID = parent + 1
+
+	// The key of the next version is claimed with a conditional write, which S3
+	// rejects if another writer already stored this version. The SDK version in
+	// use predates the IfNoneMatch input field, so the header is added directly.
+	_, e = r.s3client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:   aws.String(r.bucket),
+		Key:      aws.String(r.versionKey(info.ID)),
+		Body:     bytes.NewReader(body),
+		Metadata: encodeMetadata(info),
+	}, s3.WithAPIOptions(smithyhttp.AddHeaderValue("If-None-Match", "*")))
+	if e != nil {
+		if preconditionFailed(e) {
+			return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent, Actual: info.ID}
+		}
+		return remotes.VersionInfo{}, e
+	}
+
+	return info, nil
 }
 
-func (r *S3Remote) PersistVersion(ctx context.Context, data io.WriteCloser) error {
-	_, e := r.s3client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{})
+func (r *S3Remote) GetVersion(ctx context.Context, id uint) (io.ReadCloser, remotes.VersionInfo, error) {
+	out, e := r.s3client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.versionKey(id)),
+	})
 	if e != nil {
+		return nil, remotes.VersionInfo{}, translateError(e)
+	}
+
+	return out.Body, r.decodeMetadata(id, out.ContentLength, out.LastModified, out.Metadata), nil
+}
+
+func (r *S3Remote) GetLastVersion(ctx context.Context) (remotes.VersionInfo, error) {
+	last, e := r.lastVersionID(ctx)
+	if e != nil || last == 0 {
+		return remotes.VersionInfo{}, e
+	}
+
+	return r.headVersion(ctx, last)
+}
+
+func (r *S3Remote) ListVersions(ctx context.Context, after uint, limit int) ([]remotes.VersionInfo, error) {
+	var versions []remotes.VersionInfo
+
+	pages := s3.NewListObjectsV2Paginator(r.s3client, &s3.ListObjectsV2Input{
+		Bucket:     aws.String(r.bucket),
+		Prefix:     aws.String(r.prefix),
+		StartAfter: aws.String(r.versionKey(after)),
+	})
+
+	for pages.HasMorePages() && len(versions) < limit {
+		page, e := pages.NextPage(ctx)
+		if e != nil {
+			return nil, e
+		}
+
+		for _, obj := range page.Contents {
+			id, ok := r.parseKey(aws.ToString(obj.Key))
+			if !ok || id <= after {
+				continue
+			}
+
+			// Listing does not return user metadata, so every version has to be looked up.
+			info, e := r.headVersion(ctx, id)
+			if e != nil {
+				return nil, e
+			}
+
+			versions = append(versions, info)
+			if len(versions) == limit {
+				break
+			}
+		}
+	}
+
+	return versions, nil
+}
+
+func (r *S3Remote) DeleteVersion(ctx context.Context, id uint) error {
+	// Deleting a key that does not exist succeeds on S3, so it has to be looked up first.
+	if _, e := r.headVersion(ctx, id); e != nil {
 		return e
 	}
 
-	return nil
+	_, e := r.s3client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.versionKey(id)),
+	})
+
+	return e
+}
+
+func (r *S3Remote) headVersion(ctx context.Context, id uint) (remotes.VersionInfo, error) {
+	out, e := r.s3client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.versionKey(id)),
+	})
+	if e != nil {
+		return remotes.VersionInfo{}, translateError(e)
+	}
+
+	return r.decodeMetadata(id, out.ContentLength, out.LastModified, out.Metadata), nil
 }
 
-func (r *S3Remote) GetVersion(ctx context.Context, version uint) (io.ReadCloser, error) {
-	return nil, nil
+// Finds the number of the newest version object under the prefix of this remote.
+func (r *S3Remote) lastVersionID(ctx context.Context) (uint, error) {
+	var last uint
+
+	pages := s3.NewListObjectsV2Paginator(r.s3client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(r.bucket),
+		Prefix: aws.String(r.prefix),
+	})
+
+	for pages.HasMorePages() {
+		page, e := pages.NextPage(ctx)
+		if e != nil {
+			return 0, e
+		}
+
+		for _, obj := range page.Contents {
+			if v, ok := r.parseKey(aws.ToString(obj.Key)); ok && v > last {
+				last = v
+			}
+		}
+	}
+
+	return last, nil
 }
 
-func (r *S3Remote) GetLastVersion(ctx context.Context) (uint, error) {
-	return 0, nil
+func (r *S3Remote) versionKey(version uint) string {
+	return r.prefix + remotes.VersionName(version, remotes.VersionSuffix)
+}
+
+// Returns the version number encoded within an object key, or false if the key
+// is not a version object of this remote.
+func (r *S3Remote) parseKey(key string) (uint, bool) {
+	name, ok := strings.CutPrefix(key, r.prefix)
+	if !ok {
+		return 0, false
+	}
+
+	return remotes.ParseVersionName(name)
+}
+
+func encodeMetadata(info remotes.VersionInfo) map[string]string {
+	return map[string]string{
+		metaSHA256:    info.SHA256,
+		metaHost:      info.Host,
+		metaTimestamp: info.Timestamp.Format(time.RFC3339Nano),
+		metaDatabase:  info.Database,
+	}
+}
+
+// Rebuilds version metadata from the user metadata of an object. Objects written by other
+// tools will be missing metadata, in which case the object properties are used where possible.
+func (r *S3Remote) decodeMetadata(id uint, size int64, modified *time.Time, meta map[string]string) remotes.VersionInfo {
+	info := remotes.VersionInfo{
+		ID:       id,
+		Size:     size,
+		SHA256:   meta[metaSHA256],
+		Host:     meta[metaHost],
+		Database: meta[metaDatabase],
+	}
+
+	if ts, e := time.Parse(time.RFC3339Nano, meta[metaTimestamp]); e == nil {
+		info.Timestamp = ts
+	} else if modified != nil {
+		info.Timestamp = *modified
+	}
+
+	if info.Database == "" {
+		info.Database = r.database
+	}
+
+	return info
+}
+
+func translateError(e error) error {
+	var nsk *types.NoSuchKey
+	var nf *types.NotFound
+	if errors.As(e, &nsk) || errors.As(e, &nf) {
+		return remotes.ErrVersionNotFound
+	}
+
+	return e
 }
@@ -0,0 +1,298 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+func TestS3RemoteVersions(t *testing.T) {
+	ctx := context.Background()
+	opts := newFakeS3(t, "vaults")
+	opts.Database = "personal"
+	r := newTestRemote(t, opts)
+
+	if last, e := r.GetLastVersion(ctx); e != nil || last.ID != 0 {
+		t.Fatalf("GetLastVersion() = %v, %v, want 0, nil", last.ID, e)
+	}
+
+	versions := [][]byte{
+		[]byte("first version"),
+		[]byte("second version"),
+		[]byte("third version"),
+	}
+
+	for i, data := range versions {
+		info, e := r.PersistVersion(ctx, bytes.NewReader(data), uint(i))
+		if e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+		if info.ID != uint(i+1) || info.SHA256 != remotes.HashBytes(data) || info.Size != int64(len(data)) {
+			t.Errorf("PersistVersion() = %+v, unexpected metadata", info)
+		}
+
+		last, e := r.GetLastVersion(ctx)
+		if e != nil {
+			t.Fatalf("GetLastVersion() error = %v", e)
+		}
+		if last.ID != info.ID || last.SHA256 != info.SHA256 || last.Host != info.Host || !last.Timestamp.Equal(info.Timestamp) {
+			t.Errorf("GetLastVersion() = %+v, want %+v", last, info)
+		}
+	}
+
+	for i, want := range versions {
+		body, info, e := r.GetVersion(ctx, uint(i+1))
+		if e != nil {
+			t.Fatalf("GetVersion(%d) error = %v", i+1, e)
+		}
+
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if !bytes.Equal(got, want) {
+			t.Errorf("GetVersion(%d) = %q, want %q", i+1, got, want)
+		}
+		if info.SHA256 != remotes.HashBytes(want) || info.Database != "personal" {
+			t.Errorf("GetVersion(%d) metadata = %+v", i+1, info)
+		}
+	}
+
+	if _, _, e := r.GetVersion(ctx, 42); !errors.Is(e, remotes.ErrVersionNotFound) {
+		t.Errorf("GetVersion(42) error = %v, want %v", e, remotes.ErrVersionNotFound)
+	}
+}
+
+func TestS3RemoteListVersions(t *testing.T) {
+	ctx := context.Background()
+	opts := newFakeS3(t, "vaults")
+	opts.Database = "personal"
+	r := newTestRemote(t, opts)
+
+	for i := 0; i < 7; i++ {
+		if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte{byte(i)}), uint(i)); e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		after uint
+		limit int
+		want  []uint
+	}{
+		{
+			name:  "1",
+			after: 0,
+			limit: 3,
+			want:  []uint{1, 2, 3},
+		},
+		{
+			name:  "2",
+			after: 3,
+			limit: 3,
+			want:  []uint{4, 5, 6},
+		},
+		{
+			name:  "3",
+			after: 6,
+			limit: 3,
+			want:  []uint{7},
+		},
+		{
+			name:  "4",
+			after: 7,
+			limit: 3,
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := r.ListVersions(ctx, tt.after, tt.limit)
+			if e != nil {
+				t.Errorf("ListVersions() error = %v", e)
+				return
+			}
+
+			var ids []uint
+			for _, v := range got {
+				ids = append(ids, v.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("ListVersions() = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	all, e := remotes.ListAllVersions(ctx, r)
+	if e != nil || len(all) != 7 {
+		t.Errorf("ListAllVersions() = %d versions, %v, want 7", len(all), e)
+	}
+}
+
+func TestS3RemoteDatabaseIsolation(t *testing.T) {
+	ctx := context.Background()
+	opts := newFakeS3(t, "vaults")
+
+	a, b := *opts, *opts
+	a.Database, b.Database = "work", "work-old"
+	a.Prefix, b.Prefix = "team", "team"
+
+	ra := newTestRemote(t, &a)
+	rb := newTestRemote(t, &b)
+
+	for i := 0; i < 3; i++ {
+		if _, e := ra.PersistVersion(ctx, bytes.NewReader([]byte("a")), uint(i)); e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+	}
+
+	if _, e := rb.PersistVersion(ctx, bytes.NewReader([]byte("b")), 0); e != nil {
+		t.Fatalf("PersistVersion() error = %v", e)
+	}
+
+	tests := []struct {
+		name   string
+		remote *S3Remote
+		want   uint
+	}{
+		{
+			name:   "1",
+			remote: ra,
+			want:   3,
+		},
+		{
+			name:   "2",
+			remote: rb,
+			want:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, e := tt.remote.GetLastVersion(ctx)
+			if e != nil {
+				t.Errorf("GetLastVersion() error = %v", e)
+				return
+			}
+			if got.ID != tt.want {
+				t.Errorf("GetLastVersion() = %v, want %v", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{
+			name:    "1",
+			opts:    &Options{Bucket: "vaults", Database: "personal", Region: "us-east-1"},
+			wantErr: false,
+		},
+		{
+			name:    "2",
+			opts:    &Options{Database: "personal"},
+			wantErr: true,
+		},
+		{
+			name:    "3",
+			opts:    &Options{Bucket: "vaults"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(context.Background(), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestS3RemoteConflict(t *testing.T) {
+	ctx := context.Background()
+	f, opts := newFakeS3Server(t, "vaults")
+	opts.Database = "personal"
+	r := newTestRemote(t, opts)
+
+	if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte("laptop")), 0); e != nil {
+		t.Fatalf("PersistVersion() error = %v", e)
+	}
+
+	_, e := r.PersistVersion(ctx, bytes.NewReader([]byte("desktop")), 0)
+	var conflict *remotes.ConflictError
+	if !errors.As(e, &conflict) || conflict.Actual != 1 {
+		t.Fatalf("PersistVersion() error = %v, want conflict with version 1", e)
+	}
+
+	// Another device stores version 2 after the check, so only the conditional write catches it.
+	f.beforePut = func(key string) {
+		f.objects[key] = &fakeObject{data: []byte("phone"), meta: http.Header{}, modified: time.Now()}
+		f.beforePut = nil
+	}
+
+	if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte("laptop again")), 1); !remotes.IsConflict(e) {
+		t.Fatalf("PersistVersion() error = %v, want conflict", e)
+	}
+
+	if got := string(f.objects["personal/00000000000000000002.kdbx"].data); got != "phone" {
+		t.Errorf("version 2 = %q, want %q", got, "phone")
+	}
+}
+
+func TestS3RemoteDeleteVersion(t *testing.T) {
+	ctx := context.Background()
+	opts := newFakeS3(t, "vaults")
+	opts.Database = "personal"
+	r := newTestRemote(t, opts)
+
+	for i, data := range []string{"first", "second", "third"} {
+		if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte(data)), uint(i)); e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+	}
+
+	if e := r.DeleteVersion(ctx, 1); e != nil {
+		t.Fatalf("DeleteVersion() error = %v", e)
+	}
+
+	if e := r.DeleteVersion(ctx, 1); !errors.Is(e, remotes.ErrVersionNotFound) {
+		t.Errorf("DeleteVersion() error = %v, want %v", e, remotes.ErrVersionNotFound)
+	}
+
+	versions, e := remotes.ListAllVersions(ctx, r)
+	if e != nil || len(versions) != 2 || versions[0].ID != 2 {
+		t.Fatalf("ListAllVersions() = %+v, %v, want versions 2 and 3", versions, e)
+	}
+
+	if next, e := r.PersistVersion(ctx, bytes.NewReader([]byte("fourth")), 3); e != nil || next.ID != 4 {
+		t.Errorf("PersistVersion() = %v, %v, want 4", next.ID, e)
+	}
+}
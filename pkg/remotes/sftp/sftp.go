@@ -0,0 +1,490 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// Time allowed for establishing the SSH connection.
+	dialTimeout time.Duration = 30 * time.Second
+)
+
+// Options for constructing a new SFTPRemote.
+type Options struct {
+	// Address of the SSH server, as host or host:port.
+	Host string
+	// User to log in as.
+	User string
+	// Path to the private key used for authentication.
+	KeyFile string
+	// Passphrase of the private key, if it is encrypted.
+	KeyPassphrase string
+	// Path to the known_hosts file the server key is verified against,
+	// defaults to ~/.ssh/known_hosts.
+	KnownHostsFile string
+	// Base directory on the server that versions are stored within.
+	Dir string
+	// Name of the database that is being versioned on this remote.
+	Database string
+}
+
+var (
+	_ remotes.Remote  = &SFTPRemote{}
+	_ remotes.Deleter = &SFTPRemote{}
+)
+
+func init() {
+	remotes.Register(config.RemoteTypeSFTP, func(ctx context.Context, conf *config.KeepassxCyncRemote, database string) (remotes.Remote, error) {
+		return New(&Options{
+			Host:           conf.SFTP.Host,
+			User:           conf.SFTP.User,
+			KeyFile:        conf.SFTP.KeyFile,
+			KeyPassphrase:  conf.SFTP.KeyPassphrase,
+			KnownHostsFile: conf.SFTP.KnownHostsFile,
+			Dir:            conf.SFTP.Dir,
+			Database:       database,
+		})
+	})
+}
+
+// SFTPRemote stores every version of a database as its own file under
+// <dir>/<database>/<version>.kdbx on an SSH server, with a <version>.json
+// file alongside it that holds the version metadata.
+type SFTPRemote struct {
+	addr   string
+	config *ssh.ClientConfig
+
+	dir      string
+	database string
+
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+	// Closed once the session of client ended, such as when the server dropped it.
+	lost chan struct{}
+}
+
+func New(opts *Options) (*SFTPRemote, error) {
+	switch {
+	case opts.Host == "":
+		return nil, errors.New("sftp remote requires a host")
+	case opts.User == "":
+		return nil, errors.New("sftp remote requires a user")
+	case opts.KeyFile == "":
+		return nil, errors.New("sftp remote requires a private key file")
+	case opts.Dir == "":
+		return nil, errors.New("sftp remote requires a base directory")
+	case opts.Database == "":
+		return nil, errors.New("sftp remote requires a database name")
+	}
+
+	key, e := os.ReadFile(config.ExpandPath(opts.KeyFile))
+	if e != nil {
+		return nil, e
+	}
+
+	var signer ssh.Signer
+	if opts.KeyPassphrase != "" {
+		signer, e = ssh.ParsePrivateKeyWithPassphrase(key, []byte(opts.KeyPassphrase))
+	} else {
+		signer, e = ssh.ParsePrivateKey(key)
+	}
+	if e != nil {
+		return nil, fmt.Errorf("unable to parse private key %s: %w", opts.KeyFile, e)
+	}
+
+	knownHostsFile := opts.KnownHostsFile
+	if knownHostsFile == "" {
+		knownHostsFile = "~/.ssh/known_hosts"
+	}
+
+	hostKeys, e := knownhosts.New(config.ExpandPath(knownHostsFile))
+	if e != nil {
+		return nil, fmt.Errorf("unable to load known hosts: %w", e)
+	}
+
+	addr := opts.Host
+	if _, _, e := net.SplitHostPort(addr); e != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+
+	return &SFTPRemote{
+		addr: addr,
+		config: &ssh.ClientConfig{
+			User:            opts.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeys,
+			Timeout:         dialTimeout,
+		},
+		dir:      path.Join(opts.Dir, opts.Database),
+		database: opts.Database,
+	}, nil
+}
+
+// Close the connection to the server, if one was opened.
+func (r *SFTPRemote) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		return nil
+	}
+
+	r.client.Close()
+	e := r.conn.Close()
+	r.client, r.conn = nil, nil
+	return e
+}
+
+func (r *SFTPRemote) PersistVersion(ctx context.Context, data io.Reader, parent uint) (remotes.VersionInfo, error) {
+	client, e := r.connect(ctx)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	if e := client.MkdirAll(r.dir); e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	last, e := r.lastVersionID(client)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	if last != parent {
+		return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent, Actual: last}
+	}
+
+	body, e := io.ReadAll(data)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	info := remotes.NewVersionInfo(r.database, body)
+	info.ID = parent + 1
+
+	meta, e := remotes.EncodeSidecar(info)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	// Hard linking the version file into place fails if another writer already stored this version.
+	if e := writeExclusive(client, r.path(info.ID, remotes.VersionSuffix), body); e != nil {
+		if errors.Is(e, os.ErrExist) {
+			return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent, Actual: info.ID}
+		}
+		return remotes.VersionInfo{}, e
+	}
+
+	if e := writeAtomic(client, r.path(info.ID, remotes.MetaSuffix), meta); e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	return info, nil
+}
+
+func (r *SFTPRemote) GetVersion(ctx context.Context, id uint) (io.ReadCloser, remotes.VersionInfo, error) {
+	client, e := r.connect(ctx)
+	if e != nil {
+		return nil, remotes.VersionInfo{}, e
+	}
+
+	info, e := r.statVersion(client, id)
+	if e != nil {
+		return nil, remotes.VersionInfo{}, e
+	}
+
+	file, e := client.Open(r.path(id, remotes.VersionSuffix))
+	if e != nil {
+		return nil, remotes.VersionInfo{}, translateError(e)
+	}
+
+	return file, info, nil
+}
+
+func (r *SFTPRemote) GetLastVersion(ctx context.Context) (remotes.VersionInfo, error) {
+	client, e := r.connect(ctx)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	last, e := r.lastVersionID(client)
+	if e != nil || last == 0 {
+		return remotes.VersionInfo{}, e
+	}
+
+	return r.statVersion(client, last)
+}
+
+func (r *SFTPRemote) ListVersions(ctx context.Context, after uint, limit int) ([]remotes.VersionInfo, error) {
+	client, e := r.connect(ctx)
+	if e != nil {
+		return nil, e
+	}
+
+	ids, e := r.versionIDs(client)
+	if e != nil {
+		return nil, e
+	}
+
+	var versions []remotes.VersionInfo
+	for _, id := range ids {
+		if id <= after {
+			continue
+		}
+
+		if len(versions) == limit {
+			break
+		}
+
+		info, e := r.statVersion(client, id)
+		if e != nil {
+			return nil, e
+		}
+
+		versions = append(versions, info)
+	}
+
+	return versions, nil
+}
+
+// Removes a version along with its sidecar metadata.
+func (r *SFTPRemote) DeleteVersion(ctx context.Context, id uint) error {
+	client, e := r.connect(ctx)
+	if e != nil {
+		return e
+	}
+
+	// The version file goes first, a sidecar left behind without it is never read.
+	if e := client.Remove(r.path(id, remotes.VersionSuffix)); e != nil {
+		return translateError(e)
+	}
+
+	if e := client.Remove(r.path(id, remotes.MetaSuffix)); e != nil && !os.IsNotExist(e) {
+		return e
+	}
+
+	return nil
+}
+
+// Returns the SFTP session for this remote, dialing the server if there is none yet.
+func (r *SFTPRemote) connect(ctx context.Context) (*sftp.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.client != nil {
+		select {
+		case <-r.lost:
+			// The server dropped the session since it was last used, dial it again.
+			r.client.Close()
+			r.conn.Close()
+			r.client, r.conn = nil, nil
+		default:
+			return r.client, nil
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	nc, e := dialer.DialContext(ctx, "tcp", r.addr)
+	if e != nil {
+		return nil, e
+	}
+
+	c, chans, reqs, e := ssh.NewClientConn(nc, r.addr, r.config)
+	if e != nil {
+		nc.Close()
+		return nil, e
+	}
+
+	conn := ssh.NewClient(c, chans, reqs)
+	client, e := sftp.NewClient(conn)
+	if e != nil {
+		conn.Close()
+		return nil, e
+	}
+
+	lost := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(lost)
+	}()
+
+	r.conn, r.client, r.lost = conn, client, lost
+	return client, nil
+}
+
+// Downloads the sidecar metadata of a version. Versions whose sidecar has not been
+// written yet have their metadata rebuilt from the file itself.
+func (r *SFTPRemote) statVersion(client *sftp.Client, id uint) (remotes.VersionInfo, error) {
+	file, e := client.Open(r.path(id, remotes.MetaSuffix))
+	if errors.Is(e, os.ErrNotExist) {
+		return r.rebuildVersion(client, id)
+	} else if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+	defer file.Close()
+
+	meta, e := io.ReadAll(file)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	return remotes.DecodeSidecar(id, meta)
+}
+
+func (r *SFTPRemote) rebuildVersion(client *sftp.Client, id uint) (remotes.VersionInfo, error) {
+	file, e := client.Open(r.path(id, remotes.VersionSuffix))
+	if e != nil {
+		return remotes.VersionInfo{}, translateError(e)
+	}
+	defer file.Close()
+
+	stat, e := file.Stat()
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	data, e := io.ReadAll(file)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	return remotes.RebuildVersionInfo(r.database, id, stat.ModTime(), data), nil
+}
+
+func (r *SFTPRemote) lastVersionID(client *sftp.Client) (uint, error) {
+	ids, e := r.versionIDs(client)
+	if e != nil || len(ids) == 0 {
+		return 0, e
+	}
+
+	return ids[len(ids)-1], nil
+}
+
+// Returns the number of every version file within the directory, in ascending order.
+func (r *SFTPRemote) versionIDs(client *sftp.Client) ([]uint, error) {
+	entries, e := client.ReadDir(r.dir)
+	if e != nil {
+		if errors.Is(e, os.ErrNotExist) {
+			// Nothing has been pushed to this remote yet.
+			return nil, nil
+		}
+		return nil, e
+	}
+
+	var ids []uint
+	for _, entry := range entries {
+		if id, ok := remotes.ParseVersionName(entry.Name()); ok && entry.Mode().IsRegular() {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (r *SFTPRemote) path(id uint, suffix string) string {
+	return path.Join(r.dir, remotes.VersionName(id, suffix))
+}
+
+// Uploads data to a temporary file next to p and then renames it into place,
+// so that readers never observe a partially written file.
+func writeAtomic(client *sftp.Client, p string, data []byte) error {
+	tmp, e := writeTemp(client, p, data)
+	if e != nil {
+		return e
+	}
+
+	// Prefer the OpenSSH extension, as plain SFTP renames are not guaranteed to be atomic.
+	if e := client.PosixRename(tmp, p); e != nil {
+		if e := client.Rename(tmp, p); e != nil {
+			client.Remove(tmp)
+			return e
+		}
+	}
+
+	return nil
+}
+
+// Like writeAtomic, but fails with an error matching os.ErrExist if p already exists.
+func writeExclusive(client *sftp.Client, p string, data []byte) error {
+	tmp, e := writeTemp(client, p, data)
+	if e != nil {
+		return e
+	}
+	defer client.Remove(tmp)
+
+	if e := client.Link(tmp, p); e != nil {
+		// Servers report a failed link in different ways, so check for the target.
+		if _, se := client.Lstat(p); se == nil {
+			return os.ErrExist
+		}
+		return e
+	}
+
+	return nil
+}
+
+// Uploads data to a temporary file next to p and returns its path.
+func writeTemp(client *sftp.Client, p string, data []byte) (string, error) {
+	tmp := path.Join(path.Dir(p), fmt.Sprintf(".%s.tmp-%d", path.Base(p), time.Now().UnixNano()))
+
+	file, e := client.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if e != nil {
+		return "", e
+	}
+
+	if _, e := file.Write(data); e != nil {
+		file.Close()
+		client.Remove(tmp)
+		return "", e
+	}
+
+	if e := file.Close(); e != nil {
+		client.Remove(tmp)
+		return "", e
+	}
+
+	return tmp, nil
+}
+
+func translateError(e error) error {
+	if errors.Is(e, os.ErrNotExist) {
+		return remotes.ErrVersionNotFound
+	}
+
+	return e
+}
@@ -0,0 +1,370 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type testServer struct {
+	addr       string
+	keyFile    string
+	knownHosts string
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// Drops every connection to the server, like a restart of the server would.
+func (s *testServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, nc := range s.conns {
+		nc.Close()
+	}
+	s.conns = nil
+}
+
+// Starts an in-process SSH server on localhost that serves SFTP and only
+// accepts the client key that is written out to keyFile.
+func newTestServer(t *testing.T) *testServer {
+	dir := t.TempDir()
+
+	_, hostPriv, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, e := ssh.NewSignerFromKey(hostPriv)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	clientPub, clientPriv, _ := ed25519.GenerateKey(rand.Reader)
+	authorized, e := ssh.NewPublicKey(clientPub)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	block, e := ssh.MarshalPrivateKey(clientPriv, "")
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if e := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); e != nil {
+		t.Fatal(e)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	ln, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(ln.Addr().String())}, hostSigner.PublicKey())
+	if e := os.WriteFile(knownHosts, []byte(line+"\n"), 0o600); e != nil {
+		t.Fatal(e)
+	}
+
+	srv := &testServer{addr: ln.Addr().String(), keyFile: keyFile, knownHosts: knownHosts}
+	go func() {
+		for {
+			nc, e := ln.Accept()
+			if e != nil {
+				return
+			}
+
+			srv.mu.Lock()
+			srv.conns = append(srv.conns, nc)
+			srv.mu.Unlock()
+			go serveConn(nc, config)
+		}
+	}()
+
+	return srv
+}
+
+func serveConn(nc net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, e := ssh.NewServerConn(nc, config)
+	if e != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for nch := range chans {
+		if nch.ChannelType() != "session" {
+			nch.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+
+		ch, requests, e := nch.Accept()
+		if e != nil {
+			continue
+		}
+
+		go func() {
+			for req := range requests {
+				// The payload of a subsystem request is the length prefixed subsystem name.
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					if srv, e := sftp.NewServer(ch); e == nil {
+						srv.Serve()
+					}
+					ch.Close()
+				}
+			}
+		}()
+	}
+}
+
+func TestSFTPRemoteVersions(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+
+	r, e := New(&Options{
+		Host:           srv.addr,
+		User:           "alice",
+		KeyFile:        srv.keyFile,
+		KnownHostsFile: srv.knownHosts,
+		Dir:            filepath.Join(t.TempDir(), "vaults"),
+		Database:       "personal",
+	})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+	defer r.Close()
+
+	if last, e := r.GetLastVersion(ctx); e != nil || last.ID != 0 {
+		t.Fatalf("GetLastVersion() = %v, %v, want 0, nil", last.ID, e)
+	}
+
+	versions := [][]byte{
+		[]byte("first version"),
+		[]byte("second version"),
+		[]byte("third version"),
+	}
+
+	for i, data := range versions {
+		info, e := r.PersistVersion(ctx, bytes.NewReader(data), uint(i))
+		if e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+		if info.ID != uint(i+1) || info.SHA256 != remotes.HashBytes(data) {
+			t.Errorf("PersistVersion() = %+v, unexpected metadata", info)
+		}
+	}
+
+	for i, want := range versions {
+		body, info, e := r.GetVersion(ctx, uint(i+1))
+		if e != nil {
+			t.Fatalf("GetVersion(%d) error = %v", i+1, e)
+		}
+
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if !bytes.Equal(got, want) || info.SHA256 != remotes.HashBytes(want) {
+			t.Errorf("GetVersion(%d) = %q, %+v, want %q", i+1, got, info, want)
+		}
+	}
+
+	if _, _, e := r.GetVersion(ctx, 42); !errors.Is(e, remotes.ErrVersionNotFound) {
+		t.Errorf("GetVersion(42) error = %v, want %v", e, remotes.ErrVersionNotFound)
+	}
+
+	page, e := r.ListVersions(ctx, 1, 1)
+	if e != nil {
+		t.Fatalf("ListVersions() error = %v", e)
+	}
+
+	var ids []uint
+	for _, v := range page {
+		ids = append(ids, v.ID)
+	}
+	if !reflect.DeepEqual(ids, []uint{2}) {
+		t.Errorf("ListVersions() = %v, want %v", ids, []uint{2})
+	}
+}
+
+func TestSFTPRemoteHostKeyMismatch(t *testing.T) {
+	srv := newTestServer(t)
+	other := newTestServer(t)
+
+	// Verify the server against the known_hosts of a different server.
+	r, e := New(&Options{
+		Host:           srv.addr,
+		User:           "alice",
+		KeyFile:        srv.keyFile,
+		KnownHostsFile: other.knownHosts,
+		Dir:            t.TempDir(),
+		Database:       "personal",
+	})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+	defer r.Close()
+
+	if _, e := r.GetLastVersion(context.Background()); e == nil {
+		t.Errorf("GetLastVersion() error = nil, want host key error")
+	}
+}
+
+func TestNew(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{
+			name:    "1",
+			opts:    &Options{Host: "vault.lan", User: "alice", KeyFile: srv.keyFile, KnownHostsFile: srv.knownHosts, Dir: "/srv", Database: "db"},
+			wantErr: false,
+		},
+		{
+			name:    "2",
+			opts:    &Options{User: "alice", KeyFile: srv.keyFile, KnownHostsFile: srv.knownHosts, Dir: "/srv", Database: "db"},
+			wantErr: true,
+		},
+		{
+			name:    "3",
+			opts:    &Options{Host: "vault.lan", User: "alice", KeyFile: srv.knownHosts, KnownHostsFile: srv.knownHosts, Dir: "/srv", Database: "db"},
+			wantErr: true,
+		},
+		{
+			name:    "4",
+			opts:    &Options{Host: "vault.lan", User: "alice", KeyFile: srv.keyFile, KnownHostsFile: "/nonexistent/known_hosts", Dir: "/srv", Database: "db"},
+			wantErr: true,
+		},
+		{
+			name:    "5",
+			opts:    &Options{Host: "vault.lan", User: "alice", KeyFile: srv.keyFile, KnownHostsFile: srv.knownHosts, Database: "db"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSFTPRemoteConflict(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+
+	r, e := New(&Options{
+		Host:           srv.addr,
+		User:           "alice",
+		KeyFile:        srv.keyFile,
+		KnownHostsFile: srv.knownHosts,
+		Dir:            filepath.Join(t.TempDir(), "vaults"),
+		Database:       "personal",
+	})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+	defer r.Close()
+
+	if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte("laptop")), 0); e != nil {
+		t.Fatalf("PersistVersion() error = %v", e)
+	}
+
+	_, e = r.PersistVersion(ctx, bytes.NewReader([]byte("desktop")), 0)
+	var conflict *remotes.ConflictError
+	if !errors.As(e, &conflict) || conflict.Actual != 1 {
+		t.Fatalf("PersistVersion() error = %v, want conflict with version 1", e)
+	}
+
+	// Another writer claiming the same version in between the check and the write.
+	client, e := r.connect(ctx)
+	if e != nil {
+		t.Fatalf("connect() error = %v", e)
+	}
+
+	if e := writeExclusive(client, r.path(1, remotes.VersionSuffix), []byte("late")); !errors.Is(e, os.ErrExist) {
+		t.Errorf("writeExclusive() error = %v, want %v", e, os.ErrExist)
+	}
+}
+
+func TestSFTPRemoteReconnects(t *testing.T) {
+	ctx := context.Background()
+	srv := newTestServer(t)
+
+	r, e := New(&Options{
+		Host:           srv.addr,
+		User:           "alice",
+		KeyFile:        srv.keyFile,
+		KnownHostsFile: srv.knownHosts,
+		Dir:            filepath.Join(t.TempDir(), "vaults"),
+		Database:       "personal",
+	})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+	defer r.Close()
+
+	if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte("laptop")), 0); e != nil {
+		t.Fatalf("PersistVersion() error = %v", e)
+	}
+
+	lost := r.lost
+	srv.drop()
+
+	select {
+	case <-lost:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("session was not noticed to be dropped")
+	}
+
+	if last, e := r.GetLastVersion(ctx); e != nil || last.ID != 1 {
+		t.Errorf("GetLastVersion() = %+v, %v, want version 1 over a new session", last, e)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package remotes
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of versions requested per page by ListAllVersions.
+const ListPageSize int = 100
+
+// Suffixes of the files of remotes that store every version as its own file, with
+// a sidecar file alongside it that holds the version metadata.
+const (
+	VersionSuffix string = ".kdbx"
+	MetaSuffix    string = ".json"
+)
+
+// Metadata recorded by a remote for every version of a database that it stores.
+type VersionInfo struct {
+	// Sequential number of this version on the remote.
+	ID uint `json:"id" yaml:"id"`
+	// Time the version was written.
+	Timestamp time.Time `json:"timestamp" yaml:"timestamp"`
+	// Size of the database contents in bytes.
+	Size int64 `json:"size" yaml:"size"`
+	// Hex encoded SHA-256 of the database contents.
+	SHA256 string `json:"sha256" yaml:"sha256"`
+	// Hostname of the device that wrote this version.
+	Host string `json:"host" yaml:"host"`
+	// Name of the database this is a version of.
+	Database string `json:"database" yaml:"database"`
+}
+
+// Computes the metadata for a new version of database containing data. The ID is
+// left unset, as it is up to the remote to assign the next number.
+func NewVersionInfo(database string, data []byte) VersionInfo {
+	return VersionInfo{
+		Timestamp: time.Now().UTC(),
+		Size:      int64(len(data)),
+		SHA256:    HashBytes(data),
+		Host:      Hostname(),
+		Database:  database,
+	}
+}
+
+// Returns the hex encoded SHA-256 of data.
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the hostname that is recorded as the origin of new versions.
+func Hostname() string {
+	if h, e := os.Hostname(); e == nil && h != "" {
+		return h
+	}
+
+	return "unknown"
+}
+
+// Pages through the entire history of a remote and returns every version in ascending order.
+func ListAllVersions(ctx context.Context, r Remote) ([]VersionInfo, error) {
+	var all []VersionInfo
+	var after uint
+
+	for {
+		page, e := r.ListVersions(ctx, after, ListPageSize)
+		if e != nil {
+			return nil, e
+		}
+
+		all = append(all, page...)
+		if len(page) < ListPageSize {
+			return all, nil
+		}
+
+		after = page[len(page)-1].ID
+	}
+}
+
+// Returns the name of the file of version id. The number is zero-padded, so that
+// sorting the names sorts the versions.
+func VersionName(id uint, suffix string) string {
+	return fmt.Sprintf("%020d%s", id, suffix)
+}
+
+// Returns the version number encoded within a file name, or false if the file is not a
+// version file. Hidden files, such as uploads in progress, never are.
+func ParseVersionName(name string) (uint, bool) {
+	name, ok := strings.CutSuffix(name, VersionSuffix)
+	if !ok || strings.HasPrefix(name, ".") {
+		return 0, false
+	}
+
+	v, e := strconv.ParseUint(name, 10, 64)
+	if e != nil || v == 0 {
+		return 0, false
+	}
+
+	return uint(v), true
+}
+
+// Encodes the sidecar of a version. Remotes claim the version file first, so that only one
+// writer can store a version, and write the sidecar after it. Readers that find a version
+// without its sidecar rebuild the metadata from the file with RebuildVersionInfo.
+func EncodeSidecar(info VersionInfo) ([]byte, error) {
+	return json.MarshalIndent(info, "", "	")
+}
+
+// Decodes the sidecar of version id.
+func DecodeSidecar(id uint, data []byte) (VersionInfo, error) {
+	info := VersionInfo{}
+	if e := json.Unmarshal(data, &info); e != nil {
+		return VersionInfo{}, fmt.Errorf("unable to parse metadata of version %d: %w", id, e)
+	}
+
+	info.ID = id
+	return info, nil
+}
+
+// Builds the metadata of version id of database from the contents of its file and the time
+// it was last modified, for versions whose sidecar is missing.
+func RebuildVersionInfo(database string, id uint, modified time.Time, data []byte) VersionInfo {
+	return VersionInfo{
+		ID:        id,
+		Timestamp: modified.UTC(),
+		Size:      int64(len(data)),
+		SHA256:    HashBytes(data),
+		Database:  database,
+	}
+}
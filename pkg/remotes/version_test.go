@@ -0,0 +1,99 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package remotes
+
+import (
+	"testing"
+)
+
+func TestNewVersionInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		database string
+		data     []byte
+		wantHash string
+	}{
+		{
+			name:     "1",
+			database: "personal",
+			data:     []byte{},
+			wantHash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			name:     "2",
+			database: "work",
+			data:     []byte("abc"),
+			wantHash: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewVersionInfo(tt.database, tt.data)
+			if got.SHA256 != tt.wantHash {
+				t.Errorf("NewVersionInfo().SHA256 = %v, want %v", got.SHA256, tt.wantHash)
+			}
+			if got.Size != int64(len(tt.data)) {
+				t.Errorf("NewVersionInfo().Size = %v, want %v", got.Size, len(tt.data))
+			}
+			if got.Database != tt.database || got.Host == "" || got.Timestamp.IsZero() || got.ID != 0 {
+				t.Errorf("NewVersionInfo() = %+v, unexpected metadata", got)
+			}
+		})
+	}
+}
+
+func TestParseVersionName(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		wantID uint
+		wantOk bool
+	}{
+		{
+			name:   "1",
+			file:   VersionName(42, VersionSuffix),
+			wantID: 42,
+			wantOk: true,
+		},
+		{
+			name: "2",
+			file: VersionName(42, MetaSuffix),
+		},
+		{
+			name: "3",
+			file: "." + VersionName(42, VersionSuffix) + ".tmp-1",
+		},
+		{
+			name: "4",
+			file: VersionName(0, VersionSuffix),
+		},
+		{
+			name: "5",
+			file: "personal.kdbx",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := ParseVersionName(tt.file)
+			if id != tt.wantID || ok != tt.wantOk {
+				t.Errorf("ParseVersionName(%q) = %v, %v, want %v, %v", tt.file, id, ok, tt.wantID, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,451 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Returned by put when the server rejects a conditional upload.
+var errPreconditionFailed = errors.New("precondition failed")
+
+// Body of the PROPFIND requests used to list a collection.
+const propfindBody string = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/></d:prop></d:propfind>`
+
+// Options for constructing a new WebDAVRemote.
+type Options struct {
+	// URL of the collection that versions are stored under, for Nextcloud this would be
+	// https://<host>/remote.php/dav/files/<user>/<folder>.
+	URL string
+	// Name of the database that is being versioned on this remote.
+	Database string
+	// Credentials for basic authentication.
+	Username string
+	Password string
+	// Token for bearer authentication, takes precedence over basic authentication.
+	Token string
+	// HTTP client to issue requests with, defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+var (
+	_ remotes.Remote  = &WebDAVRemote{}
+	_ remotes.Deleter = &WebDAVRemote{}
+)
+
+func init() {
+	remotes.Register(config.RemoteTypeWebDAV, func(ctx context.Context, conf *config.KeepassxCyncRemote, database string) (remotes.Remote, error) {
+		return New(&Options{
+			URL:      conf.WebDAV.URL,
+			Database: database,
+			Username: conf.WebDAV.Username,
+			Password: conf.WebDAV.Password,
+			Token:    conf.WebDAV.Token,
+		})
+	})
+}
+
+// WebDAVRemote stores every version of a database as its own file under
+// <url>/<database>/<version>.kdbx, with a <version>.json file alongside
+// it that holds the version metadata.
+type WebDAVRemote struct {
+	client *http.Client
+
+	base     *url.URL
+	database string
+
+	username string
+	password string
+	token    string
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"DAV: href"`
+	} `xml:"DAV: response"`
+}
+
+func New(opts *Options) (*WebDAVRemote, error) {
+	if opts.URL == "" {
+		return nil, errors.New("webdav remote requires a collection url")
+	}
+
+	if opts.Database == "" {
+		return nil, errors.New("webdav remote requires a database name")
+	}
+
+	base, e := url.Parse(opts.URL)
+	if e != nil {
+		return nil, e
+	}
+
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("webdav url must be http or https, not %q", base.Scheme)
+	}
+
+	base.Path = strings.TrimSuffix(base.Path, "/") + "/" + opts.Database + "/"
+
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &WebDAVRemote{
+		client:   client,
+		base:     base,
+		database: opts.Database,
+		username: opts.Username,
+		password: opts.Password,
+		token:    opts.Token,
+	}, nil
+}
+
+func (r *WebDAVRemote) PersistVersion(ctx context.Context, data io.Reader, parent uint) (remotes.VersionInfo, error) {
+	if e := r.ensureCollection(ctx, r.base); e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	last, e := r.lastVersionID(ctx)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	if last != parent {
+		return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent, Actual: last}
+	}
+
+	body, e := io.ReadAll(data)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	info := remotes.NewVersionInfo(r.database, body)
+	info.ID = parent + 1
+
+	meta, e := remotes.EncodeSidecar(info)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	// The server rejects the conditional PUT if another writer already stored this version.
+	if e := r.put(ctx, r.file(info.ID, remotes.VersionSuffix), body, map[string]string{"If-None-Match": "*"}); e != nil {
+		if errors.Is(e, errPreconditionFailed) {
+			return remotes.VersionInfo{}, &remotes.ConflictError{Expected: parent, Actual: info.ID}
+		}
+		return remotes.VersionInfo{}, e
+	}
+
+	if e := r.put(ctx, r.file(info.ID, remotes.MetaSuffix), meta, nil); e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	return info, nil
+}
+
+func (r *WebDAVRemote) GetVersion(ctx context.Context, id uint) (io.ReadCloser, remotes.VersionInfo, error) {
+	info, e := r.statVersion(ctx, id)
+	if e != nil {
+		return nil, remotes.VersionInfo{}, e
+	}
+
+	res, e := r.do(ctx, http.MethodGet, r.file(id, remotes.VersionSuffix), nil, nil)
+	if e != nil {
+		return nil, remotes.VersionInfo{}, e
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, remotes.VersionInfo{}, statusError(http.MethodGet, res)
+	}
+
+	return res.Body, info, nil
+}
+
+func (r *WebDAVRemote) GetLastVersion(ctx context.Context) (remotes.VersionInfo, error) {
+	last, e := r.lastVersionID(ctx)
+	if e != nil || last == 0 {
+		return remotes.VersionInfo{}, e
+	}
+
+	return r.statVersion(ctx, last)
+}
+
+func (r *WebDAVRemote) ListVersions(ctx context.Context, after uint, limit int) ([]remotes.VersionInfo, error) {
+	ids, e := r.versionIDs(ctx)
+	if e != nil {
+		return nil, e
+	}
+
+	var versions []remotes.VersionInfo
+	for _, id := range ids {
+		if id <= after {
+			continue
+		}
+
+		if len(versions) == limit {
+			break
+		}
+
+		info, e := r.statVersion(ctx, id)
+		if e != nil {
+			return nil, e
+		}
+
+		versions = append(versions, info)
+	}
+
+	return versions, nil
+}
+
+func (r *WebDAVRemote) DeleteVersion(ctx context.Context, id uint) error {
+	// The version file goes first, a sidecar left behind without it is never read.
+	if e := r.delete(ctx, r.file(id, remotes.VersionSuffix)); e != nil {
+		return e
+	}
+
+	if e := r.delete(ctx, r.file(id, remotes.MetaSuffix)); e != nil && !errors.Is(e, remotes.ErrVersionNotFound) {
+		return e
+	}
+
+	return nil
+}
+
+// Downloads the sidecar metadata of a version. Versions whose sidecar has not been
+// uploaded yet have their metadata rebuilt from the file itself.
+func (r *WebDAVRemote) statVersion(ctx context.Context, id uint) (remotes.VersionInfo, error) {
+	res, e := r.do(ctx, http.MethodGet, r.file(id, remotes.MetaSuffix), nil, nil)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return r.rebuildVersion(ctx, id)
+	default:
+		return remotes.VersionInfo{}, statusError(http.MethodGet, res)
+	}
+
+	meta, e := io.ReadAll(res.Body)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	return remotes.DecodeSidecar(id, meta)
+}
+
+func (r *WebDAVRemote) rebuildVersion(ctx context.Context, id uint) (remotes.VersionInfo, error) {
+	res, e := r.do(ctx, http.MethodGet, r.file(id, remotes.VersionSuffix), nil, nil)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return remotes.VersionInfo{}, statusError(http.MethodGet, res)
+	}
+
+	data, e := io.ReadAll(res.Body)
+	if e != nil {
+		return remotes.VersionInfo{}, e
+	}
+
+	modified, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return remotes.RebuildVersionInfo(r.database, id, modified, data), nil
+}
+
+func (r *WebDAVRemote) lastVersionID(ctx context.Context) (uint, error) {
+	ids, e := r.versionIDs(ctx)
+	if e != nil || len(ids) == 0 {
+		return 0, e
+	}
+
+	return ids[len(ids)-1], nil
+}
+
+// Lists the collection of this database and returns the number of every
+// version file within it, in ascending order.
+func (r *WebDAVRemote) versionIDs(ctx context.Context) ([]uint, error) {
+	res, e := r.do(ctx, "PROPFIND", r.base, strings.NewReader(propfindBody), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if e != nil {
+		return nil, e
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusMultiStatus:
+	case http.StatusNotFound:
+		// Nothing has been pushed to this remote yet.
+		return nil, nil
+	default:
+		return nil, statusError("PROPFIND", res)
+	}
+
+	ms := &multistatus{}
+	if e := xml.NewDecoder(res.Body).Decode(ms); e != nil {
+		return nil, e
+	}
+
+	var ids []uint
+	for _, resp := range ms.Responses {
+		href, e := url.PathUnescape(resp.Href)
+		if e != nil {
+			continue
+		}
+
+		if id, ok := remotes.ParseVersionName(path.Base(href)); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// Makes sure the collection at u exists, creating it and any missing parents with MKCOL.
+func (r *WebDAVRemote) ensureCollection(ctx context.Context, u *url.URL) error {
+	res, e := r.do(ctx, "PROPFIND", u, strings.NewReader(propfindBody), map[string]string{
+		"Depth":        "0",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if e != nil {
+		return e
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusMultiStatus, http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+	default:
+		return statusError("PROPFIND", res)
+	}
+
+	// The root of the server is assumed to always exist.
+	if dir := path.Dir(strings.TrimSuffix(u.Path, "/")); dir != "/" && dir != "." {
+		parent := *u
+		parent.Path = dir + "/"
+		if e := r.ensureCollection(ctx, &parent); e != nil {
+			return e
+		}
+	}
+
+	res, e = r.do(ctx, "MKCOL", u, nil, nil)
+	if e != nil {
+		return e
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	// A 405 is returned when the collection was created in the meantime.
+	case http.StatusCreated, http.StatusOK, http.StatusMethodNotAllowed:
+		return nil
+	default:
+		return statusError("MKCOL", res)
+	}
+}
+
+func (r *WebDAVRemote) put(ctx context.Context, u *url.URL, data []byte, headers map[string]string) error {
+	h := map[string]string{"Content-Type": "application/octet-stream"}
+	for k, v := range headers {
+		h[k] = v
+	}
+
+	res, e := r.do(ctx, http.MethodPut, u, bytes.NewReader(data), h)
+	if e != nil {
+		return e
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusPreconditionFailed:
+		return errPreconditionFailed
+	default:
+		return statusError(http.MethodPut, res)
+	}
+}
+
+func (r *WebDAVRemote) delete(ctx context.Context, u *url.URL) error {
+	res, e := r.do(ctx, http.MethodDelete, u, nil, nil)
+	if e != nil {
+		return e
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	default:
+		return statusError(http.MethodDelete, res)
+	}
+}
+
+func (r *WebDAVRemote) do(ctx context.Context, method string, u *url.URL, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, e := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if e != nil {
+		return nil, e
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	switch {
+	case r.token != "":
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	case r.username != "":
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	return r.client.Do(req)
+}
+
+func (r *WebDAVRemote) file(id uint, suffix string) *url.URL {
+	u := *r.base
+	u.Path += remotes.VersionName(id, suffix)
+	return &u
+}
+
+func statusError(method string, res *http.Response) error {
+	if res.StatusCode == http.StatusNotFound {
+		return remotes.ErrVersionNotFound
+	}
+
+	return fmt.Errorf("webdav %s %s failed: %s", method, res.Request.URL.Redacted(), res.Status)
+}
@@ -0,0 +1,246 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package webdav
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+	"golang.org/x/net/webdav"
+)
+
+// Starts an in-process WebDAV server that only accepts the given credentials.
+func newTestServer(t *testing.T, user, pass, token string) string {
+	dav := &webdav.Handler{
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		switch {
+		case token != "" && r.Header.Get("Authorization") == "Bearer "+token:
+		case user != "" && ok && u == user && p == pass:
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// The handler does not implement conditional requests, which servers such as
+		// Nextcloud and Apache do, so the one used by the remote is handled here.
+		if r.Method == http.MethodPut && r.Header.Get("If-None-Match") == "*" {
+			if _, e := dav.FileSystem.Stat(r.Context(), r.URL.Path); e == nil {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+
+		dav.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+func TestWebDAVRemoteVersions(t *testing.T) {
+	ctx := context.Background()
+	base := newTestServer(t, "alice", "hunter2", "")
+
+	r, e := New(&Options{
+		URL:      base + "/remote.php/dav/files/alice/vaults",
+		Database: "personal",
+		Username: "alice",
+		Password: "hunter2",
+	})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+
+	if last, e := r.GetLastVersion(ctx); e != nil || last.ID != 0 {
+		t.Fatalf("GetLastVersion() = %v, %v, want 0, nil", last.ID, e)
+	}
+
+	versions := [][]byte{
+		[]byte("first version"),
+		[]byte("second version"),
+		[]byte("third version"),
+	}
+
+	for i, data := range versions {
+		info, e := r.PersistVersion(ctx, bytes.NewReader(data), uint(i))
+		if e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+		if info.ID != uint(i+1) || info.SHA256 != remotes.HashBytes(data) {
+			t.Errorf("PersistVersion() = %+v, unexpected metadata", info)
+		}
+
+		last, e := r.GetLastVersion(ctx)
+		if e != nil {
+			t.Fatalf("GetLastVersion() error = %v", e)
+		}
+		if last.ID != info.ID || last.SHA256 != info.SHA256 {
+			t.Errorf("GetLastVersion() = %+v, want %+v", last, info)
+		}
+	}
+
+	for i, want := range versions {
+		body, info, e := r.GetVersion(ctx, uint(i+1))
+		if e != nil {
+			t.Fatalf("GetVersion(%d) error = %v", i+1, e)
+		}
+
+		got, _ := io.ReadAll(body)
+		body.Close()
+		if !bytes.Equal(got, want) || info.SHA256 != remotes.HashBytes(want) {
+			t.Errorf("GetVersion(%d) = %q, %+v, want %q", i+1, got, info, want)
+		}
+	}
+
+	if _, _, e := r.GetVersion(ctx, 42); !errors.Is(e, remotes.ErrVersionNotFound) {
+		t.Errorf("GetVersion(42) error = %v, want %v", e, remotes.ErrVersionNotFound)
+	}
+
+	page, e := r.ListVersions(ctx, 1, 10)
+	if e != nil {
+		t.Fatalf("ListVersions() error = %v", e)
+	}
+
+	var ids []uint
+	for _, v := range page {
+		ids = append(ids, v.ID)
+	}
+	if !reflect.DeepEqual(ids, []uint{2, 3}) {
+		t.Errorf("ListVersions() = %v, want %v", ids, []uint{2, 3})
+	}
+}
+
+func TestWebDAVRemoteAuth(t *testing.T) {
+	ctx := context.Background()
+	base := newTestServer(t, "alice", "hunter2", "s3cr3t")
+
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{
+			name:    "1",
+			opts:    &Options{URL: base + "/a", Database: "db", Token: "s3cr3t"},
+			wantErr: false,
+		},
+		{
+			name:    "2",
+			opts:    &Options{URL: base + "/b", Database: "db", Username: "alice", Password: "hunter2"},
+			wantErr: false,
+		},
+		{
+			name:    "3",
+			opts:    &Options{URL: base + "/c", Database: "db", Username: "alice", Password: "wrong"},
+			wantErr: true,
+		},
+		{
+			name:    "4",
+			opts:    &Options{URL: base + "/d", Database: "db", Token: "wrong"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, e := New(tt.opts)
+			if e != nil {
+				t.Fatalf("New() error = %v", e)
+			}
+
+			_, err := r.PersistVersion(ctx, bytes.NewReader([]byte("data")), 0)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PersistVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *Options
+		wantErr bool
+	}{
+		{
+			name:    "1",
+			opts:    &Options{URL: "https://cloud.example.com/remote.php/dav/files/alice", Database: "personal"},
+			wantErr: false,
+		},
+		{
+			name:    "2",
+			opts:    &Options{URL: "ftp://cloud.example.com/", Database: "personal"},
+			wantErr: true,
+		},
+		{
+			name:    "3",
+			opts:    &Options{Database: "personal"},
+			wantErr: true,
+		},
+		{
+			name:    "4",
+			opts:    &Options{URL: "https://cloud.example.com/"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebDAVRemoteConflict(t *testing.T) {
+	ctx := context.Background()
+	base := newTestServer(t, "", "", "s3cr3t")
+
+	r, e := New(&Options{URL: base + "/vaults", Database: "personal", Token: "s3cr3t"})
+	if e != nil {
+		t.Fatalf("New() error = %v", e)
+	}
+
+	if _, e := r.PersistVersion(ctx, bytes.NewReader([]byte("laptop")), 0); e != nil {
+		t.Fatalf("PersistVersion() error = %v", e)
+	}
+
+	_, e = r.PersistVersion(ctx, bytes.NewReader([]byte("desktop")), 0)
+	var conflict *remotes.ConflictError
+	if !errors.As(e, &conflict) || conflict.Actual != 1 {
+		t.Fatalf("PersistVersion() error = %v, want conflict with version 1", e)
+	}
+
+	// Another writer claiming the same version in between the check and the write.
+	if e := r.put(ctx, r.file(1, remotes.VersionSuffix), []byte("late"), map[string]string{"If-None-Match": "*"}); !errors.Is(e, errPreconditionFailed) {
+		t.Errorf("put() error = %v, want %v", e, errPreconditionFailed)
+	}
+}
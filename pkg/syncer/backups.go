@@ -0,0 +1,182 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+)
+
+// Layout that {time} in the names of backups is formatted with, in UTC.
+const backupTimeLayout = "20060102T150405.000"
+
+// Local copy of a database, taken before it was replaced.
+type Backup struct {
+	Path string    `json:"path" yaml:"path"`
+	Time time.Time `json:"time" yaml:"time"`
+	Size int64     `json:"size" yaml:"size"`
+}
+
+// Returns the directory that local copies of database are kept in unless its backup policy names one.
+func BackupDir(database string) string {
+	return filepath.Join(config.StateDir(), "backups", database)
+}
+
+// Sets where and for how long local copies of the database are kept. A nil policy selects the defaults.
+func (s *Syncer) KeepBackups(p *config.BackupPolicy) {
+	s.backups = p.WithDefaults(BackupDir(s.name))
+}
+
+// Returns the local copies of the database, newest first.
+func (s *Syncer) Backups() ([]Backup, error) {
+	entries, e := os.ReadDir(s.backups.Dir)
+	if errors.Is(e, fs.ErrNotExist) {
+		return nil, nil
+	} else if e != nil {
+		return nil, e
+	}
+
+	re := s.backupPattern()
+
+	var backups []Backup
+	for _, entry := range entries {
+		m := re.FindStringSubmatch(entry.Name())
+		if m == nil || !entry.Type().IsRegular() {
+			continue
+		}
+
+		t, e := time.Parse(backupTimeLayout, m[1])
+		if e != nil {
+			continue
+		}
+
+		info, e := entry.Info()
+		if e != nil {
+			return nil, e
+		}
+
+		backups = append(backups, Backup{Path: filepath.Join(s.backups.Dir, entry.Name()), Time: t, Size: info.Size()})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Time.After(backups[j].Time)
+	})
+
+	return backups, nil
+}
+
+// Replaces the local database with its nth most recent copy, counting from 1 as listed by Backups.
+// The local database is backed up first, and the next sync publishes the restored contents.
+func (s *Syncer) RestoreBackup(n int) (*Result, error) {
+	backups, e := s.Backups()
+	if e != nil {
+		return nil, e
+	}
+
+	if n < 1 || n > len(backups) {
+		return nil, fmt.Errorf("%s has %d backups, there is no backup %d", s.name, len(backups), n)
+	}
+
+	data, e := os.ReadFile(backups[n-1].Path)
+	if e != nil {
+		return nil, e
+	}
+
+	backup, e := s.backupLocal()
+	if e != nil {
+		return nil, e
+	}
+
+	if e := s.replaceLocal(data); e != nil {
+		return &Result{Backup: backup}, e
+	}
+
+	return &Result{Action: ActionRestored, Backup: backup}, nil
+}
+
+// Copies the local database to the backup directory and removes the copies that the backup policy
+// no longer keeps. Returns the path of the copy, nothing is backed up if there is no local database yet.
+func (s *Syncer) backupLocal() (string, error) {
+	data, e := os.ReadFile(s.path)
+	if errors.Is(e, fs.ErrNotExist) {
+		return "", nil
+	} else if e != nil {
+		return "", fmt.Errorf("unable to back up the local database: %w", e)
+	}
+
+	now := time.Now()
+	backup := filepath.Join(s.backups.Dir, s.backupName(now))
+	if e := writeAtomic(backup, bytes.NewReader(data), 0o600); e != nil {
+		return "", fmt.Errorf("unable to back up the local database: %w", e)
+	}
+
+	if e := s.pruneBackups(now); e != nil {
+		return backup, fmt.Errorf("unable to remove old backups: %w", e)
+	}
+
+	return backup, nil
+}
+
+// Removes the copies beyond the most recent ones that the backup policy keeps, and those that
+// are older than it allows. The newest copy is always kept.
+func (s *Syncer) pruneBackups(now time.Time) error {
+	backups, e := s.Backups()
+	if e != nil {
+		return e
+	}
+
+	for i, b := range backups {
+		expired := s.backups.KeepDays > 0 && b.Time.Before(now.AddDate(0, 0, -s.backups.KeepDays))
+		if i > 0 && (i >= s.backups.Keep || expired) {
+			if e := os.Remove(b.Path); e != nil && !errors.Is(e, fs.ErrNotExist) {
+				return e
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the name of a copy of the local database taken at t.
+func (s *Syncer) backupName(t time.Time) string {
+	return s.backupReplacer(t.UTC().Format(backupTimeLayout)).Replace(s.backups.Pattern)
+}
+
+// Returns an expression that matches the names of copies of the local database, capturing their time.
+func (s *Syncer) backupPattern() *regexp.Regexp {
+	before, after, _ := strings.Cut(s.backups.Pattern, "{time}")
+	r := s.backupReplacer("")
+	return regexp.MustCompile("^" + regexp.QuoteMeta(r.Replace(before)) + `(\d{8}T\d{6}\.\d{3})` + regexp.QuoteMeta(r.Replace(after)) + "$")
+}
+
+func (s *Syncer) backupReplacer(t string) *strings.Replacer {
+	base := filepath.Base(s.path)
+	ext := filepath.Ext(base)
+	return strings.NewReplacer("{name}", strings.TrimSuffix(base, ext), "{ext}", ext, "{time}", t)
+}
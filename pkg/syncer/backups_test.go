@@ -0,0 +1,153 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+)
+
+func TestSyncerBackups(t *testing.T) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+	desktop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	ra, _ := newTestReplica(t, "nas", remoteDir)
+	a := New("personal", laptop, 0, ra)
+	a.KeepBackups(&config.BackupPolicy{Pattern: "{name}.{time}{ext}.bak", Keep: 2})
+	rb, _ := newTestReplica(t, "nas", remoteDir)
+	b := New("personal", desktop, 0, rb)
+
+	os.WriteFile(desktop, []byte("first"), 0o600)
+	if _, e := b.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	if res, e := a.Sync(ctx); e != nil || res.Backup != "" {
+		t.Fatalf("Sync() = %+v, %v, want a pull without a backup of a missing database", res, e)
+	}
+
+	for _, data := range []string{"second", "third", "fourth"} {
+		os.WriteFile(desktop, []byte(data), 0o600)
+		if _, e := b.Push(ctx); e != nil {
+			t.Fatalf("Push() error = %v", e)
+		}
+
+		res, e := a.Pull(ctx)
+		if e != nil || res.Backup == "" {
+			t.Fatalf("Pull() = %+v, %v, want a backup of the replaced database", res, e)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	backups, e := a.Backups()
+	if e != nil || len(backups) != 2 {
+		t.Fatalf("Backups() = %+v, %v, want the 2 most recent", backups, e)
+	}
+
+	for i, want := range []string{"third", "second"} {
+		if got, _ := os.ReadFile(backups[i].Path); string(got) != want {
+			t.Errorf("backup %d = %q, want %q", i+1, got, want)
+		}
+	}
+
+	if ok, _ := filepath.Match("personal.*.kdbx.bak", filepath.Base(backups[0].Path)); !ok {
+		t.Errorf("backup saved to %s, which does not follow the pattern", backups[0].Path)
+	}
+
+	if _, e := a.RestoreBackup(3); e == nil {
+		t.Errorf("RestoreBackup(3) error = nil, want error for a backup that does not exist")
+	}
+
+	res, e := a.RestoreBackup(2)
+	if e != nil || res.Action != ActionRestored {
+		t.Fatalf("RestoreBackup() = %+v, %v, want %v", res, e, ActionRestored)
+	}
+
+	if got, _ := os.ReadFile(laptop); string(got) != "second" {
+		t.Errorf("local database = %q, want %q", got, "second")
+	}
+
+	if got, _ := os.ReadFile(res.Backup); string(got) != "fourth" {
+		t.Errorf("backup taken by the restore = %q, want %q", got, "fourth")
+	}
+}
+
+func TestSyncerPruneBackups(t *testing.T) {
+	now := time.Date(2023, 8, 20, 12, 0, 0, 0, time.UTC)
+	ages := []time.Duration{0, time.Hour, 3 * 24 * time.Hour, 10 * 24 * time.Hour, 40 * 24 * time.Hour}
+
+	tests := []struct {
+		name   string
+		policy *config.BackupPolicy
+		want   int
+	}{
+		{
+			name:   "1",
+			policy: nil,
+			want:   5,
+		},
+		{
+			name:   "2",
+			policy: &config.BackupPolicy{Keep: 3},
+			want:   3,
+		},
+		{
+			name:   "3",
+			policy: &config.BackupPolicy{KeepDays: 7},
+			want:   3,
+		},
+		{
+			name:   "4",
+			policy: &config.BackupPolicy{Keep: 2, KeepDays: 7},
+			want:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_STATE_HOME", t.TempDir())
+			s := New("personal", filepath.Join(t.TempDir(), "personal.kdbx"), 0)
+			s.KeepBackups(tt.policy)
+
+			for _, age := range ages {
+				os.MkdirAll(s.backups.Dir, 0o700)
+				os.WriteFile(filepath.Join(s.backups.Dir, s.backupName(now.Add(-age))), []byte("backup"), 0o600)
+			}
+			os.WriteFile(filepath.Join(s.backups.Dir, "notes.txt"), nil, 0o600)
+
+			if e := s.pruneBackups(now); e != nil {
+				t.Fatalf("pruneBackups() error = %v", e)
+			}
+
+			if backups, _ := s.Backups(); len(backups) != tt.want {
+				t.Errorf("pruneBackups() kept %d backups, want %d", len(backups), tt.want)
+			}
+
+			if _, e := os.Stat(filepath.Join(s.backups.Dir, "notes.txt")); e != nil {
+				t.Errorf("pruneBackups() removed a file that is not a backup")
+			}
+		})
+	}
+}
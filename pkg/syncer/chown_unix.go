@@ -0,0 +1,46 @@
+//go:build unix
+
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// Gives file the owner and group of prev, if they differ.
+func chownLike(file *os.File, prev fs.FileInfo) error {
+	st, ok := prev.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	cur, e := file.Stat()
+	if e != nil {
+		return e
+	}
+
+	if now, ok := cur.Sys().(*syscall.Stat_t); ok && now.Uid == st.Uid && now.Gid == st.Gid {
+		return nil
+	}
+
+	return file.Chown(int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,209 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Returned when the local database and the replicas both changed since the last sync.
+var ErrDiverged = errors.New("changed both locally and on a remote since the last sync")
+
+// Returned by operations on a database whose last conflict has not been resolved yet.
+var ErrUnresolvedConflict = errors.New("has an unresolved conflict")
+
+// Choices for Resolve that are not the path of a file.
+const (
+	KeepLocal  string = "local"
+	KeepRemote string = "remote"
+)
+
+// Conflict between the local database and a version on the replicas that both
+// changed since the last sync.
+type Conflict struct {
+	// Copy of the remote version that was saved next to the local database.
+	Path string `json:"path" yaml:"path"`
+	// Remote version that conflicts with the local database.
+	Version remotes.VersionInfo `json:"version" yaml:"version"`
+	// Time the conflict was found.
+	Detected time.Time `json:"detected" yaml:"detected"`
+}
+
+// Handles a database that changed both locally and on the replicas. With a Merger the newest remote
+// version is merged into the local database and the result is pushed, otherwise both sides are kept.
+func (s *Syncer) diverged(ctx context.Context, st *State, latest []ReplicaResult, last remotes.VersionInfo, local []byte) (*Result, error) {
+	remote, e := s.download(ctx, latest, last)
+	if e != nil {
+		return nil, e
+	}
+
+	if s.merger == nil {
+		return nil, s.keepBoth(st, last, remote)
+	}
+
+	merged, e := s.merger(local, remote)
+	if e != nil {
+		return nil, fmt.Errorf("%w (merging failed: %v)", s.keepBoth(st, last, remote), e)
+	}
+
+	if _, e := s.backupLocal(); e != nil {
+		return nil, e
+	}
+
+	if e := s.replaceLocal(merged); e != nil {
+		return nil, e
+	}
+
+	res, e := s.push(ctx, latest, merged)
+	if res != nil {
+		res.Action = ActionMerged
+	}
+	return res, e
+}
+
+// Keeps both sides of a diverged database, by saving the newest remote version next to the
+// local database and recording the conflict in the journal. Neither side is overwritten.
+func (s *Syncer) keepBoth(st *State, last remotes.VersionInfo, data []byte) error {
+	perms := fs.FileMode(0o600)
+	if stat, e := os.Stat(s.path); e == nil {
+		perms = stat.Mode().Perm()
+	}
+
+	path := s.conflictPath(last)
+	if e := writeAtomic(path, bytes.NewReader(data), perms); e != nil {
+		return e
+	}
+
+	st.Conflict = &Conflict{Path: path, Version: last, Detected: time.Now().UTC()}
+	if e := s.writeState(st); e != nil {
+		return e
+	}
+
+	return fmt.Errorf("%s %w, the version from %s was saved to %s", s.name, ErrDiverged, last.Host, path)
+}
+
+// Finishes a conflict by keeping the local database, the saved remote version, or the contents of
+// another file such as a merge of both, and then syncs the result. The kept contents are compared
+// against the remote version of the conflict, so changes pushed in the meantime are not lost.
+func (s *Syncer) Resolve(ctx context.Context, keep string) (*Result, error) {
+	st, e := s.loadState()
+	if e != nil {
+		return nil, e
+	}
+
+	c := st.Conflict
+	if c == nil {
+		return nil, fmt.Errorf("%s has no conflict to resolve", s.name)
+	}
+
+	src := config.ExpandPath(keep)
+	switch keep {
+	case KeepLocal:
+		src = ""
+	case KeepRemote:
+		src = c.Path
+	}
+
+	if _, e := s.backupLocal(); e != nil {
+		return nil, e
+	}
+
+	if src != "" {
+		data, e := os.ReadFile(src)
+		if e != nil {
+			return nil, e
+		}
+
+		if e := s.replaceLocal(data); e != nil {
+			return nil, e
+		}
+	}
+
+	st.SHA256, st.Size, st.Conflict = c.Version.SHA256, c.Version.Size, nil
+	if e := s.writeState(st); e != nil {
+		return nil, e
+	}
+
+	res, e := s.Sync(ctx)
+	if e != nil {
+		return res, e
+	}
+
+	if e := os.Remove(c.Path); e != nil && !errors.Is(e, fs.ErrNotExist) {
+		return res, e
+	}
+
+	return res, nil
+}
+
+// Returns the recorded conflict of the database, or nil if there is none.
+func (s *Syncer) Conflict() (*Conflict, error) {
+	st, e := s.loadState()
+	if e != nil {
+		return nil, e
+	}
+
+	return st.Conflict, nil
+}
+
+// Returns an error if the database has an unresolved conflict.
+func (s *Syncer) checkConflict() error {
+	st, e := s.loadState()
+	if e != nil {
+		return e
+	}
+
+	if st.Conflict != nil {
+		return s.unresolved(st)
+	}
+
+	return nil
+}
+
+func (s *Syncer) unresolved(st *State) error {
+	return fmt.Errorf("%s %w with the version from %s saved to %s", s.name, ErrUnresolvedConflict, st.Conflict.Version.Host, st.Conflict.Path)
+}
+
+// Returns the path that a conflicting remote version is saved to, which is
+// <name>.conflict-<device>-<timestamp>.kdbx next to the local database.
+func (s *Syncer) conflictPath(v remotes.VersionInfo) string {
+	ext := filepath.Ext(s.path)
+	if ext == "" {
+		ext = ".kdbx"
+	}
+
+	device := strings.NewReplacer("/", "_", "\\", "_", " ", "_").Replace(v.Host)
+	if device == "" {
+		device = "unknown"
+	}
+
+	name := strings.TrimSuffix(filepath.Base(s.path), filepath.Ext(s.path))
+	return filepath.Join(filepath.Dir(s.path), fmt.Sprintf("%s.conflict-%s-%s%s", name, device, v.Timestamp.UTC().Format("20060102T150405"), ext))
+}
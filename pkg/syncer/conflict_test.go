@@ -0,0 +1,194 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Syncs a database between a laptop and a desktop until both changed it since their last sync,
+// and returns the syncer and path of the laptop.
+func newTestConflict(t *testing.T) (*Syncer, string) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+	desktop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	ra, _ := newTestReplica(t, "nas", remoteDir)
+	a := New("personal", laptop, 0, ra)
+	rb, _ := newTestReplica(t, "nas", remoteDir)
+	b := New("personal", desktop, 0, rb)
+
+	os.WriteFile(laptop, []byte("first"), 0o600)
+	if _, e := a.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	if _, e := b.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	os.WriteFile(desktop, []byte("desktop"), 0o600)
+	if _, e := b.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	os.WriteFile(laptop, []byte("laptop"), 0o600)
+	return a, laptop
+}
+
+func TestSyncerKeepsBothSides(t *testing.T) {
+	ctx := context.Background()
+	a, laptop := newTestConflict(t)
+
+	if _, e := a.Sync(ctx); !errors.Is(e, ErrDiverged) {
+		t.Fatalf("Sync() error = %v, want %v", e, ErrDiverged)
+	}
+
+	c, e := a.Conflict()
+	if e != nil || c == nil {
+		t.Fatalf("Conflict() = %v, %v, want the recorded conflict", c, e)
+	}
+
+	if !strings.HasPrefix(filepath.Base(c.Path), "personal.conflict-"+c.Version.Host+"-") || filepath.Ext(c.Path) != ".kdbx" {
+		t.Errorf("conflict saved to %s, unexpected name", c.Path)
+	}
+
+	if got, _ := os.ReadFile(c.Path); string(got) != "desktop" {
+		t.Errorf("conflict copy = %q, want %q", got, "desktop")
+	}
+
+	if got, _ := os.ReadFile(laptop); string(got) != "laptop" {
+		t.Errorf("local database = %q, want it untouched", got)
+	}
+
+	for name, op := range map[string]func(context.Context) (*Result, error){"Sync": a.Sync, "Push": a.Push, "Pull": a.Pull} {
+		if _, e := op(ctx); !errors.Is(e, ErrUnresolvedConflict) {
+			t.Errorf("%s() error = %v, want %v", name, e, ErrUnresolvedConflict)
+		}
+	}
+}
+
+func TestSyncerMerges(t *testing.T) {
+	ctx := context.Background()
+	a, laptop := newTestConflict(t)
+
+	a.MergeWith(func(local, remote []byte) ([]byte, error) {
+		return nil, errors.New("wrong password")
+	})
+	if _, e := a.Sync(ctx); !errors.Is(e, ErrDiverged) || !strings.Contains(e.Error(), "wrong password") {
+		t.Fatalf("Sync() error = %v, want %v with the reason of the failed merge", e, ErrDiverged)
+	}
+
+	// Start over, as the failed merge recorded a conflict.
+	a, laptop = newTestConflict(t)
+	a.MergeWith(func(local, remote []byte) ([]byte, error) {
+		return []byte(string(local) + " and " + string(remote)), nil
+	})
+
+	res, e := a.Sync(ctx)
+	if e != nil || res.Action != ActionMerged {
+		t.Fatalf("Sync() = %v, %v, want %v", res, e, ActionMerged)
+	}
+
+	if got, _ := os.ReadFile(laptop); string(got) != "laptop and desktop" {
+		t.Errorf("local database = %q, want the merged contents", got)
+	}
+
+	if res.Version.ID != 3 {
+		t.Errorf("Sync() pushed version %d, want 3", res.Version.ID)
+	}
+
+	if res, e := a.Sync(ctx); e != nil || res.Action != ActionNone {
+		t.Errorf("second Sync() = %v, %v, want %v", res, e, ActionNone)
+	}
+}
+
+func TestSyncerResolve(t *testing.T) {
+	tests := []struct {
+		name       string
+		keep       string
+		merged     string
+		wantLocal  string
+		wantAction Action
+	}{
+		{
+			name:       "1",
+			keep:       KeepLocal,
+			wantLocal:  "laptop",
+			wantAction: ActionPushed,
+		},
+		{
+			name:       "2",
+			keep:       KeepRemote,
+			wantLocal:  "desktop",
+			wantAction: ActionNone,
+		},
+		{
+			name:       "3",
+			merged:     "laptop and desktop",
+			wantLocal:  "laptop and desktop",
+			wantAction: ActionPushed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a, laptop := newTestConflict(t)
+
+			if _, e := a.Resolve(ctx, KeepLocal); e == nil {
+				t.Fatalf("Resolve() without a conflict error = nil")
+			}
+
+			if _, e := a.Sync(ctx); !errors.Is(e, ErrDiverged) {
+				t.Fatalf("Sync() error = %v, want %v", e, ErrDiverged)
+			}
+
+			c, _ := a.Conflict()
+
+			keep := tt.keep
+			if tt.merged != "" {
+				keep = filepath.Join(t.TempDir(), "merged.kdbx")
+				os.WriteFile(keep, []byte(tt.merged), 0o600)
+			}
+
+			res, e := a.Resolve(ctx, keep)
+			if e != nil || res.Action != tt.wantAction {
+				t.Fatalf("Resolve() = %+v, %v, want %v", res, e, tt.wantAction)
+			}
+
+			if got, _ := os.ReadFile(laptop); string(got) != tt.wantLocal {
+				t.Errorf("local database = %q, want %q", got, tt.wantLocal)
+			}
+
+			if _, e := os.Stat(c.Path); !os.IsNotExist(e) {
+				t.Errorf("conflict copy still exists after resolving")
+			}
+
+			if rep, e := a.Status(ctx, false); e != nil || rep.Status != StatusInSync {
+				t.Errorf("Status() = %v, %v, want %v", rep.Status, e, StatusInSync)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Where a local database stands relative to its replicas.
+type Status int
+
+const (
+	StatusNeverSynced Status = iota
+	StatusInSync
+	StatusLocalAhead
+	StatusRemoteAhead
+	StatusDiverged
+	StatusMissing
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusInSync:
+		return "in sync"
+	case StatusLocalAhead:
+		return "local ahead"
+	case StatusRemoteAhead:
+		return "remote ahead"
+	case StatusDiverged:
+		return "diverged"
+	case StatusMissing:
+		return "missing locally"
+	default:
+		return "never synced"
+	}
+}
+
+// Journal entry that records the last successful sync of a database on this device. It is the
+// base that the local database and the replicas are compared against to tell which side changed.
+type State struct {
+	Database string `json:"database" yaml:"database"`
+	// SHA-256 of the database contents as of the last sync.
+	SHA256 string `json:"sha256" yaml:"sha256"`
+	// Size in bytes of the database as of the last sync, zero if the remotes did not record it.
+	Size int64 `json:"size,omitempty" yaml:"size,omitempty"`
+	// ID of the version holding those contents on each remote, by remote name.
+	Versions map[string]uint `json:"versions" yaml:"versions"`
+	// Time of the last sync.
+	Synced time.Time `json:"synced" yaml:"synced"`
+	// Conflict awaiting resolution, set when a sync found that both sides changed.
+	Conflict *Conflict `json:"conflict,omitempty" yaml:"conflict,omitempty"`
+}
+
+// Returns the path of the journal of database under config.StateDir.
+func StatePath(database string) string {
+	return filepath.Join(config.StateDir(), database+".json")
+}
+
+// Reads the journal of a database, which is empty if it was never synced on this device.
+func LoadState(path string) (*State, error) {
+	st := &State{}
+
+	data, e := os.ReadFile(path)
+	if errors.Is(e, fs.ErrNotExist) {
+		return st, nil
+	} else if e != nil {
+		return nil, e
+	}
+
+	if e := json.Unmarshal(data, st); e != nil {
+		return nil, fmt.Errorf("unable to parse sync state %s: %w", path, e)
+	}
+
+	return st, nil
+}
+
+// Returns the version that the last sync recorded for the replica holding last.
+func (st *State) base(latest []ReplicaResult, last remotes.VersionInfo) uint {
+	for _, r := range latest {
+		if r.Err == nil && r.Version.ID == last.ID {
+			return st.Versions[r.Remote]
+		}
+	}
+
+	return 0
+}
+
+// Compares the hash of the local database with the hash of the last sync and of the newest
+// version on the replicas. An empty remote hash means the replicas were not consulted, in
+// which case only local changes are detected.
+func (st *State) Compare(local, remote string) Status {
+	switch {
+	case local == "":
+		return StatusMissing
+	case local == remote:
+		return StatusInSync
+	case st.SHA256 == "":
+		return StatusNeverSynced
+	case remote == "" && local == st.SHA256:
+		return StatusInSync
+	case remote == "" || remote == st.SHA256:
+		return StatusLocalAhead
+	case local == st.SHA256:
+		return StatusRemoteAhead
+	default:
+		return StatusDiverged
+	}
+}
+
+func (s *Syncer) loadState() (*State, error) {
+	return LoadState(s.statePath)
+}
+
+// Records the outcome of an operation that left the local database matching res.Version,
+// along with the version each replica holds it as.
+func (s *Syncer) saveState(res *Result) error {
+	st := &State{Database: s.name, SHA256: res.Version.SHA256, Size: res.Version.Size, Versions: map[string]uint{}, Synced: time.Now().UTC()}
+	for _, r := range res.Replicas {
+		if r.Err == nil && r.Version.SHA256 == st.SHA256 {
+			st.Versions[r.Remote] = r.Version.ID
+		}
+	}
+
+	return s.writeState(st)
+}
+
+// Replaces the journal atomically, so that a crash never leaves a partially written base behind.
+func (s *Syncer) writeState(st *State) error {
+	data, e := json.MarshalIndent(st, "", "	")
+	if e != nil {
+		return e
+	}
+
+	return writeAtomic(s.statePath, bytes.NewReader(data), 0o600)
+}
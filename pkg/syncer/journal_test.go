@@ -0,0 +1,103 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateCompare(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		local  string
+		remote string
+		want   Status
+	}{
+		{name: "1", base: "a", local: "a", remote: "a", want: StatusInSync},
+		{name: "2", base: "a", local: "b", remote: "a", want: StatusLocalAhead},
+		{name: "3", base: "a", local: "a", remote: "b", want: StatusRemoteAhead},
+		{name: "4", base: "a", local: "b", remote: "c", want: StatusDiverged},
+		{name: "5", base: "a", local: "b", remote: "b", want: StatusInSync},
+		{name: "6", base: "", local: "b", remote: "c", want: StatusNeverSynced},
+		{name: "7", base: "a", local: "", remote: "a", want: StatusMissing},
+		{name: "8", base: "a", local: "a", remote: "", want: StatusInSync},
+		{name: "9", base: "a", local: "b", remote: "", want: StatusLocalAhead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &State{SHA256: tt.base}
+			if got := st.Compare(tt.local, tt.remote); got != tt.want {
+				t.Errorf("Compare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyncerStatus(t *testing.T) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+	desktop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	ra, _ := newTestReplica(t, "nas", remoteDir)
+	a := New("personal", laptop, 0, ra)
+	rb, _ := newTestReplica(t, "nas", remoteDir)
+	b := New("personal", desktop, 0, rb)
+
+	if rep, e := a.Status(ctx, false); e != nil || rep.Status != StatusMissing {
+		t.Fatalf("Status() = %+v, %v, want %v", rep, e, StatusMissing)
+	}
+
+	os.WriteFile(laptop, []byte("first"), 0o600)
+	if _, e := a.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	rep, e := a.Status(ctx, false)
+	if e != nil || rep.Status != StatusInSync || rep.State.Versions["nas"] != 1 {
+		t.Fatalf("Status() = %+v, %v, want in sync at version 1", rep, e)
+	}
+
+	if _, e := b.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	os.WriteFile(desktop, []byte("second"), 0o600)
+	if _, e := b.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	// The laptop only learns about the new version when it consults the remote.
+	if rep, e := a.Status(ctx, true); e != nil || rep.Status != StatusInSync {
+		t.Errorf("Status() offline = %v, %v, want %v", rep.Status, e, StatusInSync)
+	}
+
+	if rep, e := a.Status(ctx, false); e != nil || rep.Status != StatusRemoteAhead {
+		t.Errorf("Status() = %v, %v, want %v", rep.Status, e, StatusRemoteAhead)
+	}
+
+	os.WriteFile(laptop, []byte("third"), 0o600)
+	if rep, e := a.Status(ctx, false); e != nil || rep.Status != StatusDiverged {
+		t.Errorf("Status() = %v, %v, want %v", rep.Status, e, StatusDiverged)
+	}
+}
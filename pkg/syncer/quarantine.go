@@ -0,0 +1,122 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Returned when a downloaded version failed verification and was kept out of the local database.
+var ErrQuarantined = errors.New("failed verification and was quarantined")
+
+// Downloads that are less than this fraction of the size of the database as of the last sync are
+// quarantined, as a database rarely shrinks that much between syncs. Databases without a journal
+// are compared with the size of the local database instead.
+const shrinkLimit = 4
+
+// Download that failed verification, which is kept aside instead of replacing the local database.
+type Quarantined struct {
+	// Copy of the download in the quarantine directory.
+	Path string `json:"path" yaml:"path"`
+	// Remote version that was downloaded.
+	Version remotes.VersionInfo `json:"version" yaml:"version"`
+	// Why the download failed verification.
+	Reason string `json:"reason" yaml:"reason"`
+	// Time the download was quarantined.
+	Quarantined time.Time `json:"quarantined" yaml:"quarantined"`
+}
+
+// Returns the directory that downloads of database which failed verification are kept in.
+func QuarantineDir(database string) string {
+	return filepath.Join(config.StateDir(), "quarantine", database)
+}
+
+// Sets the function that downloaded versions are checked with before they replace the local database.
+func (s *Syncer) VerifyWith(v func(data []byte) error) {
+	s.verify = v
+}
+
+// Checks that data, as downloaded for version v, is fit to replace the local database.
+func (s *Syncer) check(v remotes.VersionInfo, data []byte) error {
+	if hash := remotes.HashBytes(data); v.SHA256 != "" && hash != v.SHA256 {
+		return fmt.Errorf("its SHA-256 %s does not match %s recorded by the remote", hash, v.SHA256)
+	}
+
+	if s.verify != nil {
+		if e := s.verify(data); e != nil {
+			return fmt.Errorf("it is not a valid database: %w", e)
+		}
+	}
+
+	size, of := s.baseSize()
+	if int64(len(data))*shrinkLimit < size {
+		return fmt.Errorf("it is %d bytes, less than a quarter of the %d bytes of %s", len(data), size, of)
+	}
+
+	return nil
+}
+
+// Returns the size that downloads are compared with to tell whether the database shrank, along
+// with what it is the size of. That is the last synced version, or else the local database.
+func (s *Syncer) baseSize() (int64, string) {
+	if st, e := s.loadState(); e == nil && st.SHA256 != "" && st.Size > 0 {
+		return st.Size, "the last synced version"
+	}
+
+	if stat, e := os.Stat(s.path); e == nil {
+		return stat.Size(), "the local database"
+	}
+
+	return 0, ""
+}
+
+// Saves data to the quarantine directory along with why it failed verification,
+// and returns an error that wraps ErrQuarantined.
+func (s *Syncer) quarantine(v remotes.VersionInfo, data []byte, reason error) error {
+	q := &Quarantined{
+		Path:        filepath.Join(s.quarantineDir, fmt.Sprintf("%s-%d%s", s.name, v.ID, filepath.Ext(s.path))),
+		Version:     v,
+		Reason:      reason.Error(),
+		Quarantined: time.Now().UTC(),
+	}
+
+	if e := writeAtomic(q.Path, bytes.NewReader(data), 0o600); e != nil {
+		return fmt.Errorf("unable to quarantine version %d of %s, which %v: %w", v.ID, s.name, reason, e)
+	}
+
+	meta, e := json.MarshalIndent(q, "", "	")
+	if e != nil {
+		return e
+	}
+
+	if e := writeAtomic(q.Path+".json", bytes.NewReader(meta), 0o600); e != nil {
+		return e
+	}
+
+	return fmt.Errorf("version %d of %s %w, the local database was left untouched and the download saved to %s: %v", v.ID, s.name, ErrQuarantined, q.Path, reason)
+}
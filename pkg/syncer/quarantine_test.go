@@ -0,0 +1,159 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyncerQuarantine(t *testing.T) {
+	const local = "the laptop's copy of the database"
+
+	tests := []struct {
+		name   string
+		remote string
+		// Overwrites the stored version behind the back of the remote.
+		tamper string
+		// The remote records no hashes of its versions.
+		noHash bool
+		// Replaces the local database after the first sync.
+		localEdit   string
+		wantErr     bool
+		wantReason  string
+		wantContent string
+	}{
+		{
+			name:        "1",
+			remote:      "the desktop's copy of the database",
+			wantContent: "the desktop's copy of the database",
+		},
+		{
+			name:       "2",
+			remote:     "the desktop's copy of the database",
+			tamper:     "the desktop's copy of the datab\x00\x00\x00",
+			wantErr:    true,
+			wantReason: "does not match",
+		},
+		{
+			name:       "3",
+			remote:     "garbage from a half-written save",
+			wantErr:    true,
+			wantReason: "not a valid database",
+		},
+		{
+			name:       "4",
+			remote:     "tiny",
+			wantErr:    true,
+			wantReason: "less than a quarter",
+		},
+		{
+			name:        "5",
+			remote:      "the desktop's copy of the database",
+			noHash:      true,
+			wantContent: "the desktop's copy of the database",
+		},
+		{
+			name:        "6",
+			remote:      "the desktop's copy of the database",
+			localEdit:   strings.Repeat("a large attachment ", 10),
+			wantContent: "the desktop's copy of the database",
+		},
+		{
+			name:       "7",
+			remote:     "tiny",
+			localEdit:  "x",
+			wantErr:    true,
+			wantReason: "of the last synced version",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			remoteDir := t.TempDir()
+			laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+			desktop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+			ra, flaky := newTestReplica(t, "nas", remoteDir)
+			flaky.noHash = tt.noHash
+			a := New("personal", laptop, 0, ra)
+			a.VerifyWith(func(data []byte) error {
+				if strings.HasPrefix(string(data), "garbage") {
+					return errors.New("bad signature")
+				}
+				return nil
+			})
+			rb, _ := newTestReplica(t, "nas", remoteDir)
+			b := New("personal", desktop, 0, rb)
+
+			os.WriteFile(laptop, []byte(local), 0o600)
+			if _, e := a.Sync(ctx); e != nil {
+				t.Fatalf("Sync() error = %v", e)
+			}
+
+			want := local
+			if tt.localEdit != "" {
+				want = tt.localEdit
+				os.WriteFile(laptop, []byte(want), 0o600)
+			}
+
+			os.WriteFile(desktop, []byte(tt.remote), 0o600)
+			res, e := b.Push(ctx)
+			if e != nil {
+				t.Fatalf("Push() error = %v", e)
+			}
+
+			if tt.tamper != "" {
+				os.WriteFile(filepath.Join(remoteDir, "personal", "00000000000000000002.kdbx"), []byte(tt.tamper), 0o600)
+			}
+
+			_, e = a.Pull(ctx)
+			if errors.Is(e, ErrQuarantined) != tt.wantErr {
+				t.Fatalf("Pull() error = %v, want quarantined %v", e, tt.wantErr)
+			}
+
+			if !tt.wantErr {
+				if got, _ := os.ReadFile(laptop); string(got) != tt.wantContent {
+					t.Errorf("local database = %q, want %q", got, tt.wantContent)
+				}
+				return
+			}
+
+			if got, _ := os.ReadFile(laptop); string(got) != want {
+				t.Errorf("local database = %q, want it untouched", got)
+			}
+
+			path := filepath.Join(a.quarantineDir, "personal-2.kdbx")
+			data, _ := os.ReadFile(path + ".json")
+			q := &Quarantined{}
+			if e := json.Unmarshal(data, q); e != nil || q.Version.ID != res.Version.ID || !strings.Contains(q.Reason, tt.wantReason) {
+				t.Errorf("quarantine record = %+v, %v, want version 2 with a reason containing %q", q, e, tt.wantReason)
+			}
+
+			if _, e := os.Stat(path); e != nil {
+				t.Errorf("quarantined download is missing: %v", e)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Journal of a replace of a local file that is in progress. It is written before the file is
+// touched and removed once the replace is complete, so that RecoverFile can finish or undo a
+// replace that was interrupted by a crash or a power loss.
+type replaceJournal struct {
+	// New contents, fully written and synced.
+	Temp string `json:"temp"`
+	// Hard link to the previous contents, empty if there were none.
+	Backup string `json:"backup,omitempty"`
+	// SHA-256 of the new contents.
+	SHA256 string `json:"sha256"`
+}
+
+// Returns the path of the journal of replaces of path, which is kept next to it.
+func journalPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".replace")
+}
+
+// Returns the path that the previous contents of path are kept at after a replace,
+// which is <name>.old<ext> like the backups of KeePassXC.
+func PreviousPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".old" + ext
+}
+
+// Replaces the contents of path with data without ever leaving it missing or partially written.
+// The data is written and synced to a temporary file in the same directory, which is renamed over
+// path once the previous contents are linked to PreviousPath. The mode and owner of the previous
+// file are carried over. Every step is journaled, see RecoverFile.
+func ReplaceFile(path string, data []byte) error {
+	if e := RecoverFile(path); e != nil {
+		return e
+	}
+
+	dir := filepath.Dir(path)
+	if e := os.MkdirAll(dir, 0o700); e != nil {
+		return e
+	}
+
+	prev, e := os.Stat(path)
+	if e != nil && !errors.Is(e, fs.ErrNotExist) {
+		return e
+	}
+
+	tmp, e := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if e != nil {
+		return e
+	}
+	defer os.Remove(tmp.Name())
+
+	perms := fs.FileMode(0o600)
+	if prev != nil {
+		perms = prev.Mode().Perm()
+	}
+
+	if e := writeFile(tmp, bytes.NewReader(data), perms, prev); e != nil {
+		return e
+	}
+
+	j := &replaceJournal{Temp: tmp.Name(), SHA256: remotes.HashBytes(data)}
+	if prev != nil {
+		j.Backup = PreviousPath(path)
+		if e := linkOrCopy(path, j.Backup, perms); e != nil {
+			return fmt.Errorf("unable to keep the previous contents of %s: %w", path, e)
+		}
+	}
+
+	journal, e := json.Marshal(j)
+	if e != nil {
+		return e
+	}
+
+	if e := writeAtomic(journalPath(path), bytes.NewReader(journal), 0o600); e != nil {
+		return e
+	}
+
+	if e := syncDir(dir); e != nil {
+		return e
+	}
+
+	if e := os.Rename(tmp.Name(), path); e != nil {
+		return e
+	}
+
+	if e := syncDir(dir); e != nil {
+		return e
+	}
+
+	return os.Remove(journalPath(path))
+}
+
+// Finishes or undoes a replace of path that was interrupted. A replace whose new contents made it
+// to disk completely is rolled forward, anything else is rolled back to the previous contents.
+// It does nothing if no replace was in progress.
+func RecoverFile(path string) error {
+	data, e := os.ReadFile(journalPath(path))
+	if errors.Is(e, fs.ErrNotExist) {
+		return nil
+	} else if e != nil {
+		return e
+	}
+
+	j := &replaceJournal{}
+	if e := json.Unmarshal(data, j); e != nil {
+		// The journal is written atomically, so this is not a crash of ours.
+		return fmt.Errorf("unable to parse the replace journal of %s: %w", path, e)
+	}
+
+	switch {
+	case hashFile(path) == j.SHA256:
+		// The rename went through, only the cleanup is missing.
+	case hashFile(j.Temp) == j.SHA256:
+		if e := os.Rename(j.Temp, path); e != nil {
+			return fmt.Errorf("unable to finish the interrupted replace of %s: %w", path, e)
+		}
+	case j.Backup != "":
+		if _, e := os.Stat(path); errors.Is(e, fs.ErrNotExist) {
+			if e := os.Rename(j.Backup, path); e != nil {
+				return fmt.Errorf("unable to roll back the interrupted replace of %s: %w", path, e)
+			}
+		}
+	}
+
+	os.Remove(j.Temp)
+	if e := syncDir(filepath.Dir(path)); e != nil {
+		return e
+	}
+
+	return os.Remove(journalPath(path))
+}
+
+// Returns the SHA-256 of the file at path, or an empty string if it cannot be read.
+func hashFile(path string) string {
+	data, e := os.ReadFile(path)
+	if e != nil {
+		return ""
+	}
+
+	return remotes.HashBytes(data)
+}
+
+// Writes data to file, gives it the mode perms and the owner of prev if there is one, syncs and closes it.
+func writeFile(file *os.File, data io.Reader, perms fs.FileMode, prev fs.FileInfo) error {
+	if _, e := io.Copy(file, data); e != nil {
+		file.Close()
+		return e
+	}
+
+	if e := file.Chmod(perms); e != nil {
+		file.Close()
+		return e
+	}
+
+	if prev != nil {
+		if e := chownLike(file, prev); e != nil {
+			file.Close()
+			return e
+		}
+	}
+
+	if e := file.Sync(); e != nil {
+		file.Close()
+		return e
+	}
+
+	return file.Close()
+}
+
+// Points dst at the contents of src, with a hard link where the filesystem supports them.
+func linkOrCopy(src, dst string, perms fs.FileMode) error {
+	if e := os.Remove(dst); e != nil && !errors.Is(e, fs.ErrNotExist) {
+		return e
+	}
+
+	if e := os.Link(src, dst); e == nil {
+		return nil
+	}
+
+	file, e := os.Open(src)
+	if e != nil {
+		return e
+	}
+	defer file.Close()
+
+	return writeAtomic(dst, file, perms)
+}
+
+// Flushes the entries of dir to disk, so that renames within it survive a power loss.
+func syncDir(dir string) error {
+	d, e := os.Open(dir)
+	if e != nil {
+		return e
+	}
+	defer d.Close()
+
+	// Not every platform supports syncing directories, and those that do not need not.
+	if e := d.Sync(); e != nil && !errors.Is(e, fs.ErrInvalid) && !errors.Is(e, fs.ErrPermission) {
+		return e
+	}
+
+	return nil
+}
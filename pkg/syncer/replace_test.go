@@ -0,0 +1,134 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+func TestReplaceFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	if e := ReplaceFile(path, []byte("first")); e != nil {
+		t.Fatalf("ReplaceFile() error = %v", e)
+	}
+
+	if _, e := os.Stat(PreviousPath(path)); !os.IsNotExist(e) {
+		t.Errorf("previous contents kept for a file that did not exist")
+	}
+
+	os.Chmod(path, 0o640)
+	if e := ReplaceFile(path, []byte("second")); e != nil {
+		t.Fatalf("ReplaceFile() error = %v", e)
+	}
+
+	if got, _ := os.ReadFile(path); string(got) != "second" {
+		t.Errorf("file = %q, want %q", got, "second")
+	}
+
+	if got, _ := os.ReadFile(PreviousPath(path)); string(got) != "first" {
+		t.Errorf("previous contents = %q, want %q", got, "first")
+	}
+
+	if stat, _ := os.Stat(path); stat.Mode().Perm() != 0o640 {
+		t.Errorf("mode = %v, want %v", stat.Mode().Perm(), os.FileMode(0o640))
+	}
+
+	if _, e := os.Stat(journalPath(path)); !os.IsNotExist(e) {
+		t.Errorf("journal left behind after a complete replace")
+	}
+}
+
+func TestRecoverFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// Contents of the file, the temporary file and the previous contents when the replace was
+		// interrupted, an empty string for ones that did not exist.
+		file string
+		temp string
+		prev string
+		want string
+	}{
+		{
+			name: "1",
+			file: "old",
+			temp: "new",
+			prev: "old",
+			want: "new",
+		},
+		{
+			name: "2",
+			file: "old",
+			temp: "ne",
+			prev: "old",
+			want: "old",
+		},
+		{
+			name: "3",
+			file: "new",
+			prev: "old",
+			want: "new",
+		},
+		{
+			name: "4",
+			temp: "ne",
+			prev: "old",
+			want: "old",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "personal.kdbx")
+
+			j := &replaceJournal{Temp: filepath.Join(dir, ".personal.kdbx.tmp-1"), Backup: PreviousPath(path), SHA256: remotes.HashBytes([]byte("new"))}
+			for p, data := range map[string]string{path: tt.file, j.Temp: tt.temp, j.Backup: tt.prev} {
+				if data != "" {
+					os.WriteFile(p, []byte(data), 0o600)
+				}
+			}
+
+			journal, _ := json.Marshal(j)
+			os.WriteFile(journalPath(path), journal, 0o600)
+
+			if e := RecoverFile(path); e != nil {
+				t.Fatalf("RecoverFile() error = %v", e)
+			}
+
+			if got, _ := os.ReadFile(path); string(got) != tt.want {
+				t.Errorf("file = %q, want %q", got, tt.want)
+			}
+
+			for _, p := range []string{j.Temp, journalPath(path)} {
+				if _, e := os.Stat(p); !os.IsNotExist(e) {
+					t.Errorf("%s left behind after recovering", filepath.Base(p))
+				}
+			}
+
+			if e := RecoverFile(path); e != nil {
+				t.Errorf("RecoverFile() without a journal error = %v", e)
+			}
+		})
+	}
+}
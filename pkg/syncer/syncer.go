@@ -0,0 +1,798 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/config"
+	"github.com/fire833/keepassxcync/pkg/kdbx"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+)
+
+// Duration of the leases taken on remotes that support locking. Leases are renewed
+// while a write is in progress, so this only bounds how long a crashed writer blocks others.
+const LeaseTTL time.Duration = time.Minute
+
+// Action that was taken by a sync.
+type Action int
+
+const (
+	ActionNone Action = iota
+	ActionPushed
+	ActionPulled
+	ActionRestored
+	ActionMerged
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionPushed:
+		return "pushed"
+	case ActionPulled:
+		return "pulled"
+	case ActionRestored:
+		return "restored"
+	case ActionMerged:
+		return "merged"
+	default:
+		return "up to date"
+	}
+}
+
+// Merges the contents of the local database with those of a remote version, returning the result.
+type Merger func(local, remote []byte) ([]byte, error)
+
+// Replica is one of the remotes that a database is replicated to.
+type Replica struct {
+	// Name of the remote in the config.
+	Name   string
+	Remote remotes.Remote
+}
+
+// Outcome of an operation on a single replica.
+type ReplicaResult struct {
+	Remote string
+	// Latest version on the replica after the operation.
+	Version remotes.VersionInfo
+	// Whether the replica was behind and has been brought up to date.
+	Repaired bool
+	Err      error
+}
+
+// Result of a push, pull or sync.
+type Result struct {
+	Action Action
+	// Newest version of the database across all replicas.
+	Version  remotes.VersionInfo
+	Replicas []ReplicaResult
+	// Copy of the local database that was taken before it was replaced.
+	Backup string
+}
+
+// Selects the version a restore rolls back to, either by ID or as the
+// last version written before a point in time.
+type RestorePoint struct {
+	ID     uint
+	Before time.Time
+}
+
+// Syncer moves a local database to and from a set of replicas. New versions are
+// written to every replica, and a write succeeds once a quorum of them accepted it.
+// Replicas that missed a version are brought up to date by the next operation that reaches them.
+//
+// Changes are detected by content, the hash of the local database is compared with the hash of
+// the newest version on the replicas and with the hash recorded locally by the last sync.
+type Syncer struct {
+	name          string
+	path          string
+	statePath     string
+	quarantineDir string
+	replicas      []Replica
+	quorum        int
+	backups       config.BackupPolicy
+
+	// Asked whether to take over an expired lease of another device, see OnStaleLease.
+	confirm     func(remote string, lease remotes.Lease) bool
+	confirmLock sync.Mutex
+
+	// Merges diverged databases, see MergeWith.
+	merger Merger
+	// Checks the local database before it is uploaded, see ValidateWith.
+	validate func(data []byte) error
+	// Checks downloads before they replace the local database, see VerifyWith.
+	verify func(data []byte) error
+}
+
+// Builds a Syncer for the database at path, which keeps its state under config.StateDir. A quorum
+// outside of 1 to the number of replicas is replaced with a majority of the replicas.
+func New(name, path string, quorum int, replicas ...Replica) *Syncer {
+	if quorum < 1 || quorum > len(replicas) {
+		quorum = len(replicas)/2 + 1
+	}
+
+	return &Syncer{
+		name:          name,
+		path:          config.ExpandPath(path),
+		statePath:     StatePath(name),
+		quarantineDir: QuarantineDir(name),
+		replicas:      replicas,
+		quorum:        quorum,
+		backups:       (&config.BackupPolicy{}).WithDefaults(BackupDir(name)),
+	}
+}
+
+// Resolves a database and its remotes from the config, and builds a Syncer for them.
+// An empty database name selects the active database. A replace of the local database that
+// was interrupted is finished or undone first, see RecoverFile.
+func Open(ctx context.Context, conf *config.KeepassxCyncConfig, database string) (*Syncer, error) {
+	db, e := conf.ResolveDatabase(database)
+	if e != nil {
+		return nil, e
+	}
+
+	rcs, e := conf.ResolveRemotes(db)
+	if e != nil {
+		return nil, e
+	}
+
+	var replicas []Replica
+	for _, rc := range rcs {
+		r, e := remotes.New(ctx, rc, db.Name)
+		if e != nil {
+			return nil, fmt.Errorf("unable to set up remote %s: %w", rc.Name, e)
+		}
+
+		replicas = append(replicas, Replica{Name: rc.Name, Remote: r})
+	}
+
+	s := New(db.Name, db.Path, db.WriteQuorum(len(replicas)), replicas...)
+	s.KeepBackups(db.Backups)
+	if e := RecoverFile(s.path); e != nil {
+		return nil, e
+	}
+
+	s.ValidateWith(func(data []byte) error {
+		return kdbx.Validate(bytes.NewReader(data), nil)
+	})
+	s.VerifyWith(func(data []byte) error {
+		return kdbx.Validate(bytes.NewReader(data), nil)
+	})
+
+	return s, nil
+}
+
+// Name of the database.
+func (s *Syncer) Name() string { return s.name }
+
+// Path of the local database.
+func (s *Syncer) Path() string { return s.path }
+
+// Closes the remotes of every replica that hold on to a connection.
+func (s *Syncer) Close() error {
+	var errs []error
+	for _, r := range s.replicas {
+		if c, ok := r.Remote.(io.Closer); ok {
+			if e := c.Close(); e != nil {
+				errs = append(errs, fmt.Errorf("unable to close %s: %w", r.Name, e))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Sets the function that is asked whether to take over the expired lease of another device
+// on a remote. Without it, writes to a remote with a stale lease fail until it is unlocked.
+func (s *Syncer) OnStaleLease(confirm func(remote string, lease remotes.Lease) bool) {
+	s.confirm = confirm
+}
+
+// Sets the function that the local database is checked with before it is uploaded. Databases that
+// fail the check are never pushed, so that a damaged file does not become the newest version.
+func (s *Syncer) ValidateWith(v func(data []byte) error) {
+	s.validate = v
+}
+
+// Sets the function that Sync merges a diverged database with, instead of keeping both sides.
+// Both sides are still kept if the merge fails.
+func (s *Syncer) MergeWith(m Merger) {
+	s.merger = m
+}
+
+// Uploads the local database as a new version to every replica, unless the newest
+// version on the replicas already has the same contents.
+func (s *Syncer) Push(ctx context.Context) (*Result, error) {
+	st, e := s.loadState()
+	if e != nil {
+		return nil, fmt.Errorf("unable to read the sync state of %s: %w", s.name, e)
+	} else if st.Conflict != nil {
+		return nil, s.unresolved(st)
+	}
+
+	latest := s.latest(ctx)
+
+	data, e := os.ReadFile(s.path)
+	if e != nil {
+		return nil, e
+	}
+
+	last := newest(latest)
+	if last.ID == 0 {
+		return s.push(ctx, latest, data)
+	}
+
+	// Like Sync, the journal tells whether another device pushed since the last sync,
+	// in which case pushing on top of its version would silently discard it.
+	switch st.Compare(remotes.HashBytes(data), last.SHA256) {
+	case StatusInSync:
+		return s.unchanged(ctx, latest, data)
+	case StatusRemoteAhead:
+		return &Result{Replicas: latest}, fmt.Errorf("refusing to push %s, pull it first: %w", s.name, &remotes.ConflictError{Expected: st.base(latest, last), Actual: last.ID})
+	case StatusDiverged:
+		return s.diverged(ctx, st, latest, last, data)
+	}
+
+	return s.push(ctx, latest, data)
+}
+
+// Uploads data on top of the latest versions that were seen on the replicas.
+// Replicas that moved on since then reject the upload with a *remotes.ConflictError.
+func (s *Syncer) push(ctx context.Context, latest []ReplicaResult, data []byte) (*Result, error) {
+	if s.validate != nil {
+		if e := s.validate(data); e != nil {
+			return nil, fmt.Errorf("refusing to push %s, it is not a valid database: %w", s.name, e)
+		}
+	}
+
+	res := &Result{Action: ActionPushed, Replicas: s.persist(ctx, data, latest, func(r ReplicaResult) bool {
+		return r.Err == nil
+	})}
+	if e := s.checkQuorum(res.Replicas); e != nil {
+		return res, e
+	}
+
+	res.Version = newest(res.Replicas)
+	if e := s.saveState(res); e != nil {
+		return res, e
+	}
+
+	return res, s.touch(res.Version)
+}
+
+// Downloads the newest version from the replicas and replaces the local database with it,
+// unless they already have the same contents. Replicas that do not hold the newest version
+// yet are repaired along the way. Downloads that fail verification are quarantined instead.
+func (s *Syncer) Pull(ctx context.Context) (*Result, error) {
+	if e := s.checkConflict(); e != nil {
+		return nil, e
+	}
+
+	latest := s.latest(ctx)
+	if e := reachable(latest); e != nil {
+		return &Result{Replicas: latest}, e
+	}
+
+	data, e := os.ReadFile(s.path)
+	if e == nil && newest(latest).SHA256 == remotes.HashBytes(data) {
+		return s.unchanged(ctx, latest, data)
+	} else if e != nil && !errors.Is(e, fs.ErrNotExist) {
+		return nil, e
+	}
+
+	return s.pull(ctx, latest)
+}
+
+// Pushes or pulls depending on whether the local database or the replicas changed since the
+// last sync, and repairs replicas that are behind. A database that was never synced on this
+// device and differs from the replicas is handled like one that diverged, as there is no
+// telling which side changed.
+func (s *Syncer) Sync(ctx context.Context) (*Result, error) {
+	latest := s.latest(ctx)
+	if e := reachable(latest); e != nil {
+		return &Result{Replicas: latest}, e
+	}
+
+	last := newest(latest)
+
+	data, e := os.ReadFile(s.path)
+	switch {
+	case errors.Is(e, fs.ErrNotExist) && last.ID == 0:
+		return nil, fmt.Errorf("%s exists neither locally nor on any remote", s.name)
+	case errors.Is(e, fs.ErrNotExist):
+		return s.pull(ctx, latest)
+	case e != nil:
+		return nil, e
+	}
+
+	st, e := s.loadState()
+	if e != nil {
+		return nil, fmt.Errorf("unable to read the sync state of %s: %w", s.name, e)
+	} else if st.Conflict != nil {
+		return nil, s.unresolved(st)
+	}
+
+	if last.ID == 0 {
+		return s.push(ctx, latest, data)
+	}
+
+	switch st.Compare(remotes.HashBytes(data), last.SHA256) {
+	case StatusInSync:
+		return s.unchanged(ctx, latest, data)
+	case StatusLocalAhead:
+		return s.push(ctx, latest, data)
+	case StatusRemoteAhead:
+		return s.pull(ctx, latest)
+	}
+
+	return s.diverged(ctx, st, latest, last, data)
+}
+
+// Report of where a local database stands relative to its replicas.
+type Report struct {
+	Database string
+	Path     string
+	Status   Status
+	// SHA-256 of the local database, empty if it does not exist.
+	SHA256 string
+	// Journal entry of the last sync on this device.
+	State *State
+	// Newest version across the replicas, unset when the replicas were not consulted.
+	Version  remotes.VersionInfo
+	Replicas []ReplicaResult
+}
+
+// Compares the local database with the journal of the last sync. Unless offline is set
+// the latest version of every replica is fetched as well, which is required to tell
+// whether the replicas changed since.
+func (s *Syncer) Status(ctx context.Context, offline bool) (*Report, error) {
+	st, e := s.loadState()
+	if e != nil {
+		return nil, e
+	}
+
+	rep := &Report{Database: s.name, Path: s.path, State: st}
+
+	data, e := os.ReadFile(s.path)
+	if e == nil {
+		rep.SHA256 = remotes.HashBytes(data)
+	} else if !errors.Is(e, fs.ErrNotExist) {
+		return nil, e
+	}
+
+	if !offline {
+		rep.Replicas = s.latest(ctx)
+		if e := reachable(rep.Replicas); e != nil {
+			return rep, e
+		}
+
+		rep.Version = newest(rep.Replicas)
+	}
+
+	rep.Status = st.Compare(rep.SHA256, rep.Version.SHA256)
+	return rep, nil
+}
+
+// Handles a local database that matches the newest version on the replicas, by recording
+// it as synced and repairing the replicas that are behind.
+func (s *Syncer) unchanged(ctx context.Context, latest []ReplicaResult, data []byte) (*Result, error) {
+	res := &Result{Action: ActionNone, Version: newest(latest), Replicas: latest}
+	if lagging(latest, res.Version) {
+		if e := s.repair(ctx, res, data); e != nil {
+			return res, e
+		}
+	}
+
+	return res, s.saveState(res)
+}
+
+// Replaces the local database with an older version from the named replica, after verifying its contents
+// and backing up the local database. With publish set the restored contents are also pushed as a new version
+// to every replica. Otherwise the newest version on the replicas is recorded as the base of the restore, so
+// that the next sync sees the local database as ahead of them and publishes it.
+func (s *Syncer) Restore(ctx context.Context, remote string, point RestorePoint, publish bool) (*Result, error) {
+	if e := s.checkConflict(); e != nil {
+		return nil, e
+	}
+
+	var replica *Replica
+	for i := range s.replicas {
+		if s.replicas[i].Name == remote {
+			replica = &s.replicas[i]
+		}
+	}
+
+	if replica == nil {
+		return nil, fmt.Errorf("remote %s does not hold a replica of %s", remote, s.name)
+	}
+
+	id := point.ID
+	if id == 0 {
+		versions, e := remotes.ListAllVersions(ctx, replica.Remote)
+		if e != nil {
+			return nil, e
+		}
+
+		for _, v := range versions {
+			if v.Timestamp.Before(point.Before) {
+				id = v.ID
+			}
+		}
+
+		if id == 0 {
+			return nil, fmt.Errorf("%s has no version of %s from before %s", remote, s.name, point.Before.Local().Format(time.RFC3339))
+		}
+	}
+
+	body, info, e := replica.Remote.GetVersion(ctx, id)
+	if e != nil {
+		return nil, fmt.Errorf("unable to download version %d of %s: %w", id, s.name, e)
+	}
+
+	data, e := io.ReadAll(body)
+	body.Close()
+	if e != nil {
+		return nil, e
+	}
+
+	if info.Size != 0 && int64(len(data)) != info.Size {
+		return nil, fmt.Errorf("version %d of %s is %d bytes, not the %d bytes recorded by %s", id, s.name, len(data), info.Size, remote)
+	}
+
+	if e := s.check(info, data); e != nil {
+		return nil, s.quarantine(info, data, e)
+	}
+
+	latest := s.latest(ctx)
+	if e := reachable(latest); e != nil {
+		return &Result{Replicas: latest}, e
+	}
+
+	backup, e := s.backupLocal()
+	if e != nil {
+		return &Result{Replicas: latest}, e
+	}
+
+	if e := s.replaceLocal(data); e != nil {
+		return &Result{Replicas: latest, Backup: backup}, e
+	}
+
+	// The restore is a deliberate rollback, so it is pushed on top of whatever the replicas
+	// hold without checking the journal, which would take their newer versions for a conflict.
+	if publish {
+		res, e := s.push(ctx, latest, data)
+		if res != nil {
+			res.Action, res.Backup = ActionRestored, backup
+		}
+		return res, e
+	}
+
+	res := &Result{Action: ActionRestored, Version: info, Replicas: latest, Backup: backup}
+	return res, s.saveState(&Result{Version: newest(latest), Replicas: latest})
+}
+
+func (s *Syncer) pull(ctx context.Context, latest []ReplicaResult) (*Result, error) {
+	last := newest(latest)
+	if last.ID == 0 {
+		return &Result{Replicas: latest}, fmt.Errorf("no remote holds a version of %s yet", s.name)
+	}
+
+	data, e := s.download(ctx, latest, last)
+	if e != nil {
+		return &Result{Replicas: latest}, e
+	}
+
+	if e := s.check(last, data); e != nil {
+		return &Result{Replicas: latest}, s.quarantine(last, data, e)
+	}
+
+	backup, e := s.backupLocal()
+	if e != nil {
+		return &Result{Replicas: latest}, e
+	}
+
+	if e := s.replaceLocal(data); e != nil {
+		return &Result{Replicas: latest, Backup: backup}, e
+	}
+
+	res := &Result{Action: ActionPulled, Version: last, Replicas: latest, Backup: backup}
+	if e := s.touch(last); e != nil {
+		return res, e
+	}
+
+	if e := s.repair(ctx, res, data); e != nil {
+		return res, e
+	}
+
+	return res, s.saveState(res)
+}
+
+// Writes data to the replicas in res that do not hold it as their latest version yet.
+// Failing to repair a replica is not an error of the operation as a whole, it is
+// retried on the next run.
+func (s *Syncer) repair(ctx context.Context, res *Result, data []byte) error {
+	hash := remotes.HashBytes(data)
+	behind := func(r ReplicaResult) bool {
+		return r.Err == nil && r.Version.SHA256 != hash
+	}
+
+	repaired := s.persist(ctx, data, res.Replicas, behind)
+	for i, r := range res.Replicas {
+		repaired[i].Repaired = behind(r) && repaired[i].Err == nil
+	}
+
+	res.Replicas = repaired
+	res.Version = newest(res.Replicas)
+	return s.touch(res.Version)
+}
+
+// Fetches the latest version of every replica concurrently.
+func (s *Syncer) latest(ctx context.Context) []ReplicaResult {
+	results := make([]ReplicaResult, len(s.replicas))
+	s.each(func(i int, r Replica) {
+		info, e := r.Remote.GetLastVersion(ctx)
+		results[i] = ReplicaResult{Remote: r.Name, Version: info, Err: e}
+	})
+
+	return results
+}
+
+// Writes data as a new version on top of the latest version of every replica that
+// pick selects, concurrently. The results of the other replicas are passed through.
+func (s *Syncer) persist(ctx context.Context, data []byte, latest []ReplicaResult, pick func(ReplicaResult) bool) []ReplicaResult {
+	results := make([]ReplicaResult, len(s.replicas))
+	s.each(func(i int, r Replica) {
+		if !pick(latest[i]) {
+			results[i] = latest[i]
+			return
+		}
+
+		unlock, e := s.lock(ctx, r)
+		if e != nil {
+			results[i] = ReplicaResult{Remote: r.Name, Version: latest[i].Version, Err: e}
+			return
+		}
+		defer unlock()
+
+		info, e := r.Remote.PersistVersion(ctx, bytes.NewReader(data), latest[i].Version.ID)
+		results[i] = ReplicaResult{Remote: r.Name, Version: info, Err: e}
+	})
+
+	return results
+}
+
+// Acquires a lease on replicas that support locking, and keeps renewing it until
+// the returned function is called to release it.
+func (s *Syncer) lock(ctx context.Context, r Replica) (func(), error) {
+	l, ok := r.Remote.(remotes.Locker)
+	if !ok {
+		return func() {}, nil
+	}
+
+	lease, e := l.Lock(ctx, remotes.Hostname(), LeaseTTL, false)
+
+	var locked *remotes.LockedError
+	if errors.As(e, &locked) && locked.Stale {
+		if !s.confirmTakeover(r.Name, locked.Lease) {
+			return nil, fmt.Errorf("%w, run remote unlock --force if that device is gone", e)
+		}
+
+		lease, e = l.Lock(ctx, remotes.Hostname(), LeaseTTL, true)
+	}
+
+	if e != nil {
+		return nil, e
+	}
+
+	stop := make(chan struct{})
+	held := make(chan remotes.Lease)
+	go func() {
+		ticker := time.NewTicker(LeaseTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// A lease that could not be renewed is left to the version
+				// preconditions, which still reject conflicting writes.
+				if renewed, e := l.Renew(ctx, lease, LeaseTTL); e == nil {
+					lease = renewed
+				}
+			case <-stop:
+				held <- lease
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		// A lease that fails to be released simply expires.
+		l.Unlock(ctx, <-held)
+	}, nil
+}
+
+// Asks whether to take over a stale lease, one replica at a time.
+func (s *Syncer) confirmTakeover(remote string, lease remotes.Lease) bool {
+	if s.confirm == nil {
+		return false
+	}
+
+	s.confirmLock.Lock()
+	defer s.confirmLock.Unlock()
+	return s.confirm(remote, lease)
+}
+
+// Downloads version last from the first replica that holds it.
+func (s *Syncer) download(ctx context.Context, latest []ReplicaResult, last remotes.VersionInfo) ([]byte, error) {
+	var errs []error
+	for i, r := range latest {
+		if r.Err != nil || r.Version.SHA256 != last.SHA256 {
+			continue
+		}
+
+		body, _, e := s.replicas[i].Remote.GetVersion(ctx, r.Version.ID)
+		if e != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Remote, e))
+			continue
+		}
+
+		data, e := io.ReadAll(body)
+		body.Close()
+		if e != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Remote, e))
+			continue
+		}
+
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("unable to download %s from any remote: %w", s.name, errors.Join(errs...))
+}
+
+// Runs f for every replica concurrently and waits for all of them to return.
+func (s *Syncer) each(f func(i int, r Replica)) {
+	done := make(chan struct{})
+	for i, r := range s.replicas {
+		go func(i int, r Replica) {
+			f(i, r)
+			done <- struct{}{}
+		}(i, r)
+	}
+
+	for range s.replicas {
+		<-done
+	}
+}
+
+func (s *Syncer) checkQuorum(results []ReplicaResult) error {
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Remote, r.Err))
+		}
+	}
+
+	accepted := len(results) - len(errs)
+	if accepted >= s.quorum {
+		return nil
+	}
+
+	e := errors.Join(errs...)
+	if remotes.IsConflict(e) {
+		return fmt.Errorf("%s was changed on a remote by another device in the meantime, sync again to pick up its changes: %w", s.name, e)
+	}
+
+	return fmt.Errorf("only %d of %d remotes accepted %s, %d required: %w", accepted, len(results), s.name, s.quorum, e)
+}
+
+// Sets the modification time of the local database to the timestamp of the version it matches,
+// which is what a sync compares against on devices that have no recorded state yet.
+func (s *Syncer) touch(info remotes.VersionInfo) error {
+	if info.Timestamp.IsZero() {
+		return nil
+	}
+
+	return os.Chtimes(s.path, time.Now(), info.Timestamp)
+}
+
+// Replaces the local database with data, see ReplaceFile.
+func (s *Syncer) replaceLocal(data []byte) error {
+	return ReplaceFile(s.path, data)
+}
+
+// Writes data to a temporary file next to path and renames it into place.
+func writeAtomic(path string, data io.Reader, perms fs.FileMode) error {
+	if e := os.MkdirAll(filepath.Dir(path), 0o700); e != nil {
+		return e
+	}
+
+	tmp, e := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if e != nil {
+		return e
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, e := io.Copy(tmp, data); e != nil {
+		tmp.Close()
+		return e
+	}
+
+	if e := tmp.Chmod(perms); e != nil {
+		tmp.Close()
+		return e
+	}
+
+	if e := tmp.Sync(); e != nil {
+		tmp.Close()
+		return e
+	}
+
+	if e := tmp.Close(); e != nil {
+		return e
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Returns the most recently written version among the results.
+func newest(results []ReplicaResult) remotes.VersionInfo {
+	var last remotes.VersionInfo
+	for _, r := range results {
+		if r.Err == nil && r.Version.ID != 0 && r.Version.Timestamp.After(last.Timestamp) {
+			last = r.Version
+		}
+	}
+
+	return last
+}
+
+// Returns an error if none of the replicas could be reached.
+func reachable(results []ReplicaResult) error {
+	var errs []error
+	for _, r := range results {
+		if r.Err == nil {
+			return nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", r.Remote, r.Err))
+	}
+
+	return fmt.Errorf("unable to reach any remote: %w", errors.Join(errs...))
+}
+
+// Reports whether any reachable replica holds a different latest version than last.
+func lagging(results []ReplicaResult, last remotes.VersionInfo) bool {
+	for _, r := range results {
+		if r.Err == nil && r.Version.SHA256 != last.SHA256 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,617 @@
+/*
+*	Copyright (C) 2023 Kendall Tauser
+*
+*	This program is free software; you can redistribute it and/or modify
+*	it under the terms of the GNU General Public License as published by
+*	the Free Software Foundation; either version 2 of the License, or
+*	(at your option) any later version.
+*
+*	This program is distributed in the hope that it will be useful,
+*	but WITHOUT ANY WARRANTY; without even the implied warranty of
+*	MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+*	GNU General Public License for more details.
+*
+*	You should have received a copy of the GNU General Public License along
+*	with this program; if not, write to the Free Software Foundation, Inc.,
+*	51 Franklin Street, Fifth Floor, Boston, MA 02110-1301 USA.
+ */
+
+package syncer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fire833/keepassxcync/pkg/kdbx"
+	"github.com/fire833/keepassxcync/pkg/remotes"
+	"github.com/fire833/keepassxcync/pkg/remotes/fs"
+)
+
+// Remote that fails every call while it is down, to simulate a provider outage.
+type flakyRemote struct {
+	remotes.Remote
+	down bool
+	// Called before every upload, so tests can race another device.
+	beforePersist func()
+	// Drops the hashes of versions, like servers that do not record them.
+	noHash bool
+}
+
+var errOutage = errors.New("provider outage")
+
+func (r *flakyRemote) PersistVersion(ctx context.Context, data io.Reader, parent uint) (remotes.VersionInfo, error) {
+	if r.down {
+		return remotes.VersionInfo{}, errOutage
+	}
+	if r.beforePersist != nil {
+		r.beforePersist()
+	}
+	return r.Remote.PersistVersion(ctx, data, parent)
+}
+
+func (r *flakyRemote) GetVersion(ctx context.Context, id uint) (io.ReadCloser, remotes.VersionInfo, error) {
+	if r.down {
+		return nil, remotes.VersionInfo{}, errOutage
+	}
+	rc, info, e := r.Remote.GetVersion(ctx, id)
+	if r.noHash {
+		info.SHA256 = ""
+	}
+	return rc, info, e
+}
+
+func (r *flakyRemote) GetLastVersion(ctx context.Context) (remotes.VersionInfo, error) {
+	if r.down {
+		return remotes.VersionInfo{}, errOutage
+	}
+	info, e := r.Remote.GetLastVersion(ctx)
+	if r.noHash {
+		info.SHA256 = ""
+	}
+	return info, e
+}
+
+// Builds a replica backed by a directory. The sync state is kept in a fresh directory
+// as well, so that tests never share it with each other or with the user.
+func newTestReplica(t *testing.T, name, dir string) (Replica, *flakyRemote) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	r, e := fs.New(&fs.Options{Dir: dir, Database: "personal"})
+	if e != nil {
+		t.Fatalf("fs.New() error = %v", e)
+	}
+
+	flaky := &flakyRemote{Remote: r}
+	return Replica{Name: name, Remote: flaky}, flaky
+}
+
+func TestSyncerSync(t *testing.T) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+	desktop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	// Each device gets its own sync state, as the state is set up along with the replica.
+	ra, _ := newTestReplica(t, "nas", remoteDir)
+	a := New("personal", laptop, 0, ra)
+	rb, _ := newTestReplica(t, "nas", remoteDir)
+	b := New("personal", desktop, 0, rb)
+
+	if _, e := a.Sync(ctx); e == nil {
+		t.Fatalf("Sync() error = nil, want error for a database that exists nowhere")
+	}
+
+	os.WriteFile(laptop, []byte("first"), 0o600)
+	if res, e := a.Sync(ctx); e != nil || res.Action != ActionPushed || res.Version.ID != 1 {
+		t.Fatalf("Sync() = %+v, %v, want pushed version 1", res, e)
+	}
+
+	if res, e := a.Sync(ctx); e != nil || res.Action != ActionNone {
+		t.Fatalf("Sync() = %+v, %v, want up to date", res, e)
+	}
+
+	if res, e := b.Sync(ctx); e != nil || res.Action != ActionPulled || res.Version.ID != 1 {
+		t.Fatalf("Sync() = %+v, %v, want pulled version 1", res, e)
+	}
+
+	if got, _ := os.ReadFile(desktop); !bytes.Equal(got, []byte("first")) {
+		t.Errorf("pulled database = %q, want %q", got, "first")
+	}
+
+	// Edit the database on the desktop and make sure the laptop picks it up.
+	os.WriteFile(desktop, []byte("second"), 0o600)
+
+	if res, e := b.Sync(ctx); e != nil || res.Action != ActionPushed || res.Version.ID != 2 {
+		t.Fatalf("Sync() = %+v, %v, want pushed version 2", res, e)
+	}
+
+	if res, e := a.Sync(ctx); e != nil || res.Action != ActionPulled {
+		t.Fatalf("Sync() = %+v, %v, want pulled", res, e)
+	}
+
+	if got, _ := os.ReadFile(laptop); !bytes.Equal(got, []byte("second")) {
+		t.Errorf("pulled database = %q, want %q", got, "second")
+	}
+}
+
+func TestSyncerPullPreservesMode(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	r, _ := newTestReplica(t, "nas", t.TempDir())
+	s := New("personal", path, 0, r)
+
+	if _, e := s.Pull(ctx); e == nil {
+		t.Fatalf("Pull() error = nil, want error for an empty remote")
+	}
+
+	os.WriteFile(path, []byte("first"), 0o640)
+	os.Chmod(path, 0o640)
+	if _, e := s.Push(ctx); e != nil {
+		t.Fatalf("Push() error = %v", e)
+	}
+
+	if _, e := s.Pull(ctx); e != nil {
+		t.Fatalf("Pull() error = %v", e)
+	}
+
+	if stat, _ := os.Stat(path); stat.Mode().Perm() != 0o640 {
+		t.Errorf("mode after Pull() = %v, want %v", stat.Mode().Perm(), os.FileMode(0o640))
+	}
+}
+
+func TestSyncerQuorum(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "personal.kdbx")
+	os.WriteFile(path, []byte("first"), 0o600)
+
+	aws, _ := newTestReplica(t, "aws", t.TempDir())
+	nas, _ := newTestReplica(t, "nas", t.TempDir())
+	gdrive, outage := newTestReplica(t, "gdrive", t.TempDir())
+	outage.down = true
+
+	if _, e := New("personal", path, 3, aws, nas, gdrive).Push(ctx); !errors.Is(e, errOutage) {
+		t.Errorf("Push() with quorum 3 error = %v, want %v", e, errOutage)
+	}
+
+	s := New("personal", path, 2, aws, nas, gdrive)
+	res, e := s.Push(ctx)
+	if e != nil {
+		t.Fatalf("Push() with quorum 2 error = %v", e)
+	}
+	if !errors.Is(res.Replicas[2].Err, errOutage) {
+		t.Errorf("Push() result for gdrive = %+v, want outage", res.Replicas[2])
+	}
+
+	// Once the provider is back, the next run brings it up to date.
+	outage.down = false
+	res, e = s.Sync(ctx)
+	if e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+	if res.Action != ActionNone || !res.Replicas[2].Repaired {
+		t.Errorf("Sync() = %+v, want gdrive to be repaired", res)
+	}
+
+	body, _, e := gdrive.Remote.GetVersion(ctx, 1)
+	if e != nil {
+		t.Fatalf("GetVersion() error = %v", e)
+	}
+	defer body.Close()
+
+	if got, _ := io.ReadAll(body); !bytes.Equal(got, []byte("first")) {
+		t.Errorf("repaired version = %q, want %q", got, "first")
+	}
+
+	if res, e := s.Sync(ctx); e != nil || res.Action != ActionNone || res.Replicas[2].Repaired {
+		t.Errorf("Sync() = %+v, %v, want nothing to do", res, e)
+	}
+}
+
+func TestSyncerConflict(t *testing.T) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	r, flaky := newTestReplica(t, "nas", remoteDir)
+	s := New("personal", laptop, 0, r)
+
+	os.WriteFile(laptop, []byte("first"), 0o600)
+	if _, e := s.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	// The desktop pushes right after the laptop looked at the remote.
+	desktop, _ := newTestReplica(t, "nas", remoteDir)
+	flaky.beforePersist = func() {
+		flaky.beforePersist = nil
+		if _, e := desktop.Remote.PersistVersion(ctx, bytes.NewReader([]byte("desktop")), 1); e != nil {
+			t.Fatalf("PersistVersion() error = %v", e)
+		}
+	}
+
+	os.WriteFile(laptop, []byte("laptop"), 0o600)
+
+	if _, e := s.Sync(ctx); !remotes.IsConflict(e) {
+		t.Fatalf("Sync() error = %v, want conflict", e)
+	}
+
+	last, e := r.Remote.GetLastVersion(ctx)
+	if e != nil || last.ID != 2 || last.SHA256 != remotes.HashBytes([]byte("desktop")) {
+		t.Errorf("GetLastVersion() = %+v, %v, want the version of the desktop", last, e)
+	}
+
+	if got, _ := os.ReadFile(laptop); !bytes.Equal(got, []byte("laptop")) {
+		t.Errorf("local database = %q, want it untouched", got)
+	}
+}
+
+func TestSyncerPushChecksJournal(t *testing.T) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+	desktop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	ra, _ := newTestReplica(t, "nas", remoteDir)
+	a := New("personal", laptop, 0, ra)
+	rb, _ := newTestReplica(t, "nas", remoteDir)
+	b := New("personal", desktop, 0, rb)
+
+	os.WriteFile(laptop, []byte("first"), 0o600)
+	if _, e := a.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	if _, e := b.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	os.WriteFile(desktop, []byte("desktop"), 0o600)
+	if _, e := b.Push(ctx); e != nil {
+		t.Fatalf("Push() error = %v", e)
+	}
+
+	// The laptop last synced version 1, so its unchanged copy must not replace version 2.
+	if _, e := a.Push(ctx); !remotes.IsConflict(e) {
+		t.Errorf("Push() error = %v, want conflict", e)
+	}
+
+	// Once the laptop changes as well, both sides are kept.
+	os.WriteFile(laptop, []byte("laptop"), 0o600)
+	if _, e := a.Push(ctx); !errors.Is(e, ErrDiverged) {
+		t.Errorf("Push() error = %v, want %v", e, ErrDiverged)
+	}
+
+	last, e := ra.Remote.GetLastVersion(ctx)
+	if e != nil || last.ID != 2 || last.SHA256 != remotes.HashBytes([]byte("desktop")) {
+		t.Errorf("GetLastVersion() = %+v, %v, want the version of the desktop", last, e)
+	}
+}
+
+func TestSyncerLease(t *testing.T) {
+	ctx := context.Background()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+	os.WriteFile(laptop, []byte("laptop"), 0o600)
+
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	r, e := fs.New(&fs.Options{Dir: t.TempDir(), Database: "personal"})
+	if e != nil {
+		t.Fatalf("fs.New() error = %v", e)
+	}
+
+	s := New("personal", laptop, 0, Replica{Name: "nas", Remote: r})
+
+	active, e := r.Lock(ctx, "desktop", time.Minute, false)
+	if e != nil {
+		t.Fatalf("Lock() error = %v", e)
+	}
+
+	var locked *remotes.LockedError
+	if _, e := s.Push(ctx); !errors.As(e, &locked) || locked.Lease.Owner != "desktop" {
+		t.Fatalf("Push() error = %v, want lease of desktop", e)
+	}
+
+	r.Unlock(ctx, active)
+	if _, e := r.Lock(ctx, "desktop", -time.Second, false); e != nil {
+		t.Fatalf("Lock() error = %v", e)
+	}
+
+	tests := []struct {
+		name    string
+		confirm bool
+		wantErr bool
+	}{
+		{
+			name:    "1",
+			confirm: false,
+			wantErr: true,
+		},
+		{
+			name:    "2",
+			confirm: true,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asked := 0
+			s.OnStaleLease(func(remote string, lease remotes.Lease) bool {
+				asked++
+				return tt.confirm
+			})
+
+			if _, e := s.Push(ctx); (e != nil) != tt.wantErr {
+				t.Fatalf("Push() error = %v, wantErr %v", e, tt.wantErr)
+			}
+
+			if asked != 1 {
+				t.Errorf("confirmation asked %d times, want 1", asked)
+			}
+		})
+	}
+
+	// The lease is released once the push is done.
+	if current, e := r.CurrentLease(ctx); e != nil || current != nil {
+		t.Errorf("CurrentLease() = %v, %v, want nil, nil", current, e)
+	}
+}
+
+func TestSyncerRestore(t *testing.T) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	r, _ := newTestReplica(t, "nas", remoteDir)
+	s := New("personal", laptop, 0, r)
+
+	var versions []remotes.VersionInfo
+	for _, data := range []string{"first", "second", "third"} {
+		os.WriteFile(laptop, []byte(data), 0o600)
+		res, e := s.Push(ctx)
+		if e != nil {
+			t.Fatalf("Push() error = %v", e)
+		}
+		versions = append(versions, res.Version)
+	}
+
+	res, e := s.Restore(ctx, "nas", RestorePoint{ID: 1}, false)
+	if e != nil {
+		t.Fatalf("Restore() error = %v", e)
+	}
+
+	if got, _ := os.ReadFile(laptop); string(got) != "first" {
+		t.Errorf("local database = %q, want %q", got, "first")
+	}
+
+	if got, _ := os.ReadFile(res.Backup); string(got) != "third" {
+		t.Errorf("backup = %q, want %q", got, "third")
+	}
+
+	if last, _ := r.Remote.GetLastVersion(ctx); last.ID != 3 {
+		t.Errorf("GetLastVersion() = %d, want 3 as the restore was not published", last.ID)
+	}
+
+	// The last version before the third one is the second one, which is published as version 4.
+	res, e = s.Restore(ctx, "nas", RestorePoint{Before: versions[2].Timestamp}, true)
+	if e != nil {
+		t.Fatalf("Restore() error = %v", e)
+	}
+
+	last, e := r.Remote.GetLastVersion(ctx)
+	if e != nil || last.ID != 4 || last.SHA256 != remotes.HashBytes([]byte("second")) || res.Version.ID != 4 {
+		t.Errorf("GetLastVersion() = %+v, %v, want the second version published as version 4", last, e)
+	}
+
+	// A version whose contents no longer match its checksum is never restored.
+	os.WriteFile(filepath.Join(remoteDir, "personal", "00000000000000000003.kdbx"), []byte("bitrot"), 0o600)
+	if _, e := s.Restore(ctx, "nas", RestorePoint{ID: 3}, false); e == nil {
+		t.Errorf("Restore() of a corrupted version error = nil")
+	}
+
+	if got, _ := os.ReadFile(laptop); string(got) != "second" {
+		t.Errorf("local database = %q, want it untouched", got)
+	}
+
+	if _, e := s.Restore(ctx, "nas", RestorePoint{Before: versions[0].Timestamp}, false); e == nil {
+		t.Errorf("Restore() from before the first version error = nil")
+	}
+}
+
+func TestSyncerRestoreSticks(t *testing.T) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+	desktop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	ra, _ := newTestReplica(t, "nas", remoteDir)
+	a := New("personal", laptop, 0, ra)
+	rb, _ := newTestReplica(t, "nas", remoteDir)
+	b := New("personal", desktop, 0, rb)
+
+	for _, data := range []string{"first", "second"} {
+		os.WriteFile(laptop, []byte(data), 0o600)
+		if _, e := a.Sync(ctx); e != nil {
+			t.Fatalf("Sync() error = %v", e)
+		}
+	}
+
+	// The desktop pushes a version the laptop has not seen yet.
+	if _, e := b.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+	os.WriteFile(desktop, []byte("third"), 0o600)
+	if res, e := b.Sync(ctx); e != nil || res.Action != ActionPushed || res.Version.ID != 3 {
+		t.Fatalf("Sync() = %+v, %v, want pushed version 3", res, e)
+	}
+
+	if res, e := a.Restore(ctx, "nas", RestorePoint{ID: 1}, true); e != nil || res.Action != ActionRestored || res.Version.ID != 4 {
+		t.Fatalf("Restore() = %+v, %v, want version 1 published as version 4", res, e)
+	}
+
+	if res, e := a.Sync(ctx); e != nil || res.Action != ActionNone {
+		t.Errorf("Sync() after a published restore = %+v, %v, want up to date", res, e)
+	}
+
+	if res, e := b.Sync(ctx); e != nil || res.Action != ActionPulled || res.Version.ID != 4 {
+		t.Errorf("Sync() = %+v, %v, want the restore pulled", res, e)
+	}
+
+	// Without publishing, the next sync publishes the restore instead of pulling over it.
+	if _, e := a.Restore(ctx, "nas", RestorePoint{ID: 2}, false); e != nil {
+		t.Fatalf("Restore() error = %v", e)
+	}
+
+	if res, e := a.Sync(ctx); e != nil || res.Action != ActionPushed || res.Version.ID != 5 {
+		t.Errorf("Sync() after a restore = %+v, %v, want pushed version 5", res, e)
+	}
+
+	if _, e := b.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	for _, path := range []string{laptop, desktop} {
+		if got, _ := os.ReadFile(path); string(got) != "second" {
+			t.Errorf("database %s = %q, want the restored %q", path, got, "second")
+		}
+	}
+}
+
+func TestSyncerNeverSynced(t *testing.T) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+	desktop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	ra, _ := newTestReplica(t, "nas", remoteDir)
+	a := New("personal", laptop, 0, ra)
+
+	os.WriteFile(laptop, []byte("first"), 0o600)
+	if _, e := a.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	// A copy that matches the replicas is recorded as synced, whatever its modification time.
+	rb, _ := newTestReplica(t, "nas", remoteDir)
+	b := New("personal", desktop, 0, rb)
+	os.WriteFile(desktop, []byte("first"), 0o600)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(desktop, past, past)
+
+	if res, e := b.Sync(ctx); e != nil || res.Action != ActionNone || res.Version.ID != 1 {
+		t.Fatalf("Sync() = %+v, %v, want up to date at version 1", res, e)
+	}
+
+	if st, e := b.loadState(); e != nil || st.SHA256 != remotes.HashBytes([]byte("first")) || st.Versions["nas"] != 1 {
+		t.Errorf("loadState() = %+v, %v, want version 1 recorded", st, e)
+	}
+
+	// A copy that differs is never pushed over the replicas, even when it is newer.
+	rc, _ := newTestReplica(t, "nas", remoteDir)
+	c := New("personal", filepath.Join(t.TempDir(), "personal.kdbx"), 0, rc)
+	os.WriteFile(c.Path(), []byte("other"), 0o600)
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(c.Path(), future, future)
+
+	if _, e := c.Sync(ctx); !errors.Is(e, ErrDiverged) {
+		t.Fatalf("Sync() error = %v, want %v", e, ErrDiverged)
+	}
+
+	if got, _ := os.ReadFile(c.Path()); string(got) != "other" {
+		t.Errorf("local database = %q, want it untouched", got)
+	}
+
+	if last, e := rc.Remote.GetLastVersion(ctx); e != nil || last.ID != 1 {
+		t.Errorf("GetLastVersion() = %d, %v, want nothing uploaded", last.ID, e)
+	}
+
+	if conflict, e := c.Conflict(); e != nil || conflict == nil || conflict.Version.ID != 1 {
+		t.Errorf("Conflict() = %+v, %v, want conflict with version 1", conflict, e)
+	}
+}
+
+func TestSyncerDetectsChangesByContent(t *testing.T) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+	desktop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	ra, _ := newTestReplica(t, "nas", remoteDir)
+	a := New("personal", laptop, 0, ra)
+	rb, _ := newTestReplica(t, "nas", remoteDir)
+	b := New("personal", desktop, 0, rb)
+
+	os.WriteFile(laptop, []byte("first"), 0o600)
+	if _, e := a.Sync(ctx); e != nil {
+		t.Fatalf("Sync() error = %v", e)
+	}
+
+	// Touching the database without changing it uploads nothing.
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(laptop, future, future)
+	if res, e := a.Sync(ctx); e != nil || res.Action != ActionNone || res.Version.ID != 1 {
+		t.Fatalf("Sync() = %+v, %v, want up to date at version 1", res, e)
+	}
+
+	if res, e := a.Push(ctx); e != nil || res.Action != ActionNone {
+		t.Fatalf("Push() = %+v, %v, want up to date", res, e)
+	}
+
+	// A change is pushed even though the clock of the laptop lags behind.
+	os.WriteFile(laptop, []byte("second"), 0o600)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(laptop, past, past)
+	if res, e := a.Sync(ctx); e != nil || res.Action != ActionPushed || res.Version.ID != 2 {
+		t.Fatalf("Sync() = %+v, %v, want pushed version 2", res, e)
+	}
+
+	if res, e := b.Sync(ctx); e != nil || res.Action != ActionPulled {
+		t.Fatalf("Sync() = %+v, %v, want pulled", res, e)
+	}
+
+	// Both devices change the database before syncing again.
+	os.WriteFile(desktop, []byte("desktop"), 0o600)
+	if res, e := b.Sync(ctx); e != nil || res.Action != ActionPushed {
+		t.Fatalf("Sync() = %+v, %v, want pushed", res, e)
+	}
+
+	os.WriteFile(laptop, []byte("laptop"), 0o600)
+	if _, e := a.Sync(ctx); !errors.Is(e, ErrDiverged) {
+		t.Fatalf("Sync() error = %v, want %v", e, ErrDiverged)
+	}
+
+	if got, _ := os.ReadFile(laptop); string(got) != "laptop" {
+		t.Errorf("local database = %q, want it untouched", got)
+	}
+}
+
+func TestSyncerRefusesInvalidDatabases(t *testing.T) {
+	ctx := context.Background()
+	laptop := filepath.Join(t.TempDir(), "personal.kdbx")
+
+	ra, _ := newTestReplica(t, "nas", t.TempDir())
+	a := New("personal", laptop, 0, ra)
+	a.ValidateWith(func(data []byte) error {
+		return kdbx.Validate(bytes.NewReader(data), nil)
+	})
+
+	// A save that was cut short leaves a file of zeroes behind.
+	os.WriteFile(laptop, make([]byte, 4096), 0o600)
+
+	for name, op := range map[string]func(context.Context) (*Result, error){"Sync": a.Sync, "Push": a.Push} {
+		if _, e := op(ctx); !errors.Is(e, kdbx.ErrNotKDBX) {
+			t.Errorf("%s() error = %v, want %v", name, e, kdbx.ErrNotKDBX)
+		}
+	}
+
+	if last, e := ra.Remote.GetLastVersion(ctx); e != nil || last.ID != 0 {
+		t.Errorf("GetLastVersion() = %d, %v, want nothing uploaded", last.ID, e)
+	}
+}